@@ -0,0 +1,61 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// DefaultMostAttachmentsPerMessage limits [Message.Attachments].
+const DefaultMostAttachmentsPerMessage = 4
+
+// ErrBlobNotFound is returned by a [BlobStore] for unknown identifiers.
+var ErrBlobNotFound = errors.New("attachment not found")
+
+// Attachment describes a file uploaded into a [BlobStore]
+// and referenced by a [Message].
+type Attachment struct {
+	ID          string
+	Name        string
+	ContentType string
+	Size        int64
+
+	// UploaderID is the [Identity.ID] of the uploader. Only the
+	// uploader may attach the file to a message.
+	UploaderID string
+}
+
+// IsImage is true for attachments that can be displayed inline.
+func (a Attachment) IsImage() bool {
+	return strings.HasPrefix(a.ContentType, "image/")
+}
+
+// BlobStore keeps attachment contents. Identifiers are
+// chosen by the caller and must be unique.
+type BlobStore interface {
+	Store(ctx context.Context, a Attachment, r io.Reader) (Attachment, error)
+	Stat(ctx context.Context, id string) (Attachment, error)
+	Open(ctx context.Context, id string) (Attachment, io.ReadCloser, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// NewMostAttachmentsValidator rejects messages that
+// carry more than the limit of attachments.
+func NewMostAttachmentsValidator(limit int) MessageValidator {
+	if limit < 1 {
+		panic("attachment limit cannot be lower than one")
+	}
+	return MessageValidatorFunc(
+		func(ctx context.Context, b Broadcast) (Broadcast, error) {
+			if count := len(b.Attachments); count > limit {
+				return b, &ContentTooLargeError{
+					Unit:   "attachments",
+					Limit:  limit,
+					Actual: count,
+				}
+			}
+			return b, nil
+		},
+	)
+}
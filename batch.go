@@ -8,18 +8,29 @@ func Batch[T any](
 	in <-chan T,
 	limit int,
 	flush time.Duration,
+) (out chan []T) {
+	return BatchWithClock(in, limit, flush, SystemClock{})
+}
+
+// BatchWithClock is [Batch] that flushes on the ticks of a [Clock].
+func BatchWithClock[T any](
+	in <-chan T,
+	limit int,
+	flush time.Duration,
+	clock Clock,
 ) (out chan []T) {
 	out = make(chan []T)
 
 	go func() {
-		tick := time.NewTicker(flush)
+		tick := clock.NewTicker(flush)
+		defer tick.Stop()
 		batch := make([]T, 0, limit)
 		for {
 			select {
 			case item, ok := <-in:
 				if !ok {
 					if len(batch) > 0 {
-						batchCopy := make([]T, 0, len(batch))
+						batchCopy := make([]T, len(batch))
 						copy(batchCopy, batch)
 						out <- batchCopy
 					}
@@ -28,14 +39,14 @@ func Batch[T any](
 				}
 				batch = append(batch, item)
 				if len(batch) >= limit {
-					batchCopy := make([]T, 0, len(batch))
+					batchCopy := make([]T, len(batch))
 					copy(batchCopy, batch)
 					out <- batchCopy
 					batch = batch[:0] // truncate
 				}
-			case <-tick.C:
+			case <-tick.C():
 				if len(batch) > 0 {
-					batchCopy := make([]T, 0, len(batch))
+					batchCopy := make([]T, len(batch))
 					copy(batchCopy, batch)
 					out <- batchCopy
 					batch = batch[:0] // truncate
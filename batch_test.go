@@ -1,7 +1,8 @@
 package watermillchat_test
 
 import (
-	"math/rand"
+	"context"
+	"slices"
 	"testing"
 	"time"
 
@@ -9,22 +10,35 @@ import (
 )
 
 func TestBatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	clock := watermillchat.NewFakeClock(time.Unix(1_700_000_000, 0))
 	items := make(chan int)
-	go func() {
-		for range 100 {
-			items <- 9
-			time.Sleep(time.Microsecond * time.Duration(rand.Intn(1000)))
-		}
-		close(items)
-	}()
+	out := watermillchat.BatchWithClock(items, 3, time.Millisecond, clock)
+	if err := clock.BlockUntil(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, item := range []int{1, 2, 3} {
+		items <- item
+	}
+	if batch := <-out; !slices.Equal(batch, []int{1, 2, 3}) {
+		t.Fatal("full batch was not flushed immediately:", batch)
+	}
+
+	items <- 4
+	clock.Advance(time.Millisecond)
+	if batch := <-out; !slices.Equal(batch, []int{4}) {
+		t.Fatal("partial batch was not flushed on tick:", batch)
+	}
 
-	out := watermillchat.Batch(items, 3, time.Millisecond)
-	for batch := range out {
-		for _, item := range batch {
-			if item != 9 {
-				t.Errorf("unexpected item: %d vs 9", item)
-			}
-		}
-		t.Logf("end batch: %+v", batch)
+	items <- 5
+	close(items)
+	if batch := <-out; !slices.Equal(batch, []int{5}) {
+		t.Fatal("remaining batch was not flushed on close:", batch)
+	}
+	if _, ok := <-out; ok {
+		t.Fatal("output was not closed")
 	}
 }
@@ -0,0 +1,190 @@
+/*
+Package localblob implements [watermillchat.BlobStore]
+using a directory on the local file system.
+*/
+package localblob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+)
+
+var validID = regexp.MustCompile(`^[0-9A-Za-z_\-]{1,128}$`)
+
+// Store keeps each attachment as a file named after its
+// identifier next to a JSON file with its description.
+type Store struct {
+	directory string
+}
+
+// New creates the directory, if it does not exist.
+func New(directory string) (*Store, error) {
+	if directory == "" {
+		return nil, errors.New("blob store directory is required")
+	}
+	if err := os.MkdirAll(directory, 0o750); err != nil {
+		return nil, fmt.Errorf("unable to create blob store directory: %w", err)
+	}
+	return &Store{directory: directory}, nil
+}
+
+func (s *Store) path(id string) (string, error) {
+	if !validID.MatchString(id) {
+		return "", fmt.Errorf("%w: invalid identifier %q", watermillchat.ErrBlobNotFound, id)
+	}
+	return filepath.Join(s.directory, id), nil
+}
+
+// Store copies the contents into a temporary file first, so
+// that an interrupted upload never becomes visible.
+func (s *Store) Store(ctx context.Context, a watermillchat.Attachment, r io.Reader) (_ watermillchat.Attachment, err error) {
+	p, err := s.path(a.ID)
+	if err != nil {
+		return a, err
+	}
+	if _, err = os.Stat(p); err == nil {
+		return a, fmt.Errorf("attachment already exists: %s", a.ID)
+	}
+
+	temporary, err := os.CreateTemp(s.directory, ".upload-*")
+	if err != nil {
+		return a, err
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, os.Remove(temporary.Name()))
+		}
+	}()
+	if a.Size, err = io.Copy(temporary, r); err != nil {
+		return a, errors.Join(err, temporary.Close())
+	}
+	if err = temporary.Close(); err != nil {
+		return a, err
+	}
+	if err = ctx.Err(); err != nil {
+		return a, err
+	}
+
+	description, err := json.Marshal(a)
+	if err != nil {
+		return a, err
+	}
+	if err = os.WriteFile(p+".json", description, 0o640); err != nil {
+		return a, err
+	}
+	if err = os.Rename(temporary.Name(), p); err != nil {
+		return a, errors.Join(err, os.Remove(p+".json"))
+	}
+	return a, nil
+}
+
+func (s *Store) Stat(ctx context.Context, id string) (a watermillchat.Attachment, err error) {
+	p, err := s.path(id)
+	if err != nil {
+		return a, err
+	}
+	description, err := os.ReadFile(p + ".json")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return a, watermillchat.ErrBlobNotFound
+		}
+		return a, err
+	}
+	if err = json.Unmarshal(description, &a); err != nil {
+		return a, fmt.Errorf("unable to decode attachment description: %w", err)
+	}
+	return a, nil
+}
+
+func (s *Store) Open(ctx context.Context, id string) (watermillchat.Attachment, io.ReadCloser, error) {
+	a, err := s.Stat(ctx, id)
+	if err != nil {
+		return a, nil, err
+	}
+	f, err := os.Open(filepath.Join(s.directory, a.ID))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return a, nil, watermillchat.ErrBlobNotFound
+		}
+		return a, nil, err
+	}
+	return a, f, nil
+}
+
+func (s *Store) Delete(ctx context.Context, id string) error {
+	p, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	err = os.Remove(p + ".json")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Prune deletes attachments stored before the cutoff, unless
+// inUse reports that a message still refers to them. Uploads
+// that were never attached are removed this way. Leftovers of
+// interrupted uploads are removed as well. A <nil> inUse
+// function deletes every attachment older than the cutoff.
+func (s *Store) Prune(ctx context.Context, cutoff time.Time, inUse func(ctx context.Context, id string) (bool, error)) error {
+	entries, err := os.ReadDir(s.directory)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if entry.IsDir() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		name := entry.Name()
+		if strings.HasPrefix(name, ".upload-") {
+			if err = os.Remove(filepath.Join(s.directory, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+		id, ok := strings.CutSuffix(name, ".json")
+		if !ok || !validID.MatchString(id) {
+			continue
+		}
+		if inUse != nil {
+			used, err := inUse(ctx, id)
+			if err != nil {
+				return err
+			}
+			if used {
+				continue
+			}
+		}
+		if err = s.Delete(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package localblob_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/blob/localblob"
+)
+
+func TestStore(t *testing.T) {
+	store, err := localblob.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	stored, err := store.Store(ctx, watermillchat.Attachment{
+		ID:          "first",
+		Name:        "notes.txt",
+		ContentType: "text/plain; charset=utf-8",
+	}, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Size != 5 {
+		t.Fatal("unexpected stored size:", stored.Size)
+	}
+	if _, err = store.Store(ctx, stored, strings.NewReader("again")); err == nil {
+		t.Fatal("attachment was overwritten")
+	}
+
+	loaded, r, err := store.Open(ctx, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "hello" || loaded != stored {
+		t.Fatal("loaded attachment does not match:", string(contents), loaded)
+	}
+
+	if err = store.Delete(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Stat(ctx, "first"); !errors.Is(err, watermillchat.ErrBlobNotFound) {
+		t.Fatal("deleted attachment is still present:", err)
+	}
+	if _, err = store.Stat(ctx, "../escape"); err == nil {
+		t.Fatal("path traversal was allowed")
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	directory := t.TempDir()
+	store, err := localblob.New(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, id := range []string{"attached", "orphaned"} {
+		if _, err = store.Store(ctx, watermillchat.Attachment{ID: id}, strings.NewReader(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	interrupted := filepath.Join(directory, ".upload-interrupted")
+	if err = os.WriteFile(interrupted, []byte("partial"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	inUse := func(ctx context.Context, id string) (bool, error) {
+		return id == "attached", nil
+	}
+	if err = store.Prune(ctx, time.Now().Add(-time.Hour), inUse); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Stat(ctx, "orphaned"); err != nil {
+		t.Fatal("recent upload was pruned:", err)
+	}
+
+	if err = store.Prune(ctx, time.Now().Add(time.Hour), inUse); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Stat(ctx, "attached"); err != nil {
+		t.Fatal("attachment in use was pruned:", err)
+	}
+	if _, err = store.Stat(ctx, "orphaned"); !errors.Is(err, watermillchat.ErrBlobNotFound) {
+		t.Fatal("orphaned upload was not pruned:", err)
+	}
+	if _, err = os.Stat(interrupted); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("interrupted upload was not pruned:", err)
+	}
+}
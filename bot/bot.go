@@ -0,0 +1,46 @@
+/*
+Package bot connects automated participants to a [watermillchat.Chat].
+
+A [Bot] answers [Event]s with [Reply]s. A [Runner] subscribes it to
+rooms, skips its own messages, queues incoming messages of each room,
+shows a typing indicator while the bot works, and pauses after errors.
+*/
+package bot
+
+import (
+	"context"
+
+	"github.com/dkotik/watermillchat"
+)
+
+// Event is a new message in a room joined by a [Runner].
+type Event struct {
+	// Chat can be used to look up room history.
+	Chat     *watermillchat.Chat
+	RoomName string
+	Message  watermillchat.Message
+
+	// Self is the identity the bot speaks as.
+	Self watermillchat.Identity
+}
+
+// Reply is a message the bot sends in response to an [Event].
+type Reply struct {
+	Content string
+
+	// Private replies are seen only by the author
+	// of the message that the bot answers.
+	Private bool
+}
+
+// Bot answers events. Returning no replies keeps the bot silent.
+type Bot interface {
+	Handle(context.Context, Event) ([]Reply, error)
+}
+
+// Func adapts a function to the [Bot] interface.
+type Func func(context.Context, Event) ([]Reply, error)
+
+func (f Func) Handle(ctx context.Context, e Event) ([]Reply, error) {
+	return f(ctx, e)
+}
@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"context"
+	"sync"
+)
+
+// queue holds events of a room waiting for the bot. It never
+// blocks the room subscription: a full queue gives up its
+// oldest event, because the conversation moved on.
+type queue struct {
+	events []Event
+	most   int
+	ready  chan struct{}
+	mu     sync.Mutex
+}
+
+func newQueue(most int) *queue {
+	return &queue{
+		events: make([]Event, 0, most),
+		most:   most,
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// push returns the skipped event, if the queue was full.
+func (q *queue) push(e Event) (skipped Event, ok bool) {
+	q.mu.Lock()
+	if len(q.events) >= q.most {
+		skipped, ok = q.events[0], true
+		q.events = append(q.events[:0], q.events[1:]...)
+	}
+	q.events = append(q.events, e)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default: // already signaled
+	}
+	return skipped, ok
+}
+
+// pop waits for the next event until the context is done.
+func (q *queue) pop(ctx context.Context) (e Event, ok bool) {
+	for {
+		q.mu.Lock()
+		if len(q.events) > 0 {
+			e = q.events[0]
+			q.events = append(q.events[:0], q.events[1:]...)
+			q.mu.Unlock()
+			return e, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return e, false
+		case <-q.ready:
+		}
+	}
+}
+
+// memory remembers a limited number of recent message identifiers.
+type memory struct {
+	ids   map[string]struct{}
+	order []string
+	most  int
+}
+
+func newMemory(most int) *memory {
+	return &memory{
+		ids:  make(map[string]struct{}, most),
+		most: most,
+	}
+}
+
+// add returns false if the identifier is already remembered.
+func (m *memory) add(id string) bool {
+	if _, ok := m.ids[id]; ok {
+		return false
+	}
+	if len(m.order) >= m.most {
+		delete(m.ids, m.order[0])
+		m.order = m.order[1:]
+	}
+	m.ids[id] = struct{}{}
+	m.order = append(m.order, id)
+	return true
+}
@@ -0,0 +1,330 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+)
+
+const (
+	DefaultQueueSize           = 8
+	DefaultMostConcurrentRooms = 4
+	DefaultTimeout             = time.Minute * 2
+	DefaultErrorDelay          = time.Second
+	DefaultMostErrorDelay      = time.Minute
+)
+
+// mostRememberedMessages bounds the identifiers kept to
+// recognize messages delivered again after an update.
+const mostRememberedMessages = 1024
+
+var ErrAlreadyJoined = errors.New("bot already joined the room")
+
+type Configuration struct {
+	Chat *watermillchat.Chat
+	Bot  Bot
+
+	// Identity is the author of bot messages. Messages of
+	// this identity are never handled. Name defaults to ID.
+	Identity watermillchat.Identity
+
+	// QueueSize limits messages waiting to be handled in each room.
+	// When the queue is full, the oldest message is skipped and its
+	// author is told so. Defaults to [DefaultQueueSize].
+	QueueSize int
+
+	// MostConcurrentRooms limits rooms handled at the same time.
+	// Messages of a single room are always handled in order.
+	// Defaults to [DefaultMostConcurrentRooms].
+	MostConcurrentRooms int
+
+	// Timeout limits handling of a single event.
+	// Defaults to [DefaultTimeout].
+	Timeout time.Duration
+
+	// ErrorDelay is the pause of a room after the bot fails. It
+	// doubles with every consecutive failure up to MostErrorDelay.
+	// Default to [DefaultErrorDelay] and [DefaultMostErrorDelay].
+	ErrorDelay     time.Duration
+	MostErrorDelay time.Duration
+
+	Logger *slog.Logger
+}
+
+func (c Configuration) Validate() (err error) {
+	if c.Chat == nil {
+		err = errors.Join(err, errors.New("missing chat"))
+	}
+	if c.Bot == nil {
+		err = errors.Join(err, errors.New("missing bot"))
+	}
+	if strings.TrimSpace(c.Identity.ID) == "" {
+		err = errors.Join(err, errors.New("bot identity is required"))
+	}
+	if c.QueueSize < 1 {
+		err = errors.Join(err, errors.New("queue size is lower than one"))
+	}
+	if c.MostConcurrentRooms < 1 {
+		err = errors.Join(err, errors.New("concurrent rooms are fewer than one"))
+	}
+	if c.Timeout <= 0 {
+		err = errors.Join(err, errors.New("timeout must be positive"))
+	}
+	if c.ErrorDelay <= 0 {
+		err = errors.Join(err, errors.New("error delay must be positive"))
+	}
+	if c.MostErrorDelay < c.ErrorDelay {
+		err = errors.Join(err, errors.New("most error delay is shorter than error delay"))
+	}
+	if c.Logger == nil {
+		err = errors.Join(err, errors.New("missing logger"))
+	}
+	return err
+}
+
+// Runner delivers new room messages to a [Bot]
+// and publishes its replies.
+type Runner struct {
+	chat           *watermillchat.Chat
+	bot            Bot
+	identity       watermillchat.Identity
+	queueSize      int
+	handling       chan struct{}
+	timeout        time.Duration
+	errorDelay     time.Duration
+	mostErrorDelay time.Duration
+	logger         *slog.Logger
+
+	joined map[string]struct{}
+	rooms  sync.WaitGroup
+	mu     sync.Mutex
+}
+
+func New(c Configuration) (*Runner, error) {
+	if c.Identity.Name == "" {
+		c.Identity.Name = c.Identity.ID
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = DefaultQueueSize
+	}
+	if c.MostConcurrentRooms == 0 {
+		c.MostConcurrentRooms = DefaultMostConcurrentRooms
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.ErrorDelay == 0 {
+		c.ErrorDelay = DefaultErrorDelay
+	}
+	if c.MostErrorDelay == 0 {
+		c.MostErrorDelay = max(DefaultMostErrorDelay, c.ErrorDelay)
+	}
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("unable to initialize bot runner: %w", err)
+	}
+	return &Runner{
+		chat:           c.Chat,
+		bot:            c.Bot,
+		identity:       c.Identity,
+		queueSize:      c.QueueSize,
+		handling:       make(chan struct{}, c.MostConcurrentRooms),
+		timeout:        c.Timeout,
+		errorDelay:     c.ErrorDelay,
+		mostErrorDelay: c.MostErrorDelay,
+		logger:         c.Logger,
+		joined:         make(map[string]struct{}),
+	}, nil
+}
+
+// Join handles new messages of a room in the background until
+// the context is done or the chat closes. Messages sent before
+// joining are not handled.
+func (r *Runner) Join(ctx context.Context, roomName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.joined[roomName]; ok {
+		return fmt.Errorf("%w: %s", ErrAlreadyJoined, roomName)
+	}
+	r.joined[roomName] = struct{}{}
+
+	ctx, cancel := context.WithCancel(watermillchat.ContextWithIdentity(ctx, r.identity))
+	batches := r.chat.SubscribeNew(ctx, roomName)
+	q := newQueue(r.queueSize)
+	r.rooms.Add(2)
+	go func() {
+		defer r.rooms.Done()
+		r.work(ctx, roomName, q)
+	}()
+	go func() {
+		defer r.rooms.Done()
+		defer func() {
+			cancel() // stop the worker when the chat closes
+			r.mu.Lock()
+			delete(r.joined, roomName)
+			r.mu.Unlock()
+		}()
+		seen := newMemory(mostRememberedMessages)
+		for batch := range batches {
+			for _, m := range batch {
+				if !r.answers(m) || !seen.add(m.ID) {
+					continue
+				}
+				if skipped, ok := q.push(Event{
+					Chat:     r.chat,
+					RoomName: roomName,
+					Message:  m,
+					Self:     r.identity,
+				}); ok {
+					r.logger.WarnContext(ctx, "bot skipped a message, because it is busy",
+						slog.String("roomName", roomName),
+						slog.String("messageID", skipped.Message.ID),
+					)
+					r.notify(ctx, skipped, r.identity.Name+" is busy and skipped your message.")
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Wait blocks until every joined room is left.
+func (r *Runner) Wait() {
+	r.rooms.Wait()
+}
+
+// answers is false for own, system, private, action, and edited messages.
+func (r *Runner) answers(m watermillchat.Message) bool {
+	return m.Author != nil && m.Author.ID != r.identity.ID && !m.Ephemeral && !m.Action && m.UpdatedAt == 0
+}
+
+// work handles queued events of a room one at a time.
+func (r *Runner) work(ctx context.Context, roomName string, q *queue) {
+	clock := r.chat.Clock()
+	delay := r.errorDelay
+	for {
+		e, ok := q.pop(ctx)
+		if !ok {
+			return
+		}
+		err := r.handle(ctx, e)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			delay = r.errorDelay
+			continue
+		}
+		r.logger.ErrorContext(ctx, "bot was unable to answer a message",
+			slog.String("roomName", roomName),
+			slog.String("messageID", e.Message.ID),
+			slog.Duration("pause", delay),
+			slog.Any("error", err),
+		)
+		r.notify(ctx, e, r.identity.Name+" is unable to answer right now.")
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(delay):
+		}
+		delay = min(delay*2, r.mostErrorDelay)
+	}
+}
+
+func (r *Runner) handle(ctx context.Context, e Event) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case r.handling <- struct{}{}:
+	}
+	defer func() { <-r.handling }()
+
+	stopTyping := r.showTyping(ctx, e.RoomName)
+	defer stopTyping()
+	handleCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	replies, err := r.bot.Handle(handleCtx, e)
+	cancel()
+	if err != nil {
+		return err
+	}
+	for _, reply := range replies {
+		if err = r.reply(ctx, e, reply); err != nil {
+			return fmt.Errorf("unable to send a reply: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) reply(ctx context.Context, e Event, reply Reply) error {
+	content := strings.TrimSpace(reply.Content)
+	if content == "" {
+		return nil
+	}
+	author := r.identity
+	if reply.Private {
+		return r.chat.Notify(ctx, e.RoomName, e.Message.Author.ID, watermillchat.Message{
+			Author:  &author,
+			Content: content,
+		})
+	}
+	if strings.HasPrefix(content, watermillchat.CommandPrefix) {
+		content = watermillchat.CommandPrefix + content // never run commands
+	}
+	return r.chat.Broadcast(ctx, watermillchat.Broadcast{
+		RoomName: e.RoomName,
+		Message: watermillchat.Message{
+			Author:    &author,
+			Content:   content,
+			CreatedAt: r.chat.Clock().Now().Unix(),
+		},
+	})
+}
+
+// notify tells the author of an event about what happened to it.
+func (r *Runner) notify(ctx context.Context, e Event, content string) {
+	if err := r.chat.Notify(ctx, e.RoomName, e.Message.Author.ID, watermillchat.Message{
+		Content: content,
+	}); err != nil && ctx.Err() == nil {
+		r.logger.WarnContext(ctx, "bot was unable to send a notice",
+			slog.String("roomName", e.RoomName),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// showTyping keeps the typing indicator of the bot
+// on until the returned function is called.
+func (r *Runner) showTyping(parent context.Context, roomName string) (stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tick := r.chat.Clock().NewTicker(watermillchat.TypingTimeout / 2)
+		defer tick.Stop()
+		for {
+			if err := r.chat.Typing(ctx, roomName, true); err != nil && ctx.Err() == nil {
+				r.logger.DebugContext(ctx, "bot was unable to show typing indicator", slog.Any("error", err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C():
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		if err := r.chat.Typing(parent, roomName, false); err != nil && parent.Err() == nil {
+			r.logger.DebugContext(parent, "bot was unable to hide typing indicator", slog.Any("error", err))
+		}
+	}
+}
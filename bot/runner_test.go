@@ -0,0 +1,141 @@
+package bot_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/bot"
+)
+
+func TestRunner(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// messages arrive in the order they are published
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		BlockPublishUntilSubscriberAck: true,
+	}, watermill.NopLogger{})
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		Watermill: watermillchat.WatermillConfiguration{
+			Publisher:  pubSub,
+			Subscriber: pubSub,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	handled := make(chan string, 10)
+	runner, err := bot.New(bot.Configuration{
+		Chat:       chat,
+		Identity:   watermillchat.Identity{ID: "bot", Name: "Bot"},
+		QueueSize:  1,
+		ErrorDelay: time.Millisecond * 10,
+		Bot: bot.Func(func(ctx context.Context, e bot.Event) ([]bot.Reply, error) {
+			handled <- e.Message.Content
+			switch e.Message.Content {
+			case "hello":
+				<-release
+				return []bot.Reply{
+					{Content: "/hi " + e.Message.Author.Name},
+					{Content: "psst", Private: true},
+				}, nil
+			case "fail":
+				return nil, errors.New("bot failed")
+			}
+			return nil, nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := watermillchat.Identity{ID: "alice", Name: "Alice"}
+	aliceCtx := watermillchat.ContextWithIdentity(ctx, alice)
+	batches := chat.Subscribe(aliceCtx, "lobby")
+	typing := chat.SubscribeTyping(ctx, "lobby")
+	<-typing
+	if err = runner.Join(ctx, "lobby"); err != nil {
+		t.Fatal(err)
+	}
+	if err = runner.Join(ctx, "lobby"); !errors.Is(err, bot.ErrAlreadyJoined) {
+		t.Fatal("room was joined twice:", err)
+	}
+
+	send := func(content string) {
+		t.Helper()
+		if err := chat.Broadcast(ctx, watermillchat.Broadcast{
+			RoomName: "lobby",
+			Message:  watermillchat.Message{Author: &alice, Content: content},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var pending []watermillchat.Message
+	next := func() watermillchat.Message {
+		t.Helper()
+		for {
+			for len(pending) == 0 {
+				select {
+				case <-ctx.Done():
+					t.Fatal("message was not delivered")
+				case pending = <-batches:
+				}
+			}
+			m := pending[0]
+			pending = pending[1:]
+			if m.Author == nil || m.Author.ID != alice.ID {
+				return m // skip own messages
+			}
+		}
+	}
+	waitTyping := func(expected int) {
+		t.Helper()
+		for {
+			select {
+			case <-ctx.Done():
+				t.Fatalf("typing indicator did not show %d identities", expected)
+			case identities := <-typing:
+				if len(identities) == expected {
+					return
+				}
+			}
+		}
+	}
+
+	send("hello")
+	waitTyping(1)
+	send("one")
+	send("two") // skips "one", because the queue is full
+	if m := next(); !m.Ephemeral || m.Content != "Bot is busy and skipped your message." {
+		t.Fatalf("unexpected busy notice: %+v", m)
+	}
+
+	close(release)
+	if m := next(); m.Author == nil || m.Author.ID != "bot" || m.Content != "/hi Alice" || m.Ephemeral {
+		t.Fatalf("unexpected reply: %+v", m)
+	}
+	if m := next(); !m.Ephemeral || m.Content != "psst" {
+		t.Fatalf("unexpected private reply: %+v", m)
+	}
+	waitTyping(0)
+
+	send("fail")
+	if m := next(); !m.Ephemeral || m.Content != "Bot is unable to answer right now." {
+		t.Fatalf("unexpected failure notice: %+v", m)
+	}
+	for _, expected := range []string{"hello", "two", "fail"} {
+		// own replies are never handled
+		if content := <-handled; content != expected {
+			t.Fatalf("handled %q instead of %q", content, expected)
+		}
+	}
+
+	cancel()
+	runner.Wait()
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
@@ -19,6 +20,28 @@ type Message struct {
 	Content   string
 	CreatedAt int64
 	UpdatedAt int64
+
+	// Action messages describe what the author is doing,
+	// like "/me waves", and are shown after the author name.
+	Action bool `json:",omitempty"`
+
+	// Mentions are room members referred to by @name in the content.
+	Mentions []Identity
+
+	// Attachments are files kept in a [BlobStore].
+	Attachments []Attachment
+
+	// Previews summarize linked pages. They are added
+	// by a [PreviewEvent] after the message is published.
+	Previews []LinkPreview
+
+	// Reactions are toggled by [ReactionEvent]s.
+	Reactions []Reaction
+
+	// Ephemeral messages reach a single identity
+	// through [Chat.Notify]. They are neither
+	// retained nor stored.
+	Ephemeral bool `json:",omitempty"`
 }
 
 type Broadcast struct {
@@ -26,19 +49,84 @@ type Broadcast struct {
 	RoomName string
 }
 
-func (c *Chat) Broadcast(ctx context.Context, b Broadcast) (err error) {
+// Broadcast validates, rate limits, and moderates a message
+// before publishing it to the Watermill topic.
+func (c *Chat) Broadcast(ctx context.Context, b Broadcast) error {
+	_, err := c.Send(ctx, b)
+	return err
+}
+
+// Send is [Chat.Broadcast] that returns the published message
+// with its assigned ID and resolved mentions. Authored messages
+// starting with [CommandPrefix] run a [Command] instead and
+// return an empty message.
+func (c *Chat) Send(ctx context.Context, b Broadcast) (Message, error) {
+	b.ID = watermill.NewUUID()
+	return c.sendBroadcast(ctx, b)
+}
+
+// sendBroadcast is [Chat.Send] of a broadcast with an assigned ID.
+func (c *Chat) sendBroadcast(ctx context.Context, b Broadcast) (m Message, err error) {
 	if b.RoomName == "" {
-		return errors.New("chat room name is required")
+		return m, errors.New("chat room name is required")
 	}
-	if b.Content == "" {
-		return errors.New("unable to send an empty message")
+	if c.closing.Err() != nil {
+		return m, ErrChatClosed
 	}
-	b.ID = watermill.NewUUID()
+	if b, err = c.validator.ValidateMessage(ctx, b); err != nil {
+		return m, err
+	}
+	now := c.clock.Now()
+	if b.Author != nil {
+		if err = c.identityLimiter.Take(b.Author.ID, now); err != nil {
+			return m, err
+		}
+		if err = c.checkKicked(ctx, b.RoomName, b.Author.ID); err != nil {
+			return m, err
+		}
+	}
+	if command, ok := c.command(&b); ok {
+		return m, c.runCommand(ctx, command)
+	}
+	return c.sendToRoom(ctx, b, now)
+}
+
+// sendToRoom rate limits the room, moderates, and publishes a broadcast
+// after its author was rate limited and checked for being kicked.
+func (c *Chat) sendToRoom(ctx context.Context, b Broadcast, now time.Time) (m Message, err error) {
+	if err = c.roomLimiter.Take(b.RoomName, now); err != nil {
+		if b.Author != nil {
+			// throttled by the room, not by the author
+			c.identityLimiter.Refund(b.Author.ID, now)
+		}
+		return m, err
+	}
+	if b, err = c.moderate(ctx, b); err != nil {
+		return m, err
+	}
+	return c.publishModerated(ctx, b)
+}
+
+// publishModerated resolves mentions of a broadcast that passed
+// moderation, publishes it, and looks up its link previews.
+func (c *Chat) publishModerated(ctx context.Context, b Broadcast) (Message, error) {
+	if c.closing.Err() != nil {
+		return Message{}, ErrChatClosed
+	}
+	b.Mentions = c.resolveMentions(ctx, b.RoomName, b.Content)
+	if err := c.publish(ctx, b); err != nil {
+		return Message{}, err
+	}
+	c.previewLinks(b)
+	return b.Message, nil
+}
+
+func (c *Chat) publish(ctx context.Context, b Broadcast) error {
 	payload, err := json.Marshal(b)
 	if err != nil {
 		return fmt.Errorf("unable to encode broadcast message: %w", err)
 	}
 	m := message.NewMessage(b.ID, payload)
 	m.SetContext(ctx)
-	return c.publisher.Publish(c.publisherTopic, m)
+	return c.send(m)
 }
@@ -20,14 +20,15 @@ func (r *Room) cleanOut(cutoff int64, messageLimit int) {
 }
 
 func (c *Chat) cleanup(ctx context.Context, frequency time.Duration) {
-	tick := time.NewTicker(frequency)
+	tick := c.clock.NewTicker(frequency)
+	defer tick.Stop()
 	var t time.Time
 	var roomQueue []*Room
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case t = <-tick.C:
+		case t = <-tick.C():
 			slog.Debug("cleaning up expiring messages")
 			c.mu.Lock()
 			roomQueue = slices.Collect(maps.Values(c.rooms))
@@ -36,6 +37,8 @@ func (c *Chat) cleanup(ctx context.Context, frequency time.Duration) {
 			for _, room := range roomQueue {
 				room.cleanOut(t.Add(-c.historyRetention).Unix(), c.historyDepth)
 			}
+			c.identityLimiter.Prune(t)
+			c.roomLimiter.Prune(t)
 		}
 	}
 }
@@ -0,0 +1,279 @@
+/*
+Package client posts into and listens to rooms of a chat server
+through the JSON API registered by [httpmux.AddAPI], so that
+services do not have to embed [watermillchat.Chat] or share
+its Watermill broker.
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+)
+
+const (
+	DefaultReconnectDelay     = time.Second
+	DefaultMostReconnectDelay = time.Second * 30
+
+	// mostErrorBytes limits how much of a failed response is read.
+	mostErrorBytes = 1 << 14
+)
+
+// Errors matched by [Error] status codes with [errors.Is].
+var (
+	ErrInvalid      = errors.New("request was rejected as invalid")
+	ErrUnauthorized = errors.New("authentication is required")
+	ErrForbidden    = errors.New("request is not allowed")
+	ErrNotFound     = errors.New("resource was not found")
+	ErrRateLimited  = errors.New("too many requests")
+	ErrUnavailable  = errors.New("server is unavailable")
+)
+
+// Error is a failed request described by the server
+// with a [hypermedia.JSONError].
+type Error struct {
+	StatusCode int
+	Message    string
+
+	// RetryAfter is the pause requested by the server, if any.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("chat server responded with status code %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *Error) HyperTextStatusCode() int {
+	return e.StatusCode
+}
+
+func (e *Error) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusBadRequest,
+		http.StatusRequestEntityTooLarge,
+		http.StatusUnsupportedMediaType,
+		http.StatusUnprocessableEntity:
+		return ErrInvalid
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
+	default:
+		return nil
+	}
+}
+
+// BearerToken authenticates requests with the
+// Authorization header, like "Bearer token".
+func BearerToken(token string) func(*http.Request) {
+	return func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+type Configuration struct {
+	// URL of the chat server including the prefix of
+	// [httpmux.Configuration], like "https://example.com/chat/".
+	URL string
+
+	// HTTPClient sends requests. It must not have a timeout,
+	// because streams stay open. Defaults to [http.DefaultClient].
+	HTTPClient *http.Client
+
+	// Authenticate adds credentials to each request,
+	// like [BearerToken]. Anonymous clients cannot send messages.
+	Authenticate func(*http.Request)
+
+	// ReconnectDelay is the first pause before reconnecting a stream.
+	// It doubles with each failure up to MostReconnectDelay.
+	// Defaults to [DefaultReconnectDelay].
+	ReconnectDelay time.Duration
+
+	// MostReconnectDelay is the longest pause before reconnecting
+	// a stream. Defaults to [DefaultMostReconnectDelay].
+	MostReconnectDelay time.Duration
+
+	Logger *slog.Logger
+}
+
+func (c Configuration) Validate() (err error) {
+	if u, parseErr := url.Parse(c.URL); parseErr != nil {
+		err = errors.Join(err, fmt.Errorf("invalid URL: %w", parseErr))
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		err = errors.Join(err, errors.New("URL scheme must be http or https"))
+	}
+	if c.HTTPClient == nil {
+		err = errors.Join(err, errors.New("missing HTTP client"))
+	} else if c.HTTPClient.Timeout != 0 {
+		err = errors.Join(err, errors.New("HTTP client timeout would interrupt streams"))
+	}
+	if c.ReconnectDelay < time.Millisecond {
+		err = errors.Join(err, errors.New("reconnect delay is lower than one millisecond"))
+	}
+	if c.MostReconnectDelay < c.ReconnectDelay {
+		err = errors.Join(err, errors.New("most reconnect delay is lower than reconnect delay"))
+	}
+	if c.Logger == nil {
+		err = errors.Join(err, errors.New("missing Logger"))
+	}
+	return err
+}
+
+type Client struct {
+	api                string
+	http               *http.Client
+	authenticate       func(*http.Request)
+	reconnectDelay     time.Duration
+	mostReconnectDelay time.Duration
+	logger             *slog.Logger
+}
+
+func New(c Configuration) (*Client, error) {
+	if !strings.HasSuffix(c.URL, "/") {
+		c.URL += "/"
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = http.DefaultClient
+	}
+	if c.Authenticate == nil {
+		c.Authenticate = func(*http.Request) {}
+	}
+	if c.ReconnectDelay == 0 {
+		c.ReconnectDelay = DefaultReconnectDelay
+	}
+	if c.MostReconnectDelay == 0 {
+		c.MostReconnectDelay = max(DefaultMostReconnectDelay, c.ReconnectDelay)
+	}
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &Client{
+		api:                c.URL + "api/" + httpmux.APIVersion + "/",
+		http:               c.HTTPClient,
+		authenticate:       c.Authenticate,
+		reconnectDelay:     c.ReconnectDelay,
+		mostReconnectDelay: c.MostReconnectDelay,
+		logger:             c.Logger,
+	}, nil
+}
+
+// Rooms lists public rooms, the most recently active first.
+func (c *Client) Rooms(ctx context.Context) ([]watermillchat.RoomListing, error) {
+	list := httpmux.APIRoomList{}
+	if err := c.do(ctx, http.MethodGet, "rooms", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Rooms, nil
+}
+
+// History returns up to limit room messages, oldest first,
+// that precede the cursor. The latest messages are returned
+// for an empty cursor. The returned cursor is empty when
+// there are no older messages.
+func (c *Client) History(ctx context.Context, roomName, cursor string, limit int) ([]watermillchat.Message, string, error) {
+	query := url.Values{}
+	if cursor != "" {
+		query.Set("before", cursor)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	page := httpmux.APIMessagePage{}
+	if err := c.do(ctx, http.MethodGet, roomPath(roomName, "messages")+"?"+query.Encode(), nil, &page); err != nil {
+		return nil, "", err
+	}
+	return page.Messages, page.Cursor, nil
+}
+
+// Broadcast sends a message as the authenticated identity
+// and returns it with the assigned ID.
+func (c *Client) Broadcast(ctx context.Context, roomName, content string) (m watermillchat.Message, err error) {
+	err = c.do(ctx, http.MethodPost, roomPath(roomName, "messages"), httpmux.APIMessageDraft{
+		Content: content,
+	}, &m)
+	return m, err
+}
+
+func roomPath(roomName, resource string) string {
+	return "rooms/" + url.PathEscape(roomName) + "/" + resource
+}
+
+func (c *Client) request(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	r, err := http.NewRequestWithContext(ctx, method, c.api+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	r.Header.Set("Accept", "application/json")
+	c.authenticate(r)
+	return r, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(payload)
+	}
+	r, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	response, err := c.http.Do(r)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return readError(response)
+	}
+	if err = json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("unable to decode chat server response: %w", err)
+	}
+	return nil
+}
+
+// readError decodes a [hypermedia.JSONError]. Falls back
+// on status text for proxies that respond in other formats.
+func readError(response *http.Response) error {
+	body := hypermedia.JSONError{}
+	if err := json.NewDecoder(io.LimitReader(response.Body, mostErrorBytes)).Decode(&body); err != nil || body.Message == "" {
+		body.Message = http.StatusText(response.StatusCode)
+	}
+	err := &Error{
+		StatusCode: response.StatusCode,
+		Message:    body.Message,
+	}
+	if seconds, parseErr := strconv.Atoi(response.Header.Get("Retry-After")); parseErr == nil {
+		err.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return err
+}
@@ -0,0 +1,190 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/client"
+	"github.com/dkotik/watermillchat/httpmux"
+)
+
+func newServer(t *testing.T, ctx context.Context) *httptest.Server {
+	t.Helper()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = chat.CreateRoom(ctx, watermillchat.RoomMetadata{Name: "lobby", Title: "Lobby"}); err != nil {
+		t.Fatal(err)
+	}
+	mux, err := httpmux.New(httpmux.Configuration{
+		Chat:          chat,
+		Prefix:        "/chat/",
+		Authenticator: httpmux.NaiveBearerHeaderAuthenticatorUnsafe,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(mux)
+}
+
+func newClient(t *testing.T, server *httptest.Server, token string) *client.Client {
+	t.Helper()
+	// own connections are not broken by other clients
+	transport := &http.Transport{}
+	t.Cleanup(transport.CloseIdleConnections)
+	c := client.Configuration{
+		URL:            server.URL + "/chat",
+		HTTPClient:     &http.Client{Transport: transport},
+		ReconnectDelay: time.Millisecond * 20,
+	}
+	if token != "" {
+		c.Authenticate = client.BearerToken(token)
+	}
+	chatClient, err := client.New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chatClient
+}
+
+func receive(t *testing.T, ctx context.Context, batches <-chan []watermillchat.Message) []watermillchat.Message {
+	t.Helper()
+	select {
+	case <-ctx.Done():
+		t.Fatal("batch was not received")
+	case batch, ok := <-batches:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return batch
+	}
+	return nil
+}
+
+func TestBroadcastAndSubscribe(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	server := newServer(t, ctx)
+	defer server.Close()
+	streamCtx, stop := context.WithCancel(ctx)
+	defer stop() // before the server waits for streams to end
+
+	alice := newClient(t, server, "alice:Alice")
+	anonymous := newClient(t, server, "")
+
+	rooms, err := anonymous.Rooms(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 1 || rooms[0].Title != "Lobby" {
+		t.Fatalf("unexpected rooms: %+v", rooms)
+	}
+
+	if _, err = anonymous.Broadcast(ctx, "lobby", "helo"); !errors.Is(err, client.ErrForbidden) {
+		t.Fatal("anonymous message was accepted:", err)
+	}
+	if _, err = alice.Broadcast(ctx, "lobby", " "); !errors.Is(err, client.ErrInvalid) {
+		t.Fatal("empty message was accepted:", err)
+	} else if statusErr := (*client.Error)(nil); !errors.As(err, &statusErr) || statusErr.Message != "Message is empty" {
+		t.Fatal("server explanation was lost:", err)
+	}
+
+	first, err := alice.Broadcast(ctx, "lobby", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == "" || first.Author == nil || first.Author.Name != "Alice" {
+		t.Fatalf("unexpected message: %+v", first)
+	}
+	messages, cursor, err := anonymous.History(ctx, "lobby", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].ID != first.ID || cursor != "" {
+		t.Fatalf("unexpected history: %+v %q", messages, cursor)
+	}
+
+	subscription := anonymous.Subscribe(streamCtx, "lobby")
+	batches := subscription.C
+	if batch := receive(t, ctx, batches); len(batch) != 1 || batch[0].ID != first.ID {
+		t.Fatalf("unexpected first batch: %+v", batch)
+	}
+	second, err := alice.Broadcast(ctx, "lobby", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch := receive(t, ctx, batches); len(batch) != 1 || batch[0].ID != second.ID {
+		t.Fatalf("unexpected batch: %+v", batch)
+	}
+
+	stop()
+	for range batches {
+		// drain until closed
+	}
+	if err = subscription.Err(); !errors.Is(err, context.Canceled) {
+		t.Fatal("unexpected subscription error:", err)
+	}
+}
+
+func TestSubscribeResumesAfterReconnect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	server := newServer(t, ctx)
+	defer server.Close()
+	streamCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	alice := newClient(t, server, "alice:Alice")
+	if _, err := alice.Broadcast(ctx, "lobby", "first"); err != nil {
+		t.Fatal(err)
+	}
+	batches := alice.Subscribe(streamCtx, "lobby").C
+	receive(t, ctx, batches)
+	second, err := alice.Broadcast(ctx, "lobby", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(t, ctx, batches)
+
+	server.CloseClientConnections()
+	third, err := newClient(t, server, "bob:Bob").Broadcast(ctx, "lobby", "third")
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := receive(t, ctx, batches)
+	if len(batch) != 1 || batch[0].ID != third.ID {
+		t.Fatalf("stream did not resume after %s: %+v", second.ID, batch)
+	}
+}
+
+func TestSubscribeStopsWhenForbidden(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	requests := atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"StatusCode":403,"Message":"kicked out of the room"}`))
+	}))
+	defer server.Close()
+
+	subscription := newClient(t, server, "alice:Alice").Subscribe(ctx, "lobby")
+	for range subscription.C {
+		t.Fatal("forbidden stream delivered messages")
+	}
+	err := subscription.Err()
+	if !errors.Is(err, client.ErrForbidden) {
+		t.Fatal("unexpected subscription error:", err)
+	}
+	if count := requests.Load(); count != 1 {
+		t.Fatal("forbidden stream was retried:", count)
+	}
+}
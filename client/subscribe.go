@@ -0,0 +1,178 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux"
+)
+
+// mostEventBytes limits a single server sent event,
+// which holds every retained message of a room.
+const mostEventBytes = 1 << 24
+
+// Subscription delivers batches of room messages on C.
+type Subscription struct {
+	C <-chan []watermillchat.Message
+
+	err error
+}
+
+// Err explains why C was closed: either the context is done
+// or the server refused the stream in a way that retrying
+// cannot fix, like [ErrForbidden]. Call it after C is closed.
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// Subscribe streams batches of room messages until the context
+// is done. The first batch holds retained messages. Edited messages
+// arrive again with the same ID. Broken streams are reconnected and
+// resume after the last received message. When the server cannot
+// resume them, retained messages are delivered again. Streams
+// refused as invalid, unauthorized, forbidden, or not found
+// are not retried.
+func (c *Client) Subscribe(ctx context.Context, roomName string) *Subscription {
+	batches := make(chan []watermillchat.Message)
+	subscription := &Subscription{C: batches}
+	go func() {
+		defer close(batches)
+		lastEventID := ""
+		delay := c.reconnectDelay
+		for {
+			received, pause, err := c.stream(ctx, roomName, &lastEventID, batches)
+			if ctx.Err() != nil {
+				subscription.err = ctx.Err()
+				return
+			}
+			if !isRetryable(err) {
+				subscription.err = err
+				return
+			}
+			if received {
+				delay = c.reconnectDelay
+			}
+			if pause == 0 {
+				pause = delay
+			}
+			var statusErr *Error
+			if errors.As(err, &statusErr) && statusErr.RetryAfter > pause {
+				pause = statusErr.RetryAfter
+			}
+			// spread out clients that lost the same server
+			pause = pause/2 + time.Duration(rand.Int64N(int64(pause/2)+1))
+			c.logger.WarnContext(ctx, "chat stream was interrupted",
+				slog.String("roomName", roomName),
+				slog.Duration("reconnectAfter", pause),
+				slog.Any("error", err),
+			)
+
+			select {
+			case <-ctx.Done():
+				subscription.err = ctx.Err()
+				return
+			case <-time.After(pause):
+			}
+			delay = min(delay*2, c.mostReconnectDelay)
+		}
+	}()
+	return subscription
+}
+
+// isRetryable is false for requests that the
+// server will refuse again in the same way.
+func isRetryable(err error) bool {
+	return !errors.Is(err, ErrInvalid) &&
+		!errors.Is(err, ErrUnauthorized) &&
+		!errors.Is(err, ErrForbidden) &&
+		!errors.Is(err, ErrNotFound)
+}
+
+// stream delivers batches until the stream breaks. Returns
+// true if any were received and the pause the server
+// asked for before reconnecting.
+func (c *Client) stream(
+	ctx context.Context,
+	roomName string,
+	lastEventID *string,
+	batches chan<- []watermillchat.Message,
+) (received bool, retry time.Duration, err error) {
+	r, err := c.request(ctx, http.MethodGet, roomPath(roomName, "stream"), nil)
+	if err != nil {
+		return false, 0, err
+	}
+	r.Header.Set("Accept", "text/event-stream")
+	if *lastEventID != "" {
+		r.Header.Set("Last-Event-ID", *lastEventID)
+	}
+	response, err := c.http.Do(r)
+	if err != nil {
+		return false, 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return false, 0, readError(response)
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(nil, mostEventBytes)
+	var (
+		event, id string
+		data      []byte
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if event == httpmux.APIStreamEventReset || event == httpmux.APIStreamEventMessages {
+				batch := []watermillchat.Message{}
+				if err = json.Unmarshal(data, &batch); err != nil {
+					return received, retry, err
+				}
+				select {
+				case <-ctx.Done():
+					return received, retry, ctx.Err()
+				case batches <- batch:
+					received = true
+				}
+				if id != "" {
+					*lastEventID = id
+				}
+			}
+			event, id, data = "", "", data[:0]
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "": // comment, like a heartbeat
+		case "event":
+			event = value
+		case "id":
+			id = value
+		case "data":
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, value...)
+		case "retry":
+			if milliseconds, err := strconv.Atoi(value); err == nil {
+				retry = time.Duration(milliseconds) * time.Millisecond
+			}
+		}
+	}
+	if err = scanner.Err(); err == nil {
+		err = io.ErrUnexpectedEOF // streams do not end
+	}
+	return received, retry, err
+}
@@ -0,0 +1,171 @@
+package watermillchat
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock tells time to [Chat] and its rooms. It can be
+// replaced by [FakeClock] to control the passage of time in tests.
+type Clock interface {
+	Now() time.Time
+	After(time.Duration) <-chan time.Time
+	NewTicker(time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals, like [time.Ticker].
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock follows the wall clock.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (SystemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// FakeClock stands still until it is advanced.
+// Timers and tickers fire only during [FakeClock.Advance].
+type FakeClock struct {
+	now     time.Time
+	waiters []*fakeWaiter
+	changed chan struct{}
+	mu      sync.Mutex
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	period   time.Duration // zero for one-shot timers
+	c        chan time.Time
+	clock    *FakeClock
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:     now,
+		changed: make(chan struct{}),
+	}
+}
+
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &fakeWaiter{deadline: f.now.Add(d), c: make(chan time.Time, 1), clock: f}
+	if d <= 0 {
+		w.c <- f.now
+		return w.c
+	}
+	f.add(w)
+	return w.c
+}
+
+func (f *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for fake ticker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &fakeWaiter{deadline: f.now.Add(d), period: d, c: make(chan time.Time, 1), clock: f}
+	f.add(w)
+	return w
+}
+
+// add must be called while holding the lock.
+func (f *FakeClock) add(w *fakeWaiter) {
+	f.waiters = append(f.waiters, w)
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// Advance moves the clock forward and fires every timer
+// and ticker that comes due. Like [time.Ticker], fake tickers
+// drop ticks that the receiver is not ready for.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.deadline.After(f.now) {
+			pending = append(pending, w)
+			continue
+		}
+		select {
+		case w.c <- f.now:
+		default:
+		}
+		if w.period > 0 {
+			for !w.deadline.After(f.now) {
+				w.deadline = w.deadline.Add(w.period)
+			}
+			pending = append(pending, w)
+		}
+	}
+	f.waiters = pending
+}
+
+// BlockUntil waits until at least n timers and tickers are
+// waiting on the clock, which means that the goroutines that
+// use them got to the point of waiting.
+func (f *FakeClock) BlockUntil(ctx context.Context, n int) error {
+	for {
+		f.mu.Lock()
+		count, changed := len(f.waiters), f.changed
+		f.mu.Unlock()
+		if count >= n {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *fakeWaiter) Stop() {
+	f := w.clock
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, existing := range f.waiters {
+		if existing == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// Clock returns the [Clock] configured for the chat, so that
+// integrations can keep time the same way.
+func (c *Chat) Clock() Clock {
+	return c.clock
+}
@@ -0,0 +1,130 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+var ErrChatClosed = errors.New("chat is closed")
+
+// Closing is closed when [Chat.Close] begins. Subscribers
+// can use it to ask their clients to reconnect elsewhere.
+func (c *Chat) Closing() <-chan struct{} {
+	return c.closing.Done()
+}
+
+// Close stops accepting broadcasts, waits until history
+// acknowledges every message published by this chat, ends
+// subscriptions, and waits for background goroutines.
+// Returns context error, if the deadline comes first.
+func (c *Chat) Close(ctx context.Context) (err error) {
+	c.closeMu.Lock()
+	if c.closed {
+		c.closeMu.Unlock()
+		return ErrChatClosed
+	}
+	c.closed = true
+	c.markClosing()
+	c.closeMu.Unlock()
+
+	if waitErr := wait(ctx, &c.historyPending); waitErr != nil {
+		err = fmt.Errorf("unable to flush messages to history: %w", waitErr)
+	}
+	c.stop()
+	if waitErr := wait(ctx, &c.tasks); waitErr != nil {
+		err = errors.Join(err, fmt.Errorf("unable to stop background tasks: %w", waitErr))
+	}
+	return err
+}
+
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
+
+// goTask runs a background task that [Chat.Close] waits for.
+func (c *Chat) goTask(task func()) {
+	c.tasks.Add(1)
+	go func() {
+		defer c.tasks.Done()
+		task()
+	}()
+}
+
+// untilClosed derives a context that also ends when the chat is closing.
+func (c *Chat) untilClosed(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(c.closing, cancel)
+	context.AfterFunc(ctx, func() { stop() })
+	return ctx
+}
+
+// send publishes a Watermill message unless the chat is closed.
+// History is expected to acknowledge the message before the chat closes.
+func (c *Chat) send(m *message.Message) error {
+	c.closeMu.RLock()
+	defer c.closeMu.RUnlock()
+	if c.closed {
+		return ErrChatClosed
+	}
+
+	c.historyMu.Lock()
+	c.unflushed[m.UUID] = struct{}{}
+	c.historyMu.Unlock()
+	c.historyPending.Add(1)
+
+	if err := c.publisher.Publish(c.publisherTopic, m); err != nil {
+		c.flushed(m.UUID)
+		return err
+	}
+	return nil
+}
+
+// flushed marks a published message as acknowledged by history.
+func (c *Chat) flushed(id string) {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+	if _, ok := c.unflushed[id]; ok {
+		delete(c.unflushed, id)
+		c.historyPending.Done()
+	}
+}
+
+// trackHistory relays messages to [HistoryRepository] and
+// watches for acknowledgement of the ones published by this chat.
+func (c *Chat) trackHistory(ctx context.Context, in <-chan *message.Message) <-chan *message.Message {
+	out := make(chan *message.Message)
+	c.goTask(func() {
+		defer close(out)
+		for m := range in {
+			c.historyMu.Lock()
+			_, tracked := c.unflushed[m.UUID]
+			c.historyMu.Unlock()
+			if tracked {
+				go func(m *message.Message) {
+					select {
+					case <-ctx.Done():
+					case <-m.Nacked(): // delivered again later
+					case <-m.Acked():
+						c.flushed(m.UUID)
+					}
+				}(m)
+			}
+			out <- m
+		}
+	})
+	return out
+}
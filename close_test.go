@@ -0,0 +1,195 @@
+package watermillchat_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/dkotik/watermillchat"
+)
+
+// gatedHistoryRepository acknowledges messages once released.
+type gatedHistoryRepository struct {
+	release  chan struct{}
+	received atomic.Int64
+}
+
+func (r *gatedHistoryRepository) Listen(broadcasts <-chan *message.Message) {
+	for m := range broadcasts {
+		<-r.release
+		r.received.Add(1)
+		m.Ack()
+	}
+}
+
+func (r *gatedHistoryRepository) GetRoomMessages(ctx context.Context, roomName string) ([]watermillchat.Message, error) {
+	return nil, nil
+}
+
+func TestCloseFlushesHistory(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	history := &gatedHistoryRepository{release: make(chan struct{})}
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		History: watermillchat.HistoryConfiguration{Repository: history},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := chat.Subscribe(ctx, "testRoom")
+	for range 10 {
+		if err = chat.Broadcast(ctx, watermillchat.Broadcast{
+			RoomName: "testRoom",
+			Message:  watermillchat.Message{Content: "before closing"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	closed := make(chan error)
+	go func() { closed <- chat.Close(ctx) }()
+	select {
+	case <-chat.Closing():
+	case <-ctx.Done():
+		t.Fatal("chat did not begin closing")
+	}
+	if err = chat.Broadcast(ctx, watermillchat.Broadcast{
+		RoomName: "testRoom",
+		Message:  watermillchat.Message{Content: "after closing"},
+	}); !errors.Is(err, watermillchat.ErrChatClosed) {
+		t.Fatal("closing chat accepted a broadcast:", err)
+	}
+	select {
+	case err = <-closed:
+		t.Fatal("chat closed before history was flushed:", err)
+	default:
+	}
+
+	close(history.release)
+	if err = <-closed; err != nil {
+		t.Fatal(err)
+	}
+	if received := history.received.Load(); received != 10 {
+		t.Fatal("history was not flushed:", received)
+	}
+	for range messages {
+		// subscription ends with the chat
+	}
+	if err = chat.Close(ctx); !errors.Is(err, watermillchat.ErrChatClosed) {
+		t.Fatal("chat closed twice:", err)
+	}
+}
+
+func TestCloseDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	history := &gatedHistoryRepository{release: make(chan struct{})}
+	defer close(history.release)
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		History: watermillchat.HistoryConfiguration{Repository: history},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = chat.Broadcast(ctx, watermillchat.Broadcast{
+		RoomName: "testRoom",
+		Message:  watermillchat.Message{Content: "never stored"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline, stop := context.WithCancel(ctx)
+	stop()
+	if err = chat.Close(deadline); !errors.Is(err, context.Canceled) {
+		t.Fatal("unflushed history was not reported:", err)
+	}
+}
+
+func TestCloseFlushesEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	history := &gatedHistoryRepository{release: make(chan struct{})}
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		History: watermillchat.HistoryConfiguration{Repository: history},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := watermillchat.Identity{ID: "alice", Name: "Alice"}
+	aliceCtx := watermillchat.ContextWithIdentity(ctx, alice)
+	m, err := chat.Send(aliceCtx, watermillchat.Broadcast{
+		RoomName: "testRoom",
+		Message:  watermillchat.Message{Author: &alice, Content: "before closing"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// message must be retained before it can be edited
+	go func() { history.release <- struct{}{} }()
+	for batch := range chat.Subscribe(ctx, "testRoom") {
+		if len(batch) > 0 {
+			break
+		}
+	}
+
+	events := []struct {
+		Name    string
+		Publish func() error
+	}{
+		{Name: "notice", Publish: func() error {
+			return chat.Notify(ctx, "testRoom", alice.ID, watermillchat.Message{Content: "notice"})
+		}},
+		{Name: "typing", Publish: func() error {
+			return chat.Typing(aliceCtx, "testRoom", true)
+		}},
+		{Name: "reaction", Publish: func() error {
+			return chat.React(aliceCtx, "testRoom", m.ID, "👍")
+		}},
+		{Name: "edit", Publish: func() error {
+			return chat.Edit(aliceCtx, "testRoom", m.ID, "edited")
+		}},
+		{Name: "unpin", Publish: func() error {
+			return chat.Unpin(ctx, "testRoom", m.ID)
+		}},
+		{Name: "room metadata", Publish: func() error {
+			return chat.UpdateRoomMetadata(aliceCtx, watermillchat.RoomMetadata{Name: "testRoom", Title: "Test"})
+		}},
+	}
+	for _, event := range events {
+		if err = event.Publish(); err != nil {
+			t.Fatalf("%s was not published: %v", event.Name, err)
+		}
+	}
+
+	closed := make(chan error)
+	go func() { closed <- chat.Close(ctx) }()
+	select {
+	case <-chat.Closing():
+	case <-ctx.Done():
+		t.Fatal("chat did not begin closing")
+	}
+	for _, event := range events {
+		if err = event.Publish(); !errors.Is(err, watermillchat.ErrChatClosed) {
+			t.Fatalf("closing chat accepted %s: %v", event.Name, err)
+		}
+	}
+	select {
+	case err = <-closed:
+		t.Fatal("chat closed before events reached history:", err)
+	default:
+	}
+
+	close(history.release)
+	if err = <-closed; err != nil {
+		t.Fatal(err)
+	}
+	if received := history.received.Load(); received != int64(len(events))+1 {
+		t.Fatal("events were not flushed:", received)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/urfave/cli/v3"
+)
+
+func flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     "url",
+			Aliases:  []string{"u"},
+			Required: true,
+			Usage:    "address of a running chat server, like the one printed by wmcserver",
+		},
+		&cli.StringFlag{
+			Name:    "room",
+			Aliases: []string{"r"},
+			Usage:   "room to join right away",
+		},
+		&cli.StringFlag{
+			Name:  "id",
+			Usage: "identity for the demonstration server, which trusts it without a password",
+		},
+		&cli.StringFlag{
+			Name:    "name",
+			Aliases: []string{"n"},
+			Usage:   "display name for the demonstration server, defaults to identity",
+		},
+		&cli.StringFlag{
+			Name:  "token",
+			Usage: "bearer token for servers with real authentication, replaces identity and name",
+		},
+	}
+}
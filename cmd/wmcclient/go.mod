@@ -0,0 +1,29 @@
+module github.com/dkotik/watermillchat/cmd/wmcclient
+
+go 1.23.3
+
+require (
+	github.com/dkotik/watermillchat v0.0.7
+	github.com/urfave/cli/v3 v3.0.0-beta1
+)
+
+require (
+	github.com/ThreeDotsLabs/watermill v1.4.1 // indirect
+	github.com/a-h/templ v0.2.793 // indirect
+	github.com/delaneyj/gostar v0.8.0 // indirect
+	github.com/goccy/go-json v0.10.3 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/igrmk/treemap/v2 v2.0.1 // indirect
+	github.com/lithammer/shortuuid/v3 v3.0.7 // indirect
+	github.com/nicksnyder/go-i18n/v2 v2.4.1 // indirect
+	github.com/oklog/ulid v1.3.1 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/samber/lo v1.47.0 // indirect
+	github.com/starfederation/datastar v0.20.1 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	golang.org/x/exp v0.0.0-20241108190413-2d47ceb2692f // indirect
+	golang.org/x/net v0.31.0 // indirect
+	golang.org/x/text v0.20.0 // indirect
+)
+
+replace github.com/dkotik/watermillchat => ../..
@@ -0,0 +1,68 @@
+/*
+Wmcclient chats from a terminal with a running chat server.
+
+It talks to the versioned JSON API using the client package
+rather than to the routes of the browser interface: messages
+stream from the server sent event route of the API and are
+posted to the API, because the browser "send" route expects
+forms protected from cross-site request forgery.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/dkotik/watermillchat/client"
+	"github.com/urfave/cli/v3"
+)
+
+func main() {
+	err := (&cli.Command{
+		Name:  "wmcclient",
+		Usage: "chat from a terminal with a running chat server",
+		Action: func(ctx context.Context, c *cli.Command) error {
+			ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+
+			// stream warnings would interrupt typing
+			logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+				Level: slog.LevelError,
+			}))
+			s := &session{
+				id:    strings.TrimSpace(c.String("id")),
+				name:  strings.TrimSpace(c.String("name")),
+				token: strings.TrimSpace(c.String("token")),
+				out:   os.Stdout,
+			}
+			if s.token != "" && s.id != "" {
+				return errors.New("use either a token or an identity")
+			}
+			if s.name == "" {
+				s.name = s.id
+			}
+			s.connect = func(token string) (*client.Client, error) {
+				configuration := client.Configuration{
+					URL:    c.String("url"),
+					Logger: logger,
+				}
+				if token != "" {
+					configuration.Authenticate = client.BearerToken(token)
+				}
+				return client.New(configuration)
+			}
+			return s.run(ctx, os.Stdin, strings.TrimSpace(c.String("room")))
+		},
+		Flags: flags(),
+	}).Run(context.Background(), os.Args)
+
+	if err != nil {
+		slog.Error("chat client stopped", slog.Any("reason", err))
+		os.Exit(1)
+	}
+}
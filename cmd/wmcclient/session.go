@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/client"
+)
+
+const help = `Commands:
+  /rooms         list public rooms
+  /join <room>   leave the current room and enter another
+  /nick <name>   change display name
+  /quit          leave the chat
+Other commands, like /me or /topic, are run by the server.
+Anything else is sent to the current room.
+`
+
+// session is a person chatting from a terminal. Commands
+// and messages are read one line at a time, so that the
+// client also works over SSH and with piped input.
+type session struct {
+	id, name, token string
+	connect         func(token string) (*client.Client, error)
+	client          *client.Client
+
+	room  string
+	leave context.CancelFunc
+	left  chan struct{}
+
+	out io.Writer
+	mu  sync.Mutex // serializes printing
+}
+
+func (s *session) printf(format string, values ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = fmt.Fprintf(s.out, format, values...)
+}
+
+// bearerToken is empty for anonymous sessions, which
+// can only read. The demonstration server trusts
+// "identity:name" tokens without a password.
+func (s *session) bearerToken() string {
+	if s.token != "" || s.id == "" {
+		return s.token
+	}
+	return s.id + ":" + s.name
+}
+
+func (s *session) run(ctx context.Context, in io.Reader, room string) (err error) {
+	if s.client, err = s.connect(s.bearerToken()); err != nil {
+		return err
+	}
+	if err = s.listRooms(ctx); err != nil {
+		return err
+	}
+	defer s.part()
+	if room != "" {
+		s.join(ctx, room)
+	} else {
+		s.printf("Type /join <room> to enter a room or /help for commands.\n")
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			select {
+			case <-ctx.Done():
+				return
+			case lines <- scanner.Text():
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line, ok := <-lines:
+			if !ok {
+				return nil // end of input
+			}
+			quit, err := s.handle(ctx, strings.TrimSpace(line))
+			if err != nil {
+				var statusErr *client.Error
+				if errors.As(err, &statusErr) {
+					err = errors.New(statusErr.Message)
+				}
+				s.printf("! %s\n", err)
+			}
+			if quit {
+				return nil
+			}
+		}
+	}
+}
+
+func (s *session) handle(ctx context.Context, line string) (quit bool, err error) {
+	if line == "" {
+		return false, nil
+	}
+	command, argument, _ := strings.Cut(strings.TrimPrefix(line, "/"), " ")
+	if !strings.HasPrefix(line, "/") {
+		command = ""
+	}
+	argument = strings.TrimSpace(argument)
+	switch command {
+	case "quit", "exit":
+		return true, nil
+	case "help":
+		s.printf(help)
+		if s.room == "" {
+			return false, nil
+		}
+		return false, s.send(ctx, line) // server commands
+	case "rooms":
+		return false, s.listRooms(ctx)
+	case "join":
+		if argument == "" {
+			return false, errors.New("room name is required: /join <room>")
+		}
+		s.join(ctx, argument)
+		return false, nil
+	case "nick":
+		return false, s.nick(argument)
+	default:
+		return false, s.send(ctx, line)
+	}
+}
+
+// send broadcasts a message or a server command
+// to the current room. Own messages and private
+// command replies arrive with the stream.
+func (s *session) send(ctx context.Context, line string) (err error) {
+	if s.room == "" {
+		return errors.New("join a room first with /join <room>")
+	}
+	_, err = s.client.Broadcast(ctx, s.room, line)
+	return err
+}
+
+func (s *session) listRooms(ctx context.Context) error {
+	rooms, err := s.client.Rooms(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to list rooms: %w", err)
+	}
+	if len(rooms) == 0 {
+		s.printf("There are no public rooms yet.\n")
+		return nil
+	}
+	s.printf("Rooms:\n")
+	for _, room := range rooms {
+		s.printf("  %-20s %s\n", room.Name, room.Topic)
+	}
+	return nil
+}
+
+func (s *session) nick(name string) (err error) {
+	if s.token != "" {
+		return errors.New("display name is assigned by the server")
+	}
+	if s.id == "" {
+		return errors.New("display name requires an identity, restart with --id")
+	}
+	if name == "" {
+		return errors.New("display name is required: /nick <name>")
+	}
+	previous := s.name
+	s.name = name
+	if s.client, err = s.connect(s.bearerToken()); err != nil {
+		s.name = previous
+		return err
+	}
+	s.printf("You are now known as %s.\n", name)
+	return nil
+}
+
+// join streams messages of a room until another one is joined.
+func (s *session) join(ctx context.Context, room string) {
+	s.part()
+	ctx, s.leave = context.WithCancel(ctx)
+	s.left = make(chan struct{})
+	s.room = room
+	s.printf("Joined %s.\n", room)
+
+	subscription := s.client.Subscribe(ctx, room)
+	go func(left chan<- struct{}) {
+		defer close(left)
+		// messages come again after they are edited or
+		// after a stream that could not be resumed
+		updated := make(map[string]int64)
+		for batch := range subscription.C {
+			for _, m := range batch {
+				if last, ok := updated[m.ID]; ok && last >= m.UpdatedAt {
+					continue
+				}
+				updated[m.ID] = m.UpdatedAt
+				s.printMessage(m)
+			}
+		}
+		if err := subscription.Err(); ctx.Err() == nil {
+			s.printf("! left %s: %s\n", room, err)
+		}
+	}(s.left)
+}
+
+func (s *session) part() {
+	if s.leave != nil {
+		s.leave()
+		<-s.left
+		s.leave = nil
+	}
+}
+
+func (s *session) printMessage(m watermillchat.Message) {
+	at := time.Unix(m.CreatedAt, 0).Format(time.TimeOnly)
+	content := strings.ReplaceAll(m.Content, "\n", "\n    ")
+	if m.UpdatedAt > 0 {
+		content += " (edited)"
+	}
+	if m.Ephemeral {
+		s.printf("%s - %s (only you)\n", at, content)
+		return
+	}
+	if m.Author == nil {
+		s.printf("%s * %s\n", at, content)
+		return
+	}
+	if m.Action {
+		s.printf("%s * %s %s\n", at, m.Author.Name, content)
+		return
+	}
+	s.printf("%s <%s> %s\n", at, m.Author.Name, content)
+}
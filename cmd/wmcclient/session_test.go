@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/client"
+	"github.com/dkotik/watermillchat/httpmux"
+)
+
+func newSession(t *testing.T, url, id string) (*session, *bytes.Buffer) {
+	t.Helper()
+	out := &bytes.Buffer{}
+	s := &session{id: id, name: id, out: out}
+	s.connect = func(token string) (*client.Client, error) {
+		configuration := client.Configuration{
+			URL:            url,
+			ReconnectDelay: time.Millisecond * 20,
+		}
+		if token != "" {
+			configuration.Authenticate = client.BearerToken(token)
+		}
+		return client.New(configuration)
+	}
+	return s, out
+}
+
+// output is read under the lock taken by printing.
+func (s *session) output(out *bytes.Buffer) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return out.String()
+}
+
+func TestSessionCommands(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = chat.CreateRoom(ctx, watermillchat.RoomMetadata{Name: "lobby", Topic: "Say hello"}); err != nil {
+		t.Fatal(err)
+	}
+	mux, err := httpmux.New(httpmux.Configuration{
+		Chat:          chat,
+		Authenticator: httpmux.NaiveBearerHeaderAuthenticatorUnsafe,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s, out := newSession(t, server.URL, "")
+	in := strings.NewReader(strings.Join([]string{
+		"/join",
+		"/nick Alice",
+		"hello",
+		"/rooms",
+		"/quit",
+		"/join lobby",
+	}, "\n"))
+	if err = s.run(ctx, in, ""); err != nil {
+		t.Fatal(err)
+	}
+	printed := s.output(out)
+	for _, expected := range []string{
+		"! room name is required",
+		"! display name requires an identity",
+		"! join a room first",
+		"lobby                Say hello",
+	} {
+		if !strings.Contains(printed, expected) {
+			t.Fatalf("%q was not printed: %s", expected, printed)
+		}
+	}
+	if strings.Count(printed, "Rooms:") != 2 {
+		t.Fatal("rooms were not listed on start and by command:", printed)
+	}
+	if strings.Contains(printed, "Joined") {
+		t.Fatal("input after /quit was handled:", printed)
+	}
+}
+
+func TestSessionPrintsEditedMessagesOnce(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	message := watermillchat.Message{
+		ID:        "first",
+		Author:    &watermillchat.Identity{ID: "bob", Name: "Bob"},
+		Content:   "hello",
+		CreatedAt: 1,
+	}
+	edited := message
+	edited.Content = "hello, world"
+	edited.UpdatedAt = 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// retained messages come again after a stream that
+		// could not be resumed, followed by an edit
+		for i, batch := range [][]watermillchat.Message{
+			{message}, {message}, {edited}, {message},
+		} {
+			data, err := json.Marshal(batch)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			fmt.Fprintf(w, "event: %s\nid: %d\ndata: %s\n\n", httpmux.APIStreamEventMessages, i, data)
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	s, out := newSession(t, server.URL, "alice")
+	var err error
+	if s.client, err = s.connect(s.bearerToken()); err != nil {
+		t.Fatal(err)
+	}
+	s.join(ctx, "lobby")
+	for !strings.Contains(s.output(out), "(edited)") {
+		select {
+		case <-ctx.Done():
+			t.Fatal("edited message was not printed:", s.output(out))
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	s.part()
+
+	printed := s.output(out)
+	if count := strings.Count(printed, "<Bob> hello\n"); count != 1 {
+		t.Fatal("repeated message was printed again:", count, printed)
+	}
+	if count := strings.Count(printed, "<Bob> hello, world (edited)"); count != 1 {
+		t.Fatal("edited message was not printed once:", count, printed)
+	}
+}
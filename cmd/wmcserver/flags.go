@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/urfave/cli/v3"
 )
 
@@ -18,5 +20,23 @@ func flags() []cli.Flag {
 			Value:   "",
 			Usage:   "save chat messages to SQLite disk file",
 		},
+		&cli.StringFlag{
+			Name:  "attachments-directory",
+			Value: "",
+			Usage: "accept file attachments and keep them in a directory",
+		},
+		&cli.BoolFlag{
+			Name:  "link-previews",
+			Usage: "fetch previews of linked pages",
+		},
+		&cli.BoolFlag{
+			Name:  "metrics",
+			Usage: "publish open stream counters at /debug/vars",
+		},
+		&cli.DurationFlag{
+			Name:  "grace",
+			Value: time.Second * 10,
+			Usage: "how long to wait for messages and connections to drain on shut down",
+		},
 	}
 }
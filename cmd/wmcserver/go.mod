@@ -3,8 +3,8 @@ module main
 go 1.23.3
 
 require (
-	github.com/dkotik/watermillchat v0.0.6
-	github.com/dkotik/watermillchat/history/sqlitehistory v0.0.5
+	github.com/dkotik/watermillchat v0.0.7
+	github.com/dkotik/watermillchat/history/sqlitehistory v0.0.6
 	github.com/urfave/cli/v3 v3.0.0-beta1
 )
 
@@ -27,6 +27,7 @@ require (
 	github.com/starfederation/datastar v0.20.1 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	golang.org/x/exp v0.0.0-20241108190413-2d47ceb2692f // indirect
+	golang.org/x/net v0.31.0 // indirect
 	golang.org/x/sys v0.27.0 // indirect
 	golang.org/x/text v0.20.0 // indirect
 	modernc.org/libc v1.61.2 // indirect
@@ -35,3 +36,8 @@ require (
 	modernc.org/sqlite v1.34.1 // indirect
 	zombiezen.com/go/sqlite v1.4.0 // indirect
 )
+
+replace (
+	github.com/dkotik/watermillchat => ../..
+	github.com/dkotik/watermillchat/history/sqlitehistory => ../../history/sqlitehistory
+)
@@ -2,8 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"fmt"
-	"log"
 	"log/slog"
 	"net"
 	"net/http"
@@ -12,22 +13,37 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/blob/localblob"
 	"github.com/dkotik/watermillchat/history/sqlitehistory"
 	"github.com/dkotik/watermillchat/httpmux"
 	"github.com/dkotik/watermillchat/ollama"
+	"github.com/dkotik/watermillchat/unfurl"
 	"github.com/urfave/cli/v3"
 )
 
-func serve(ctx context.Context, address string, chat *watermillchat.Chat) error {
+func serve(ctx context.Context, address string, grace time.Duration, metrics bool, chat *watermillchat.Chat, blobs watermillchat.BlobStore) error {
+	streams, err := httpmux.NewStreams(httpmux.StreamConfiguration{})
+	if err != nil {
+		return err
+	}
 	mux, err := httpmux.New(httpmux.Configuration{
 		Chat:          chat,
 		Authenticator: httpmux.NaiveBearerHeaderAuthenticatorUnsafe,
+		BlobStore:     blobs,
+		Streams:       streams,
 	})
 	if err != nil {
 		return err
 	}
+	if metrics {
+		expvar.Publish("streams", expvar.Func(func() any {
+			return streams.Metrics()
+		}))
+		mux.Handle("GET /debug/vars", expvar.Handler())
+	}
 
 	listener, err := net.Listen("tcp", address)
 	if err != nil {
@@ -37,18 +53,44 @@ func serve(ctx context.Context, address string, chat *watermillchat.Chat) error
 
 	fmt.Printf("Launching chat server at: http://%s:%d/\n", at.IP, at.Port)
 
+	server := &http.Server{Handler: mux}
+	shutdown := make(chan error, 1)
 	go func() {
-		// TODO: there is no grace timeout - use the version in oakmux
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-		<-sigChan
-
-		if err := listener.Close(); err != nil {
-			log.Fatalf("HTTP close error: %v", err)
+		select {
+		case <-sigChan:
+		case <-ctx.Done():
 		}
+
+		// chat goes first to ask live streams to reconnect,
+		// otherwise server shut down waits for them to end
+		ctx, cancel := context.WithTimeout(context.Background(), grace)
+		defer cancel()
+		shutdown <- errors.Join(chat.Close(ctx), server.Shutdown(ctx))
 	}()
 
-	return http.Serve(listener, mux)
+	if err = server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-shutdown
+}
+
+// pruneAttachments removes uploads that were never attached
+// to a message by the time the message would have expired.
+func pruneAttachments(ctx context.Context, blobs *localblob.Store, attached func(context.Context, string) (bool, error)) {
+	tick := time.NewTicker(watermillchat.DefaultHistoryCleanupFrequency)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-tick.C:
+			if err := blobs.Prune(ctx, t.Add(-watermillchat.DefaultHistoryRetention), attached); err != nil {
+				slog.Error("failed to prune attachments", slog.Any("error", err))
+			}
+		}
+	}
 }
 
 func main() {
@@ -56,7 +98,21 @@ func main() {
 		Name:  "wmcserver",
 		Usage: "run a live text chat server demonstration",
 		Action: func(ctx context.Context, c *cli.Command) (err error) {
+			// history file closes after the chat is done with it
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
 			configuration := watermillchat.Configuration{}
+			var blobs watermillchat.BlobStore
+			var localBlobs *localblob.Store
+			if directory := strings.TrimSpace(c.String("attachments-directory")); directory != "" {
+				if localBlobs, err = localblob.New(directory); err != nil {
+					return fmt.Errorf("unable to set up attachments directory: %w", err)
+				}
+				blobs = localBlobs
+			}
+			// without history, uploads expire with the retention window
+			var attached func(context.Context, string) (bool, error)
 			historyFile := strings.TrimSpace(c.String("history-file"))
 			if strings.HasPrefix(historyFile, "temp://") && len(historyFile) > len("temp://") {
 				historyFile = filepath.Join(
@@ -68,21 +124,38 @@ func main() {
 				history, err := sqlitehistory.NewUsingFile(
 					historyFile,
 					sqlitehistory.RepositoryParameters{
-						Context: ctx,
+						Context:   ctx,
+						BlobStore: blobs,
 					},
 				)
 				if err != nil {
 					return fmt.Errorf("unable to set up history file: %w", err)
 				}
 				configuration.History.Repository = history
+				configuration.Directory = history
+				configuration.Schedule.Store = history
+				attached = history.HasAttachment
+			}
+			if localBlobs != nil {
+				go pruneAttachments(ctx, localBlobs, attached)
+			}
+			if c.Bool("link-previews") {
+				if configuration.Previews.Previewer, err = unfurl.New(unfurl.Configuration{}); err != nil {
+					return err
+				}
 			}
 			chat, err := watermillchat.New(ctx, configuration)
 			if err != nil {
 				return err
 			}
-			bot := ollama.New("", "")
-			go bot.JoinChat(ctx, chat, "Ollama", "ollama")
-			return serve(ctx, c.String("address"), chat)
+			bot, err := ollama.New(ollama.Configuration{})
+			if err != nil {
+				return err
+			}
+			if err = bot.JoinChat(ctx, chat, "Ollama", "ollama"); err != nil {
+				return err
+			}
+			return serve(ctx, c.String("address"), c.Duration("grace"), c.Bool("metrics"), chat, blobs)
 		},
 		Flags: flags(),
 	}).Run(context.Background(), os.Args)
@@ -0,0 +1,324 @@
+package watermillchat
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// CommandPrefix starts a message that runs a [Command].
+// Doubling it sends the message as is without one prefix.
+const CommandPrefix = "/"
+
+var (
+	ErrUnknownCommand      = errors.New("unknown command")
+	ErrCommandNotPermitted = errors.New("command is not permitted")
+	ErrCommandExists       = errors.New("command is already registered")
+)
+
+// Command runs instead of publishing a message that starts
+// with [CommandPrefix] followed by its name, like "/topic".
+type Command struct {
+	// Name is matched without the prefix and is case insensitive.
+	Name string
+
+	// Usage shows the arguments, like "<topic>".
+	Usage string
+
+	// Description is a single line for the help text.
+	Description string
+
+	// Permit runs after [CommandConfiguration.Permit].
+	// Nil permits everyone.
+	Permit CommandPermission
+
+	Run func(context.Context, CommandRequest) error
+}
+
+func (c Command) Validate() (err error) {
+	if c.Name == "" {
+		err = errors.Join(err, errors.New("command name is required"))
+	} else if strings.ContainsFunc(c.Name, unicode.IsSpace) {
+		err = errors.Join(err, errors.New("command name contains spaces"))
+	}
+	if c.Run == nil {
+		err = errors.Join(err, errors.New("missing command handler"))
+	}
+	return err
+}
+
+// CommandPermission returns an error, usually wrapping
+// [ErrCommandNotPermitted], to stop a command from running.
+type CommandPermission func(context.Context, CommandRequest) error
+
+// CommandRequest is a message that matched a [Command].
+// The context given to the command carries the author
+// [Identity], so room changes are attributed to them.
+type CommandRequest struct {
+	Chat      *Chat
+	Name      string
+	Arguments string
+	RoomName  string
+	Author    Identity
+}
+
+// Reply sends a system message that only the author sees.
+func (r CommandRequest) Reply(ctx context.Context, content string) error {
+	return r.Chat.Notify(ctx, r.RoomName, r.Author.ID, Message{Content: content})
+}
+
+// Announce sends a system message to everyone in the room.
+func (r CommandRequest) Announce(ctx context.Context, content string) error {
+	return r.Chat.Broadcast(ctx, Broadcast{
+		Message:  Message{Content: content},
+		RoomName: r.RoomName,
+	})
+}
+
+type CommandConfiguration struct {
+	// Commands are added to or replace the built-in
+	// /help, /me, /topic, /pin, /kick, and /unkick commands.
+	Commands []Command
+
+	// Permit runs before every command. Nil permits everyone.
+	Permit CommandPermission
+}
+
+func (c CommandConfiguration) Validate() (err error) {
+	for i, command := range c.Commands {
+		if commandErr := command.Validate(); commandErr != nil {
+			err = errors.Join(err, fmt.Errorf("command #%d: %w", i+1, commandErr))
+		}
+	}
+	return err
+}
+
+// PermitRoomCreator allows only the creator of a room. Rooms
+// without a creator, like those that were never described, cannot
+// be moderated by commands, because otherwise the first participant
+// to use one would take the room over.
+func PermitRoomCreator(ctx context.Context, r CommandRequest) error {
+	m, err := r.Chat.RoomMetadata(ctx, r.RoomName)
+	if err != nil {
+		return err
+	}
+	if m.Creator == nil {
+		return fmt.Errorf("%w: room has no creator to use /%s", ErrCommandNotPermitted, r.Name)
+	}
+	if m.Creator.ID != r.Author.ID {
+		return fmt.Errorf("%w: only the room creator can use /%s", ErrCommandNotPermitted, r.Name)
+	}
+	return nil
+}
+
+// RegisterCommand adds a command to the registry.
+func (c *Chat) RegisterCommand(command Command) error {
+	if err := command.Validate(); err != nil {
+		return fmt.Errorf("invalid command: %w", err)
+	}
+	name := strings.ToLower(command.Name)
+	c.commandsMu.Lock()
+	defer c.commandsMu.Unlock()
+	if _, ok := c.commands[name]; ok {
+		return fmt.Errorf("%w: /%s", ErrCommandExists, name)
+	}
+	c.commands[name] = command
+	return nil
+}
+
+// Commands lists registered commands sorted by name.
+func (c *Chat) Commands() (list []Command) {
+	c.commandsMu.RLock()
+	defer c.commandsMu.RUnlock()
+	list = make([]Command, 0, len(c.commands))
+	for _, command := range c.commands {
+		list = append(list, command)
+	}
+	slices.SortFunc(list, func(a, b Command) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return list
+}
+
+// command matches message content against registered commands.
+// Returns false for regular messages and unescapes the doubled prefix.
+func (c *Chat) command(b *Broadcast) (r CommandRequest, ok bool) {
+	if b.Author == nil || !strings.HasPrefix(b.Content, CommandPrefix) {
+		return r, false
+	}
+	if strings.HasPrefix(b.Content, CommandPrefix+CommandPrefix) {
+		b.Content = b.Content[len(CommandPrefix):]
+		return r, false
+	}
+	name, arguments, _ := strings.Cut(b.Content[len(CommandPrefix):], " ")
+	return CommandRequest{
+		Chat:      c,
+		Name:      strings.ToLower(name),
+		Arguments: strings.TrimSpace(arguments),
+		RoomName:  b.RoomName,
+		Author:    *b.Author,
+	}, true
+}
+
+func (c *Chat) runCommand(ctx context.Context, r CommandRequest) error {
+	c.commandsMu.RLock()
+	command, ok := c.commands[r.Name]
+	c.commandsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: /%s", ErrUnknownCommand, r.Name)
+	}
+	ctx = ContextWithIdentity(ctx, r.Author)
+	if c.commandPermission != nil {
+		if err := c.commandPermission(ctx, r); err != nil {
+			return err
+		}
+	}
+	if command.Permit != nil {
+		if err := command.Permit(ctx, r); err != nil {
+			return err
+		}
+	}
+	return command.Run(ctx, r)
+}
+
+func builtInCommands() []Command {
+	return []Command{
+		{
+			Name:        "help",
+			Description: "lists available commands",
+			Run: func(ctx context.Context, r CommandRequest) error {
+				b := &strings.Builder{}
+				b.WriteString("Commands:")
+				for _, command := range r.Chat.Commands() {
+					b.WriteString("\n" + CommandPrefix + command.Name)
+					if command.Usage != "" {
+						b.WriteString(" " + command.Usage)
+					}
+					if command.Description != "" {
+						b.WriteString(" - " + command.Description)
+					}
+				}
+				return r.Reply(ctx, b.String())
+			},
+		},
+		{
+			Name:        "me",
+			Usage:       "<action>",
+			Description: "describes what you are doing",
+			Run: func(ctx context.Context, r CommandRequest) error {
+				if r.Arguments == "" {
+					return r.Reply(ctx, "Usage: /me <action>")
+				}
+				// published under the author, so that it cannot be forged;
+				// the command already counted against the author rate limit
+				now := r.Chat.clock.Now()
+				_, err := r.Chat.sendToRoom(ctx, Broadcast{
+					Message: Message{
+						ID:        watermill.NewUUID(),
+						Author:    &r.Author,
+						Content:   r.Arguments,
+						CreatedAt: now.Unix(),
+						Action:    true,
+					},
+					RoomName: r.RoomName,
+				}, now)
+				return err
+			},
+		},
+		{
+			Name:        "topic",
+			Usage:       "<topic>",
+			Description: "changes the room topic",
+			Permit:      PermitRoomCreator,
+			Run: func(ctx context.Context, r CommandRequest) error {
+				m, err := r.Chat.RoomMetadata(ctx, r.RoomName)
+				if err != nil {
+					return err
+				}
+				m.Topic = r.Arguments
+				if err = r.Chat.UpdateRoomMetadata(ctx, m); err != nil {
+					return err
+				}
+				if m.Topic == "" {
+					return r.Announce(ctx, r.Author.Name+" cleared the topic")
+				}
+				return r.Announce(ctx, r.Author.Name+" changed the topic to: "+m.Topic)
+			},
+		},
+		{
+			Name:        "pin",
+			Usage:       "[message ID]",
+			Description: "pins a message, the latest one by default",
+			Permit:      PermitRoomCreator,
+			Run: func(ctx context.Context, r CommandRequest) error {
+				messageID := r.Arguments
+				if messageID == "" {
+					room, err := r.Chat.room(ctx, r.RoomName)
+					if err != nil {
+						return err
+					}
+					room.mu.Lock()
+					if len(room.messages) > 0 {
+						messageID = room.messages[len(room.messages)-1].ID
+					}
+					room.mu.Unlock()
+				}
+				if err := r.Chat.Pin(ctx, r.RoomName, messageID); err != nil {
+					return err
+				}
+				return r.Reply(ctx, "Message is pinned.")
+			},
+		},
+		{
+			Name:        "kick",
+			Usage:       "<name>",
+			Description: "stops someone from sending messages to the room",
+			Permit:      PermitRoomCreator,
+			Run: func(ctx context.Context, r CommandRequest) error {
+				if r.Arguments == "" {
+					return r.Reply(ctx, "Usage: /kick <name>")
+				}
+				member, err := r.Chat.roomMember(ctx, r.RoomName, r.Arguments)
+				if errors.Is(err, ErrMemberNotFound) {
+					return r.Reply(ctx, "Nobody called "+r.Arguments+" has spoken in this room.")
+				} else if err != nil {
+					return err
+				}
+				if member.ID == r.Author.ID {
+					return r.Reply(ctx, "You cannot kick yourself.")
+				}
+				if err = r.Chat.Kick(ctx, r.RoomName, member.ID); err != nil {
+					return err
+				}
+				return r.Announce(ctx, r.Author.Name+" kicked "+member.Name+" out of the room")
+			},
+		},
+		{
+			Name:        "unkick",
+			Usage:       "<name>",
+			Description: "allows someone kicked to send messages again",
+			Permit:      PermitRoomCreator,
+			Run: func(ctx context.Context, r CommandRequest) error {
+				if r.Arguments == "" {
+					return r.Reply(ctx, "Usage: /unkick <name>")
+				}
+				member, err := r.Chat.roomMember(ctx, r.RoomName, r.Arguments)
+				if errors.Is(err, ErrMemberNotFound) {
+					return r.Reply(ctx, "Nobody called "+r.Arguments+" has spoken in this room.")
+				} else if err != nil {
+					return err
+				}
+				if err = r.Chat.Unkick(ctx, r.RoomName, member.ID); err != nil {
+					return err
+				}
+				return r.Announce(ctx, r.Author.Name+" let "+member.Name+" back into the room")
+			},
+		},
+	}
+}
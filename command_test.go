@@ -0,0 +1,203 @@
+package watermillchat_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+)
+
+// messageReader takes messages one at a time out of batches.
+type messageReader struct {
+	batches <-chan []watermillchat.Message
+	pending []watermillchat.Message
+}
+
+func (r *messageReader) next(t *testing.T, ctx context.Context) watermillchat.Message {
+	t.Helper()
+	for len(r.pending) == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("message was not delivered")
+		case r.pending = <-r.batches:
+		}
+	}
+	m := r.pending[0]
+	r.pending = r.pending[1:]
+	return m
+}
+
+func TestCommands(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	alice := watermillchat.Identity{ID: "alice", Name: "Alice"}
+	bob := watermillchat.Identity{ID: "bob", Name: "Bob"}
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		Commands: watermillchat.CommandConfiguration{
+			Commands: []watermillchat.Command{{
+				Name:        "echo",
+				Usage:       "<text>",
+				Description: "repeats text privately",
+				Run: func(ctx context.Context, r watermillchat.CommandRequest) error {
+					return r.Reply(ctx, r.Arguments)
+				},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceCtx := watermillchat.ContextWithIdentity(ctx, alice)
+	if err = chat.CreateRoom(aliceCtx, watermillchat.RoomMetadata{Name: "testRoom"}); err != nil {
+		t.Fatal(err)
+	}
+	aliceMessages := &messageReader{batches: chat.Subscribe(aliceCtx, "testRoom")}
+	bobMessages := &messageReader{batches: chat.Subscribe(
+		watermillchat.ContextWithIdentity(ctx, bob), "testRoom")}
+
+	send := func(author watermillchat.Identity, content string) error {
+		m, err := chat.Send(ctx, watermillchat.Broadcast{
+			RoomName: "testRoom",
+			Message:  watermillchat.Message{Author: &author, Content: content},
+		})
+		if err == nil && strings.HasPrefix(content, "/") && !strings.HasPrefix(content, "//") && m.ID != "" {
+			t.Fatalf("command %q was published: %+v", content, m)
+		}
+		return err
+	}
+
+	if err = send(alice, "/HELP"); err != nil {
+		t.Fatal(err)
+	}
+	help := aliceMessages.next(t, ctx)
+	if !help.Ephemeral || help.Author != nil || !strings.Contains(help.Content, "/echo <text> - repeats text privately") {
+		t.Fatalf("unexpected help reply: %+v", help)
+	}
+
+	if err = send(bob, "/nope"); !errors.Is(err, watermillchat.ErrUnknownCommand) {
+		t.Fatal("unknown command was accepted:", err)
+	}
+	if err = send(bob, "/topic hijacked"); !errors.Is(err, watermillchat.ErrCommandNotPermitted) {
+		t.Fatal("topic was changed by someone else than the creator:", err)
+	}
+	if err = send(bob, "/echo secret"); err != nil {
+		t.Fatal(err)
+	}
+	if reply := bobMessages.next(t, ctx); !reply.Ephemeral || reply.Content != "secret" {
+		t.Fatalf("unexpected private reply: %+v", reply)
+	}
+
+	if err = send(alice, "/topic Testing"); err != nil {
+		t.Fatal(err)
+	}
+	for _, messages := range []*messageReader{aliceMessages, bobMessages} {
+		// private replies did not reach anyone else
+		if m := messages.next(t, ctx); m.Ephemeral || m.Content != "Alice changed the topic to: Testing" {
+			t.Fatalf("unexpected announcement: %+v", m)
+		}
+	}
+	if m, err := chat.RoomMetadata(ctx, "testRoom"); err != nil {
+		t.Fatal(err)
+	} else if m.Topic != "Testing" {
+		t.Fatal("topic was not changed:", m.Topic)
+	}
+
+	if err = send(bob, "/me waves"); err != nil {
+		t.Fatal(err)
+	}
+	for _, messages := range []*messageReader{aliceMessages, bobMessages} {
+		if m := messages.next(t, ctx); !m.Action || m.Author == nil || m.Author.ID != "bob" || m.Content != "waves" {
+			t.Fatalf("action was not published under its author: %+v", m)
+		}
+	}
+
+	if err = send(bob, "//path is not a command"); err != nil {
+		t.Fatal(err)
+	}
+	if m := bobMessages.next(t, ctx); m.Author == nil || m.Content != "/path is not a command" {
+		t.Fatalf("escaped message was not published: %+v", m)
+	}
+
+	if err = chat.RegisterCommand(watermillchat.Command{
+		Name: "ECHO",
+		Run:  func(context.Context, watermillchat.CommandRequest) error { return nil },
+	}); !errors.Is(err, watermillchat.ErrCommandExists) {
+		t.Fatal("command was registered twice:", err)
+	}
+}
+
+func TestKickCommand(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	alice := watermillchat.Identity{ID: "alice", Name: "Alice"}
+	bob := watermillchat.Identity{ID: "bob", Name: "Bob Smith"}
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceCtx := watermillchat.ContextWithIdentity(ctx, alice)
+	if err = chat.CreateRoom(aliceCtx, watermillchat.RoomMetadata{Name: "testRoom"}); err != nil {
+		t.Fatal(err)
+	}
+	messages := &messageReader{batches: chat.Subscribe(aliceCtx, "testRoom")}
+	send := func(author watermillchat.Identity, content string) error {
+		return chat.Broadcast(ctx, watermillchat.Broadcast{
+			RoomName: "testRoom",
+			Message:  watermillchat.Message{Author: &author, Content: content},
+		})
+	}
+
+	if err = send(bob, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	messages.next(t, ctx)
+	if err = send(bob, "/kick Alice"); !errors.Is(err, watermillchat.ErrCommandNotPermitted) {
+		t.Fatal("someone else than the creator kicked:", err)
+	}
+	if err = send(alice, "/kick @bobsmith"); err != nil {
+		t.Fatal(err)
+	}
+	if m := messages.next(t, ctx); m.Content != "Alice kicked Bob Smith out of the room" {
+		t.Fatalf("unexpected announcement: %+v", m)
+	}
+	if err = send(bob, "still here?"); !errors.Is(err, watermillchat.ErrKicked) {
+		t.Fatal("kicked identity sent a message:", err)
+	}
+	if m, err := chat.RoomMetadata(ctx, "testRoom"); err != nil {
+		t.Fatal(err)
+	} else if m.Creator == nil || m.Creator.ID != alice.ID {
+		t.Fatal("kick changed the room creator:", m.Creator)
+	}
+
+	// nobody can take over a room that was never described
+	if err = chat.Broadcast(ctx, watermillchat.Broadcast{
+		RoomName: "undescribed",
+		Message:  watermillchat.Message{Author: &alice, Content: "hello"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = chat.Broadcast(ctx, watermillchat.Broadcast{
+		RoomName: "undescribed",
+		Message:  watermillchat.Message{Author: &bob, Content: "/kick Alice"},
+	}); !errors.Is(err, watermillchat.ErrCommandNotPermitted) {
+		t.Fatal("room without a creator was moderated:", err)
+	}
+	if m, err := chat.RoomMetadata(ctx, "undescribed"); err != nil || m.Creator != nil || len(m.Kicked) != 0 {
+		t.Fatal("room without a creator was taken over:", m, err)
+	}
+
+	if err = send(alice, "/unkick bob"); err != nil {
+		t.Fatal(err)
+	}
+	if m := messages.next(t, ctx); m.Content != "Alice let Bob Smith back into the room" {
+		t.Fatalf("unexpected announcement: %+v", m)
+	}
+	if err = send(bob, "back"); err != nil {
+		t.Fatal("identity was not let back:", err)
+	}
+}
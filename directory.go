@@ -0,0 +1,247 @@
+package watermillchat
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MostRunesPerRoomName        = 64
+	MostRunesPerRoomTitle       = 80
+	MostRunesPerRoomTopic       = 200
+	MostRunesPerRoomDescription = 2000
+)
+
+var ErrRoomNotFound = errors.New("room not found")
+
+// RoomMetadata describes a room for people. Rooms without
+// metadata are displayed using their name.
+type RoomMetadata struct {
+	Name        string
+	Title       string
+	Topic       string
+	Description string
+	Creator     *Identity `json:",omitempty"`
+	CreatedAt   int64
+	UpdatedAt   int64
+
+	// Kicked are IDs of identities that can no longer
+	// send messages to the room. See [Chat.Kick].
+	Kicked []string `json:",omitempty"`
+}
+
+// DisplayTitle falls back on room name when title is empty.
+func (m RoomMetadata) DisplayTitle() string {
+	if m.Title == "" {
+		return m.Name
+	}
+	return m.Title
+}
+
+func (m RoomMetadata) Validate() (err error) {
+	if strings.TrimSpace(m.Name) == "" {
+		err = errors.Join(err, errors.New("room name is required"))
+	} else if strings.ContainsFunc(m.Name, func(r rune) bool {
+		return r == '/' || unicode.IsControl(r)
+	}) {
+		err = errors.Join(err, errors.New("room name contains forbidden characters"))
+	}
+	if count := utf8.RuneCountInString(m.Name); count > MostRunesPerRoomName {
+		err = errors.Join(err, &ContentTooLargeError{Unit: "runes", Limit: MostRunesPerRoomName, Actual: count})
+	}
+	if count := utf8.RuneCountInString(m.Title); count > MostRunesPerRoomTitle {
+		err = errors.Join(err, &ContentTooLargeError{Unit: "runes", Limit: MostRunesPerRoomTitle, Actual: count})
+	}
+	if count := utf8.RuneCountInString(m.Topic); count > MostRunesPerRoomTopic {
+		err = errors.Join(err, &ContentTooLargeError{Unit: "runes", Limit: MostRunesPerRoomTopic, Actual: count})
+	}
+	if count := utf8.RuneCountInString(m.Description); count > MostRunesPerRoomDescription {
+		err = errors.Join(err, &ContentTooLargeError{Unit: "runes", Limit: MostRunesPerRoomDescription, Actual: count})
+	}
+	return err
+}
+
+// RoomDirectory keeps [RoomMetadata] by room name. It is
+// updated by [Chat] when [RoomMetadataEvent]s arrive.
+type RoomDirectory interface {
+	// GetRoomMetadata returns [ErrRoomNotFound]
+	// for rooms without metadata.
+	GetRoomMetadata(ctx context.Context, roomName string) (RoomMetadata, error)
+	SetRoomMetadata(context.Context, RoomMetadata) error
+	// CreateRoomMetadata stores metadata of a room that has none
+	// or returns [ErrRoomExists] without changing anything.
+	CreateRoomMetadata(context.Context, RoomMetadata) error
+	// ListRoomMetadata returns metadata of every room sorted by name.
+	ListRoomMetadata(context.Context) ([]RoomMetadata, error)
+}
+
+// RoomMetadataEvent replaces room metadata.
+// It is an [EventKindRoomMetadata] event.
+type RoomMetadataEvent struct {
+	RoomMetadata
+}
+
+type MemoryRoomDirectory struct {
+	rooms map[string]RoomMetadata
+	mu    sync.Mutex
+}
+
+func NewMemoryRoomDirectory() *MemoryRoomDirectory {
+	return &MemoryRoomDirectory{rooms: make(map[string]RoomMetadata)}
+}
+
+func (d *MemoryRoomDirectory) GetRoomMetadata(ctx context.Context, roomName string) (RoomMetadata, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	m, ok := d.rooms[roomName]
+	if !ok {
+		return RoomMetadata{Name: roomName}, ErrRoomNotFound
+	}
+	return m, nil
+}
+
+func (d *MemoryRoomDirectory) SetRoomMetadata(ctx context.Context, m RoomMetadata) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rooms[m.Name] = m
+	return nil
+}
+
+func (d *MemoryRoomDirectory) CreateRoomMetadata(ctx context.Context, m RoomMetadata) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.rooms[m.Name]; ok {
+		return ErrRoomExists
+	}
+	d.rooms[m.Name] = m
+	return nil
+}
+
+func (d *MemoryRoomDirectory) ListRoomMetadata(ctx context.Context) (list []RoomMetadata, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list = make([]RoomMetadata, 0, len(d.rooms))
+	for _, m := range d.rooms {
+		list = append(list, m)
+	}
+	slices.SortFunc(list, func(a, b RoomMetadata) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return list, nil
+}
+
+// RoomMetadata returns room description from [RoomDirectory]. Rooms
+// without metadata are described by their name alone.
+func (c *Chat) RoomMetadata(ctx context.Context, roomName string) (RoomMetadata, error) {
+	m, err := c.directory.GetRoomMetadata(ctx, roomName)
+	if errors.Is(err, ErrRoomNotFound) {
+		return RoomMetadata{Name: roomName}, nil
+	}
+	return m, err
+}
+
+// UpdateRoomMetadata publishes new title, topic, and description
+// of a room. The [Identity] in context becomes the creator of a room
+// that had no metadata. Callers are responsible for checking that
+// the identity is allowed to change the room.
+func (c *Chat) UpdateRoomMetadata(ctx context.Context, m RoomMetadata) (err error) {
+	if m, err = c.describeRoom(ctx, m); err != nil {
+		return err
+	}
+	return c.publishEvent(ctx, EventKindRoomMetadata, RoomMetadataEvent{RoomMetadata: m})
+}
+
+// describeRoom cleans and validates metadata and carries over
+// the creator and kicked identities of a room that was described before.
+func (c *Chat) describeRoom(ctx context.Context, m RoomMetadata) (RoomMetadata, error) {
+	m.Title = cleanRoomText(m.Title)
+	m.Topic = cleanRoomText(m.Topic)
+	m.Description = strings.TrimSpace(stripControlCharacters(m.Description))
+	if err := m.Validate(); err != nil {
+		return m, err
+	}
+
+	existing, err := c.directory.GetRoomMetadata(ctx, m.Name)
+	now := c.clock.Now().Unix()
+	switch {
+	case errors.Is(err, ErrRoomNotFound):
+		m.Creator = nil
+		if identity, ok := IdentityFromContext(ctx); ok {
+			m.Creator = &identity
+		}
+		m.CreatedAt = now
+	case err != nil:
+		return m, err
+	default:
+		m.Creator = existing.Creator
+		m.Kicked = existing.Kicked
+		m.CreatedAt = existing.CreatedAt
+	}
+	m.UpdatedAt = now
+	return m, nil
+}
+
+// SubscribeRoomMetadata delivers room metadata right away and
+// again after every change until the context is done.
+func (c *Chat) SubscribeRoomMetadata(ctx context.Context, roomName string) <-chan RoomMetadata {
+	ctx = c.untilClosed(ctx)
+	updates := make(chan RoomMetadata, 1)
+	m, err := c.RoomMetadata(ctx, roomName)
+	if err != nil {
+		c.logger.Warn("unable to load room metadata", slog.String("roomName", roomName), slog.Any("error", err))
+		m = RoomMetadata{Name: roomName}
+	}
+	updates <- m
+
+	c.mu.Lock()
+	c.metadataSubscribers[roomName] = append(c.metadataSubscribers[roomName], updates)
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.metadataSubscribers[roomName] = slices.DeleteFunc(
+			c.metadataSubscribers[roomName],
+			func(existing chan RoomMetadata) bool {
+				return existing == updates
+			},
+		)
+		if len(c.metadataSubscribers[roomName]) == 0 {
+			delete(c.metadataSubscribers, roomName)
+		}
+		close(updates)
+	}()
+	return updates
+}
+
+// receiveRoomMetadata stores and distributes a metadata change.
+func (c *Chat) receiveRoomMetadata(ctx context.Context, m RoomMetadata) error {
+	if err := c.directory.SetRoomMetadata(ctx, m); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, subscriber := range c.metadataSubscribers[m.Name] {
+		select {
+		case <-subscriber: // replace the version not yet received
+		default:
+		}
+		subscriber <- m
+	}
+	return nil
+}
+
+// cleanRoomText keeps a single line of printable text.
+func cleanRoomText(text string) string {
+	return strings.Join(strings.FieldsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r)
+	}), " ")
+}
@@ -0,0 +1,51 @@
+package watermillchat_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+)
+
+func TestRoomMetadata(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := chat.SubscribeRoomMetadata(ctx, "testRoom")
+	if m := <-updates; m.DisplayTitle() != "testRoom" {
+		t.Fatal("undescribed room is not titled by its name:", m)
+	}
+
+	ctx = watermillchat.ContextWithIdentity(ctx, watermillchat.Identity{ID: "alice", Name: "Alice"})
+	if err = chat.UpdateRoomMetadata(ctx, watermillchat.RoomMetadata{
+		Name:  "testRoom",
+		Title: "  Test\x00 Room ",
+		Topic: "testing",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("room metadata update was not delivered")
+	case m := <-updates:
+		if m.Title != "Test Room" || m.Topic != "testing" {
+			t.Fatal("unexpected room metadata:", m)
+		}
+		if m.Creator == nil || m.Creator.ID != "alice" {
+			t.Fatal("room creator was not recorded:", m.Creator)
+		}
+	}
+
+	if err = chat.UpdateRoomMetadata(ctx, watermillchat.RoomMetadata{
+		Name:  "testRoom",
+		Title: strings.Repeat("x", watermillchat.MostRunesPerRoomTitle+1),
+	}); err == nil {
+		t.Fatal("overly long title was accepted")
+	}
+}
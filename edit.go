@@ -0,0 +1,100 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrNotAuthor is returned when someone other than
+// the author of a message tries to change it.
+var ErrNotAuthor = errors.New("only the author can change a message")
+
+// EditEvent replaces the content of a published message.
+// It is an [EventKindEdit] event.
+type EditEvent struct {
+	RoomName  string
+	MessageID string
+	Content   string
+	Mentions  []Identity
+	UpdatedAt int64
+}
+
+// Edit replaces the content of a retained message written by
+// the [Identity] in context. New content is validated and filtered
+// like a [Broadcast], except that edits cannot be held for review.
+func (c *Chat) Edit(ctx context.Context, roomName, messageID, content string) (err error) {
+	if c.closing.Err() != nil {
+		return ErrChatClosed
+	}
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return ErrNotAuthor
+	}
+	m, err := c.retainedMessage(ctx, roomName, messageID)
+	if err != nil {
+		return err
+	}
+	if m.Author == nil || m.Author.ID != identity.ID {
+		return ErrNotAuthor
+	}
+
+	m.Content = content
+	b, err := c.validator.ValidateMessage(ctx, Broadcast{Message: m, RoomName: roomName})
+	if err != nil {
+		return err
+	}
+	now := c.clock.Now()
+	if err = c.identityLimiter.Take(identity.ID, now); err != nil {
+		return err
+	}
+	if b, err = c.filterEdit(ctx, b); err != nil {
+		return err
+	}
+	return c.publishEvent(ctx, EventKindEdit, EditEvent{
+		RoomName:  roomName,
+		MessageID: messageID,
+		Content:   b.Content,
+		Mentions:  c.resolveMentions(ctx, roomName, b.Content),
+		UpdatedAt: now.Unix(),
+	})
+}
+
+// filterEdit applies [MessageFilter]s to edited content.
+// Edits cannot wait for review, so held ones are rejected.
+func (c *Chat) filterEdit(ctx context.Context, b Broadcast) (Broadcast, error) {
+	for _, filter := range c.filters {
+		modified, decision, err := filter.Filter(ctx, b)
+		if err != nil {
+			return b, fmt.Errorf("message filter failed: %w", err)
+		}
+		switch decision {
+		case DecisionAllow:
+		case DecisionModify:
+			b = modified
+		case DecisionReject, DecisionHold:
+			return b, &ModerationError{Decision: DecisionReject, MessageID: b.ID}
+		default:
+			return b, fmt.Errorf("message filter returned unknown decision: %s", decision)
+		}
+	}
+	return b, nil
+}
+
+// retainedMessage finds a message that the room still retains.
+func (c *Chat) retainedMessage(ctx context.Context, roomName, messageID string) (m Message, err error) {
+	room, err := c.room(ctx, roomName)
+	if err != nil {
+		return m, err
+	}
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	index := slices.IndexFunc(room.messages, func(m Message) bool {
+		return m.ID == messageID
+	})
+	if index < 0 {
+		return m, ErrMessageNotFound
+	}
+	return room.messages[index], nil
+}
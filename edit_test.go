@@ -0,0 +1,81 @@
+package watermillchat_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+)
+
+func TestEditAndReact(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		Watermill: synchronousWatermill(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := watermillchat.ContextWithIdentity(ctx, watermillchat.Identity{ID: "alice", Name: "Alice"})
+	bob := watermillchat.ContextWithIdentity(ctx, watermillchat.Identity{ID: "bob", Name: "Bob"})
+	if err = chat.Broadcast(ctx, watermillchat.Broadcast{
+		RoomName: "testRoom",
+		Message: watermillchat.Message{
+			Author:  &watermillchat.Identity{ID: "alice", Name: "Alice"},
+			Content: "helo",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	retained := func() watermillchat.Message {
+		t.Helper()
+		subscriptionCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		return (<-chat.Subscribe(subscriptionCtx, "testRoom"))[0]
+	}
+	messageID := retained().ID
+
+	if err = chat.Edit(bob, "testRoom", messageID, "hijacked"); !errors.Is(err, watermillchat.ErrNotAuthor) {
+		t.Fatal("someone else edited the message:", err)
+	}
+	if err = chat.Edit(alice, "testRoom", "unknown", "hello"); !errors.Is(err, watermillchat.ErrMessageNotFound) {
+		t.Fatal("unknown message was edited:", err)
+	}
+	if err = chat.Edit(alice, "testRoom", messageID, "  "); err == nil {
+		t.Fatal("message was edited to be empty")
+	}
+	if err = chat.Edit(alice, "testRoom", messageID, "hello @Bob"); err != nil {
+		t.Fatal(err)
+	}
+	if m := retained(); m.Content != "hello @Bob" || m.UpdatedAt == 0 {
+		t.Fatalf("message was not edited: %+v", m)
+	}
+
+	if err = chat.React(ctx, "testRoom", messageID, "👍"); !errors.Is(err, watermillchat.ErrIdentityRequired) {
+		t.Fatal("anonymous reaction was accepted:", err)
+	}
+	if err = chat.React(alice, "testRoom", messageID, "thumbs up"); !errors.Is(err, watermillchat.ErrInvalidReaction) {
+		t.Fatal("invalid reaction was accepted:", err)
+	}
+	for _, reaction := range []struct {
+		ctx   context.Context
+		emoji string
+	}{
+		{alice, "👍"},
+		{bob, "👍"},
+		{bob, "🎉"},
+		{alice, "👍"}, // removes the first one
+	} {
+		if err = chat.React(reaction.ctx, "testRoom", messageID, reaction.emoji); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reactions := retained().Reactions
+	if len(reactions) != 2 ||
+		reactions[0].Emoji != "👍" || len(reactions[0].Authors) != 1 || reactions[0].Authors[0].ID != "bob" ||
+		reactions[1].Emoji != "🎉" || len(reactions[1].Authors) != 1 {
+		t.Fatalf("unexpected reactions: %+v", reactions)
+	}
+}
@@ -0,0 +1,53 @@
+package watermillchat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// EventKindMetadataKey names the Watermill message metadata
+// field that distinguishes events sharing the chat topic.
+// Messages without it carry a [Broadcast].
+const EventKindMetadataKey = "wmc_kind"
+
+// EventKind identifies the payload of a Watermill message.
+// [HistoryRepository] implementations should acknowledge
+// and skip kinds they do not recognize.
+type EventKind string
+
+const (
+	EventKindBroadcast EventKind = ""
+	EventKindPreview   EventKind = "preview"
+	EventKindPin       EventKind = "pin"
+	EventKindUnpin     EventKind = "unpin"
+	EventKindEdit      EventKind = "edit"
+	EventKindReaction  EventKind = "reaction"
+	EventKindNotice    EventKind = "notice"
+	EventKindTyping    EventKind = "typing"
+
+	EventKindRoomMetadata EventKind = "room_metadata"
+)
+
+// EventKindOf reads the kind from Watermill message metadata.
+func EventKindOf(m *message.Message) EventKind {
+	return EventKind(m.Metadata.Get(EventKindMetadataKey))
+}
+
+// publishEvent encodes a payload of a given kind onto the chat topic.
+// Like broadcasts, events are refused with [ErrChatClosed] once the
+// chat is closing, and [Chat.Close] waits for history to acknowledge
+// the ones published before.
+func (c *Chat) publishEvent(ctx context.Context, kind EventKind, payload any) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("unable to encode %q event: %w", kind, err)
+	}
+	m := message.NewMessage(watermill.NewUUID(), encoded)
+	m.Metadata.Set(EventKindMetadataKey, string(kind))
+	m.SetContext(ctx)
+	return c.send(m)
+}
@@ -0,0 +1,110 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Decision is the verdict of a [MessageFilter].
+type Decision uint8
+
+const (
+	// DecisionAllow passes the message unchanged to the next filter.
+	DecisionAllow Decision = iota
+	// DecisionReject drops the message and returns a [ModerationError].
+	DecisionReject
+	// DecisionModify passes the returned message to the next filter.
+	DecisionModify
+	// DecisionHold places the message into [ModerationQueue] for review.
+	DecisionHold
+)
+
+func (d Decision) String() string {
+	switch d {
+	case DecisionAllow:
+		return "allow"
+	case DecisionReject:
+		return "reject"
+	case DecisionModify:
+		return "modify"
+	case DecisionHold:
+		return "hold"
+	default:
+		return fmt.Sprintf("Decision(%d)", d)
+	}
+}
+
+var (
+	ErrMessageRejected      = errors.New("message was rejected by moderation")
+	ErrMessageHeldForReview = errors.New("message is held for moderator review")
+)
+
+// MessageFilter intercepts a [Broadcast] before it is published.
+// Returned error indicates a failure of the filter itself,
+// not the rejection of the message.
+type MessageFilter interface {
+	Filter(context.Context, Broadcast) (Broadcast, Decision, error)
+}
+
+type MessageFilterFunc func(context.Context, Broadcast) (Broadcast, Decision, error)
+
+func (f MessageFilterFunc) Filter(ctx context.Context, b Broadcast) (Broadcast, Decision, error) {
+	return f(ctx, b)
+}
+
+// ModerationError is returned by [Chat.Broadcast] when
+// a [MessageFilter] rejects or holds a message.
+type ModerationError struct {
+	Decision Decision
+	// MessageID identifies the held message in [ModerationQueue].
+	MessageID string
+}
+
+func (e *ModerationError) Error() string {
+	if e.Decision == DecisionHold {
+		return ErrMessageHeldForReview.Error()
+	}
+	return ErrMessageRejected.Error()
+}
+
+func (e *ModerationError) Is(target error) bool {
+	if e.Decision == DecisionHold {
+		return target == ErrMessageHeldForReview
+	}
+	return target == ErrMessageRejected
+}
+
+// HyperTextStatusCode of a held message is not successful,
+// so that clients show the author that it was not posted yet.
+func (e *ModerationError) HyperTextStatusCode() int {
+	if e.Decision == DecisionHold {
+		return http.StatusConflict
+	}
+	return http.StatusForbidden
+}
+
+func (c *Chat) moderate(ctx context.Context, b Broadcast) (Broadcast, error) {
+	for _, filter := range c.filters {
+		modified, decision, err := filter.Filter(ctx, b)
+		if err != nil {
+			return b, fmt.Errorf("message filter failed: %w", err)
+		}
+		switch decision {
+		case DecisionAllow:
+		case DecisionModify:
+			b = modified
+		case DecisionReject:
+			return b, &ModerationError{Decision: decision, MessageID: b.ID}
+		case DecisionHold:
+			if err = c.moderationQueue.Hold(ctx, modified); err != nil {
+				return b, fmt.Errorf("unable to hold message for review: %w", err)
+			}
+			return b, &ModerationError{Decision: decision, MessageID: b.ID}
+		default:
+			return b, fmt.Errorf("message filter returned unknown decision: %s", decision)
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,176 @@
+package watermillchat
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NewWordListFilter replaces every listed word in
+// message content with mask runes. Matching ignores case
+// and only considers whole words.
+func NewWordListFilter(mask rune, words ...string) MessageFilter {
+	if len(words) == 0 {
+		panic("word list filter requires at least one word")
+	}
+	blocked := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word == "" {
+			panic("cannot filter an empty word")
+		}
+		blocked[word] = struct{}{}
+	}
+	maskString := string(mask)
+
+	return MessageFilterFunc(
+		func(ctx context.Context, b Broadcast) (Broadcast, Decision, error) {
+			var (
+				result   strings.Builder
+				modified bool
+				start    = -1
+			)
+			flush := func(end int) {
+				word := b.Content[start:end]
+				if _, ok := blocked[strings.ToLower(word)]; ok {
+					result.WriteString(strings.Repeat(maskString, utf8.RuneCountInString(word)))
+					modified = true
+				} else {
+					result.WriteString(word)
+				}
+				start = -1
+			}
+
+			for i, r := range b.Content {
+				if unicode.IsLetter(r) || unicode.IsDigit(r) {
+					if start < 0 {
+						start = i
+					}
+					continue
+				}
+				if start >= 0 {
+					flush(i)
+				}
+				result.WriteRune(r)
+			}
+			if start >= 0 {
+				flush(len(b.Content))
+			}
+
+			if !modified {
+				return b, DecisionAllow, nil
+			}
+			b.Content = result.String()
+			return b, DecisionModify, nil
+		},
+	)
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"']+`)
+
+// NewLinkBlocker rejects messages that contain links
+// to hosts other than the allowed ones. Sub-domains of
+// allowed hosts are also allowed.
+func NewLinkBlocker(allowedHosts ...string) MessageFilter {
+	normalized := make([]string, len(allowedHosts))
+	for i, host := range allowedHosts {
+		normalized[i] = strings.ToLower(strings.TrimSpace(host))
+	}
+
+	isAllowed := func(link string) bool {
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+		u, err := url.Parse(link)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(u.Hostname())
+		for _, allowed := range normalized {
+			if host == allowed || strings.HasSuffix(host, "."+allowed) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return MessageFilterFunc(
+		func(ctx context.Context, b Broadcast) (Broadcast, Decision, error) {
+			for _, link := range linkPattern.FindAllString(b.Content, -1) {
+				if !isAllowed(link) {
+					return b, DecisionReject, nil
+				}
+			}
+			return b, DecisionAllow, nil
+		},
+	)
+}
+
+type recentContent struct {
+	content string
+	at      time.Time
+}
+
+// NewDuplicateFilter rejects a message when its author has
+// already sent the same content more than the allowed number of
+// times within the window, as told by the clock. Messages without
+// an author are allowed.
+func NewDuplicateFilter(clock Clock, window time.Duration, allowedRepeats int) MessageFilter {
+	if clock == nil {
+		panic("cannot use a <nil> clock")
+	}
+	if window <= 0 {
+		panic("duplicate message window must be positive")
+	}
+	if allowedRepeats < 0 {
+		panic("allowed repeats cannot be negative")
+	}
+	var (
+		recent = make(map[string][]recentContent)
+		mu     sync.Mutex
+	)
+
+	return MessageFilterFunc(
+		func(ctx context.Context, b Broadcast) (Broadcast, Decision, error) {
+			if b.Author == nil {
+				return b, DecisionAllow, nil
+			}
+			now := clock.Now()
+			content := strings.ToLower(strings.Join(strings.Fields(b.Content), " "))
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			history := recent[b.Author.ID]
+			kept := history[:0]
+			repeats := 0
+			for _, previous := range history {
+				if now.Sub(previous.at) > window {
+					continue // expired
+				}
+				kept = append(kept, previous)
+				if previous.content == content {
+					repeats++
+				}
+			}
+			if repeats > allowedRepeats {
+				recent[b.Author.ID] = kept
+				return b, DecisionReject, nil
+			}
+			recent[b.Author.ID] = append(kept, recentContent{content: content, at: now})
+
+			// forget authors that went quiet
+			for id, history := range recent {
+				if last := history[len(history)-1]; now.Sub(last.at) > window {
+					delete(recent, id)
+				}
+			}
+			return b, DecisionAllow, nil
+		},
+	)
+}
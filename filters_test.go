@@ -0,0 +1,150 @@
+package watermillchat_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+)
+
+func filter(t *testing.T, f watermillchat.MessageFilter, content string) (string, watermillchat.Decision) {
+	t.Helper()
+	b, decision, err := f.Filter(context.Background(), watermillchat.Broadcast{
+		Message: watermillchat.Message{
+			Author:  &watermillchat.Identity{ID: "test", Name: "test"},
+			Content: content,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.Content, decision
+}
+
+func TestWordListFilter(t *testing.T) {
+	f := watermillchat.NewWordListFilter('*', "darn", "Heck")
+	if content, decision := filter(t, f, "Darn it, what the heck!"); decision != watermillchat.DecisionModify || content != "**** it, what the ****!" {
+		t.Fatalf("words were not masked: %q %s", content, decision)
+	}
+	if content, decision := filter(t, f, "darnation"); decision != watermillchat.DecisionAllow || content != "darnation" {
+		t.Fatalf("partial word was masked: %q %s", content, decision)
+	}
+}
+
+func TestLinkBlocker(t *testing.T) {
+	hosts := []string{" Example.COM "}
+	f := watermillchat.NewLinkBlocker(hosts...)
+	if hosts[0] != " Example.COM " {
+		t.Fatal("allowed hosts of the caller were modified:", hosts)
+	}
+	for content, expected := range map[string]watermillchat.Decision{
+		"no links here":                      watermillchat.DecisionAllow,
+		"see https://example.com/page":       watermillchat.DecisionAllow,
+		"see www.docs.example.com":           watermillchat.DecisionAllow,
+		"buy at http://spam.test/now":        watermillchat.DecisionReject,
+		"see https://example.com.spam.test/": watermillchat.DecisionReject,
+	} {
+		if _, decision := filter(t, f, content); decision != expected {
+			t.Errorf("link blocker decided %s instead of %s for %q", decision, expected, content)
+		}
+	}
+}
+
+func TestDuplicateFilter(t *testing.T) {
+	clock := watermillchat.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	f := watermillchat.NewDuplicateFilter(clock, time.Minute, 1)
+	for i, expected := range []watermillchat.Decision{
+		watermillchat.DecisionAllow,
+		watermillchat.DecisionAllow,
+		watermillchat.DecisionReject,
+	} {
+		if _, decision := filter(t, f, "  Buy   NOW "); decision != expected {
+			t.Fatalf("message #%d: duplicate filter decided %s instead of %s", i+1, decision, expected)
+		}
+		clock.Advance(time.Second * 20)
+	}
+	if _, decision := filter(t, f, "something else"); decision != watermillchat.DecisionAllow {
+		t.Fatal("unique message was rejected")
+	}
+	if _, decision := filter(t, f, "buy now"); decision != watermillchat.DecisionReject {
+		t.Fatal("repeated message was allowed within the window")
+	}
+	clock.Advance(time.Second * 30) // the first two repeats expire
+	if _, decision := filter(t, f, "buy now"); decision != watermillchat.DecisionAllow {
+		t.Fatal("message was rejected after repeats expired")
+	}
+}
+
+func TestModerationQueue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		Moderation: watermillchat.ModerationConfiguration{
+			Filters: []watermillchat.MessageFilter{
+				watermillchat.MessageFilterFunc(func(ctx context.Context, b watermillchat.Broadcast) (watermillchat.Broadcast, watermillchat.Decision, error) {
+					if strings.Contains(b.Content, "suspicious") {
+						return b, watermillchat.DecisionHold, nil
+					}
+					return b, watermillchat.DecisionAllow, nil
+				}),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := watermillchat.Identity{ID: "bob", Name: "Bob"}
+	messages := &messageReader{batches: chat.Subscribe(ctx, "testRoom")}
+	if err = chat.Broadcast(ctx, watermillchat.Broadcast{
+		RoomName: "testRoom",
+		Message:  watermillchat.Message{Author: &bob, Content: "hello"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	messages.next(t, ctx) // Bob is a member
+
+	hold := func(content string) watermillchat.Broadcast {
+		t.Helper()
+		err := chat.Broadcast(ctx, watermillchat.Broadcast{
+			RoomName: "testRoom",
+			Message:  watermillchat.Message{Content: content},
+		})
+		if !errors.Is(err, watermillchat.ErrMessageHeldForReview) {
+			t.Fatal("message was not held:", err)
+		}
+		held, err := chat.HeldMessages(ctx, "testRoom")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(held) != 1 || held[0].Content != content {
+			t.Fatal("unexpected held messages:", held)
+		}
+		return held[0]
+	}
+
+	held := hold("suspicious @bob")
+	if err = chat.ApproveHeld(ctx, held.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = chat.RejectHeld(ctx, held.ID); !errors.Is(err, watermillchat.ErrHeldMessageNotFound) {
+		t.Fatal("approved message remained in the queue:", err)
+	}
+	if m := messages.next(t, ctx); m.ID != held.ID || len(m.Mentions) != 1 || m.Mentions[0].ID != bob.ID {
+		t.Fatalf("approved message did not mention Bob: %+v", m)
+	}
+
+	held = hold("suspicious again")
+	if err = chat.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = chat.ApproveHeld(ctx, held.ID); !errors.Is(err, watermillchat.ErrChatClosed) {
+		t.Fatal("message was approved by a closed chat:", err)
+	}
+	if remaining, err := chat.HeldMessages(ctx, "testRoom"); err != nil || len(remaining) != 1 || remaining[0].ID != held.ID {
+		t.Fatal("message that failed to publish was lost:", remaining, err)
+	}
+}
@@ -16,7 +16,12 @@ type HistoryRepository interface {
 
 type VoidHistoryRepository struct{}
 
-func (r VoidHistoryRepository) Listen(broadcasts <-chan *message.Message) {}
+// Listen acknowledges and discards every broadcast.
+func (r VoidHistoryRepository) Listen(broadcasts <-chan *message.Message) {
+	for m := range broadcasts {
+		m.Ack()
+	}
+}
 
 func (r VoidHistoryRepository) GetRoomMessages(ctx context.Context, roomName string) ([]Message, error) {
 	return nil, nil
@@ -0,0 +1,173 @@
+package sqlitehistory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dkotik/watermillchat"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// setupDirectory prepares storage for [watermillchat.RoomDirectory].
+// Room metadata is not subject to message retention.
+func (r *Repository) setupDirectory() (err error) {
+	if err = sqlitex.ExecuteTransient(r.db, `
+		CREATE TABLE IF NOT EXISTS wmc_rooms (
+			name TEXT NOT NULL PRIMARY KEY,
+			title TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			description TEXT NOT NULL,
+			creator_id TEXT,
+			creator_name TEXT,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			kicked TEXT
+		)
+	`, nil); err != nil {
+		return err
+	}
+	if err = r.migrateDirectory(); err != nil {
+		return err
+	}
+	if r.stmtGetRoom, err = r.db.Prepare(`SELECT * FROM wmc_rooms WHERE name=?`); err != nil {
+		return err
+	}
+	if r.stmtSetRoom, err = r.db.Prepare(`INSERT OR REPLACE INTO wmc_rooms (name, title, topic, description, creator_id, creator_name, created_at, updated_at, kicked) VALUES (?,?,?,?,?,?,?,?,?)`); err != nil {
+		return err
+	}
+	if r.stmtCreateRoom, err = r.db.Prepare(`INSERT OR IGNORE INTO wmc_rooms (name, title, topic, description, creator_id, creator_name, created_at, updated_at, kicked) VALUES (?,?,?,?,?,?,?,?,?)`); err != nil {
+		return err
+	}
+	r.stmtListRooms, err = r.db.Prepare(`SELECT * FROM wmc_rooms ORDER BY name`)
+	return err
+}
+
+// migrateDirectory adds the kicked column
+// to rooms tables created before it.
+func (r *Repository) migrateDirectory() error {
+	missing := false
+	if err := sqlitex.ExecuteTransient(r.db,
+		`SELECT 1 WHERE NOT EXISTS (SELECT 1 FROM pragma_table_info('wmc_rooms') WHERE name='kicked')`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				missing = true
+				return nil
+			},
+		}); err != nil {
+		return err
+	}
+	if !missing {
+		return nil
+	}
+	return sqlitex.ExecuteTransient(r.db, `ALTER TABLE wmc_rooms ADD COLUMN kicked TEXT`, nil)
+}
+
+func readRoomMetadata(stmt *sqlite.Stmt) (m watermillchat.RoomMetadata, err error) {
+	var creator *watermillchat.Identity
+	if creatorID := stmt.GetText("creator_id"); creatorID != "" {
+		creator = &watermillchat.Identity{
+			ID:   creatorID,
+			Name: stmt.GetText("creator_name"),
+		}
+	}
+	m = watermillchat.RoomMetadata{
+		Name:        stmt.GetText("name"),
+		Title:       stmt.GetText("title"),
+		Topic:       stmt.GetText("topic"),
+		Description: stmt.GetText("description"),
+		Creator:     creator,
+		CreatedAt:   stmt.GetInt64("created_at"),
+		UpdatedAt:   stmt.GetInt64("updated_at"),
+	}
+	if kicked := stmt.GetText("kicked"); kicked != "" {
+		if err = json.Unmarshal([]byte(kicked), &m.Kicked); err != nil {
+			return m, fmt.Errorf("unable to decode kicked identities of room %q: %w", m.Name, err)
+		}
+	}
+	return m, nil
+}
+
+func (r *Repository) GetRoomMetadata(ctx context.Context, roomName string) (m watermillchat.RoomMetadata, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtGetRoom.BindText(1, roomName)
+	hasRow, err := r.stmtGetRoom.Step()
+	if err != nil {
+		return m, errors.Join(err, r.stmtGetRoom.Reset())
+	}
+	if !hasRow {
+		return watermillchat.RoomMetadata{Name: roomName}, errors.Join(watermillchat.ErrRoomNotFound, r.stmtGetRoom.Reset())
+	}
+	m, err = readRoomMetadata(r.stmtGetRoom)
+	return m, errors.Join(err, r.stmtGetRoom.Reset())
+}
+
+// bindRoomMetadata fills the values of a statement that
+// writes all columns of the rooms table.
+func bindRoomMetadata(stmt *sqlite.Stmt, m watermillchat.RoomMetadata) {
+	stmt.BindText(1, m.Name)
+	stmt.BindText(2, m.Title)
+	stmt.BindText(3, m.Topic)
+	stmt.BindText(4, m.Description)
+	if m.Creator != nil {
+		stmt.BindText(5, m.Creator.ID)
+		stmt.BindText(6, m.Creator.Name)
+	} else {
+		stmt.BindNull(5)
+		stmt.BindNull(6)
+	}
+	stmt.BindInt64(7, m.CreatedAt)
+	stmt.BindInt64(8, m.UpdatedAt)
+	if len(m.Kicked) > 0 {
+		kicked, _ := json.Marshal(m.Kicked) // strings always encode
+		stmt.BindText(9, string(kicked))
+	} else {
+		stmt.BindNull(9)
+	}
+}
+
+func (r *Repository) SetRoomMetadata(ctx context.Context, m watermillchat.RoomMetadata) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bindRoomMetadata(r.stmtSetRoom, m)
+	_, err = r.stmtSetRoom.Step()
+	return errors.Join(err, r.stmtSetRoom.Reset())
+}
+
+func (r *Repository) CreateRoomMetadata(ctx context.Context, m watermillchat.RoomMetadata) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bindRoomMetadata(r.stmtCreateRoom, m)
+	if _, err = r.stmtCreateRoom.Step(); err != nil {
+		return errors.Join(err, r.stmtCreateRoom.Reset())
+	}
+	if r.db.Changes() == 0 {
+		return errors.Join(watermillchat.ErrRoomExists, r.stmtCreateRoom.Reset())
+	}
+	return r.stmtCreateRoom.Reset()
+}
+
+func (r *Repository) ListRoomMetadata(ctx context.Context) (list []watermillchat.RoomMetadata, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for {
+		if hasRow, err := r.stmtListRooms.Step(); err != nil {
+			return nil, errors.Join(err, r.stmtListRooms.Reset())
+		} else if !hasRow {
+			break
+		}
+		m, err := readRoomMetadata(r.stmtListRooms)
+		if err != nil {
+			return nil, errors.Join(err, r.stmtListRooms.Reset())
+		}
+		list = append(list, m)
+	}
+	return list, r.stmtListRooms.Reset()
+}
@@ -0,0 +1,8 @@
+package sqlitehistory
+
+import "context"
+
+// Clean exposes retention clean up to tests.
+func (r *Repository) Clean(cutoff int64) error {
+	return r.clean(context.Background(), cutoff)
+}
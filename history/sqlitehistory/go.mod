@@ -4,7 +4,7 @@ go 1.23.3
 
 require (
 	github.com/ThreeDotsLabs/watermill v1.4.1
-	github.com/dkotik/watermillchat v0.0.5
+	github.com/dkotik/watermillchat v0.0.7
 	zombiezen.com/go/sqlite v1.4.0
 )
 
@@ -18,8 +18,11 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
 	golang.org/x/sys v0.24.0 // indirect
+	golang.org/x/text v0.20.0 // indirect
 	modernc.org/libc v1.55.3 // indirect
 	modernc.org/mathutil v1.6.0 // indirect
 	modernc.org/memory v1.8.0 // indirect
 	modernc.org/sqlite v1.33.1 // indirect
 )
+
+replace github.com/dkotik/watermillchat => ../..
@@ -11,6 +11,9 @@ import (
 )
 
 func (r *Repository) Insert(ctx context.Context, m watermillchat.Broadcast) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.stmtInsert.BindText(1, m.ID)
 	r.stmtInsert.BindText(2, m.RoomName)
 	if m.Author != nil {
@@ -20,13 +23,193 @@ func (r *Repository) Insert(ctx context.Context, m watermillchat.Broadcast) (err
 	r.stmtInsert.BindText(5, m.Content)
 	r.stmtInsert.BindInt64(6, m.CreatedAt)
 	r.stmtInsert.BindInt64(7, m.UpdatedAt)
+	r.stmtInsert.BindBool(8, m.Action)
 	_, err = r.stmtInsert.Step()
-	return errors.Join(err, r.stmtInsert.Reset())
+	if err = errors.Join(err, r.stmtInsert.Reset()); err != nil {
+		return err
+	}
+
+	for _, mentioned := range m.Mentions {
+		r.stmtInsertMention.BindText(1, m.ID)
+		r.stmtInsertMention.BindText(2, mentioned.ID)
+		r.stmtInsertMention.BindText(3, mentioned.Name)
+		r.stmtInsertMention.BindInt64(4, m.CreatedAt)
+		_, err = r.stmtInsertMention.Step()
+		if err = errors.Join(err, r.stmtInsertMention.Reset()); err != nil {
+			return err
+		}
+	}
+
+	for position, attachment := range m.Attachments {
+		r.stmtInsertAttachment.BindText(1, m.ID)
+		r.stmtInsertAttachment.BindInt64(2, int64(position))
+		r.stmtInsertAttachment.BindText(3, attachment.ID)
+		r.stmtInsertAttachment.BindText(4, attachment.Name)
+		r.stmtInsertAttachment.BindText(5, attachment.ContentType)
+		r.stmtInsertAttachment.BindInt64(6, attachment.Size)
+		r.stmtInsertAttachment.BindInt64(7, m.CreatedAt)
+		_, err = r.stmtInsertAttachment.Step()
+		if err = errors.Join(err, r.stmtInsertAttachment.Reset()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetPreviews attaches link previews to a stored message.
+func (r *Repository) SetPreviews(ctx context.Context, e watermillchat.PreviewEvent) (err error) {
+	previews, err := json.Marshal(e.Previews)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtUpsertPreviews.BindText(1, string(previews))
+	r.stmtUpsertPreviews.BindText(2, e.MessageID)
+	_, err = r.stmtUpsertPreviews.Step()
+	return errors.Join(err, r.stmtUpsertPreviews.Reset())
+}
+
+// Edit replaces content and mentions of a stored message.
+func (r *Repository) Edit(ctx context.Context, e watermillchat.EditEvent) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtEdit.BindText(1, e.Content)
+	r.stmtEdit.BindInt64(2, e.UpdatedAt)
+	r.stmtEdit.BindText(3, e.MessageID)
+	_, err = r.stmtEdit.Step()
+	if err = errors.Join(err, r.stmtEdit.Reset()); err != nil {
+		return err
+	}
+	if r.db.Changes() == 0 {
+		return nil // message expired
+	}
+	r.stmtDeleteMentions.BindText(1, e.MessageID)
+	_, err = r.stmtDeleteMentions.Step()
+	if err = errors.Join(err, r.stmtDeleteMentions.Reset()); err != nil {
+		return err
+	}
+	for _, mentioned := range e.Mentions {
+		r.stmtInsertMention.BindText(1, e.MessageID)
+		r.stmtInsertMention.BindText(2, mentioned.ID)
+		r.stmtInsertMention.BindText(3, mentioned.Name)
+		r.stmtInsertMention.BindInt64(4, e.UpdatedAt)
+		_, err = r.stmtInsertMention.Step()
+		if err = errors.Join(err, r.stmtInsertMention.Reset()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// React removes a stored reaction or adds it, if there was none.
+func (r *Repository) React(ctx context.Context, e watermillchat.ReactionEvent) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtDeleteReaction.BindText(1, e.MessageID)
+	r.stmtDeleteReaction.BindText(2, e.Emoji)
+	r.stmtDeleteReaction.BindText(3, e.Author.ID)
+	_, err = r.stmtDeleteReaction.Step()
+	if err = errors.Join(err, r.stmtDeleteReaction.Reset()); err != nil {
+		return err
+	}
+	if r.db.Changes() > 0 {
+		return nil
+	}
+	r.stmtInsertReaction.BindText(1, e.Emoji)
+	r.stmtInsertReaction.BindText(2, e.Author.ID)
+	r.stmtInsertReaction.BindText(3, e.Author.Name)
+	r.stmtInsertReaction.BindText(4, e.MessageID)
+	_, err = r.stmtInsertReaction.Step()
+	return errors.Join(err, r.stmtInsertReaction.Reset())
+}
+
+// Pin exempts a stored message from retention.
+func (r *Repository) Pin(ctx context.Context, e watermillchat.PinEvent) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtInsertPin.BindText(1, e.RoomName)
+	r.stmtInsertPin.BindText(2, e.Message.ID)
+	if e.PinnedBy != nil {
+		r.stmtInsertPin.BindText(3, e.PinnedBy.ID)
+		r.stmtInsertPin.BindText(4, e.PinnedBy.Name)
+	} else {
+		r.stmtInsertPin.BindNull(3)
+		r.stmtInsertPin.BindNull(4)
+	}
+	r.stmtInsertPin.BindInt64(5, e.PinnedAt)
+	_, err = r.stmtInsertPin.Step()
+	return errors.Join(err, r.stmtInsertPin.Reset())
+}
+
+func (r *Repository) Unpin(ctx context.Context, e watermillchat.UnpinEvent) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtDeletePin.BindText(1, e.RoomName)
+	r.stmtDeletePin.BindText(2, e.MessageID)
+	_, err = r.stmtDeletePin.Step()
+	return errors.Join(err, r.stmtDeletePin.Reset())
+}
+
+// receiveEvent stores changes to already published messages.
+// Unknown event kinds are skipped.
+func (r *Repository) receiveEvent(kind watermillchat.EventKind, m *message.Message) (err error) {
+	switch kind {
+	case watermillchat.EventKindPreview:
+		event := watermillchat.PreviewEvent{}
+		if err = json.Unmarshal(m.Payload, &event); err != nil {
+			return err
+		}
+		return r.SetPreviews(m.Context(), event)
+	case watermillchat.EventKindEdit:
+		event := watermillchat.EditEvent{}
+		if err = json.Unmarshal(m.Payload, &event); err != nil {
+			return err
+		}
+		return r.Edit(m.Context(), event)
+	case watermillchat.EventKindReaction:
+		event := watermillchat.ReactionEvent{}
+		if err = json.Unmarshal(m.Payload, &event); err != nil {
+			return err
+		}
+		return r.React(m.Context(), event)
+	case watermillchat.EventKindPin:
+		event := watermillchat.PinEvent{}
+		if err = json.Unmarshal(m.Payload, &event); err != nil {
+			return err
+		}
+		return r.Pin(m.Context(), event)
+	case watermillchat.EventKindUnpin:
+		event := watermillchat.UnpinEvent{}
+		if err = json.Unmarshal(m.Payload, &event); err != nil {
+			return err
+		}
+		return r.Unpin(m.Context(), event)
+	default:
+		return nil
+	}
 }
 
 func (r *Repository) Listen(broadcasts <-chan *message.Message) {
 	var err error
 	for message := range broadcasts {
+		if kind := watermillchat.EventKindOf(message); kind != watermillchat.EventKindBroadcast {
+			if err = r.receiveEvent(kind, message); err != nil {
+				r.logger.Error(
+					"failed to store event into SQLite database",
+					slog.String("kind", string(kind)),
+					slog.String("message_id", message.UUID),
+					slog.Any("error", err),
+				)
+			}
+			message.Ack()
+			continue
+		}
 		b := watermillchat.Broadcast{}
 		if err = json.Unmarshal(message.Payload, &b); err != nil {
 			message.Ack()
@@ -0,0 +1,138 @@
+package sqlitehistory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// setupSchedule prepares storage for [watermillchat.ScheduleStore].
+// Scheduled broadcasts are kept as JSON until they are removed.
+func (r *Repository) setupSchedule() (err error) {
+	if err = sqlitex.ExecuteTransient(r.db, `
+		CREATE TABLE IF NOT EXISTS wmc_schedule (
+			id TEXT NOT NULL PRIMARY KEY,
+			room_name TEXT NOT NULL,
+			broadcast TEXT NOT NULL,
+			at INTEGER NOT NULL,
+			claimed_until INTEGER NOT NULL DEFAULT 0
+		)
+	`, nil); err != nil {
+		return err
+	}
+	if err = sqlitex.ExecuteTransient(r.db, `
+		CREATE INDEX IF NOT EXISTS wmc_schedule_at ON wmc_schedule(at)
+	`, nil); err != nil {
+		return err
+	}
+	if r.stmtAddScheduled, err = r.db.Prepare(`INSERT INTO wmc_schedule (id, room_name, broadcast, at) VALUES (?,?,?,?)`); err != nil {
+		return err
+	}
+	if r.stmtClaimScheduled, err = r.db.Prepare(`
+		UPDATE wmc_schedule SET claimed_until=?1
+		WHERE at<=?2 AND claimed_until<=?2
+		RETURNING id, broadcast, at`); err != nil {
+		return err
+	}
+	if r.stmtRemoveScheduled, err = r.db.Prepare(`DELETE FROM wmc_schedule WHERE id=?`); err != nil {
+		return err
+	}
+	r.stmtListScheduled, err = r.db.Prepare(`SELECT id, broadcast, at FROM wmc_schedule WHERE room_name=? ORDER BY at, id`)
+	return err
+}
+
+func readScheduled(stmt *sqlite.Stmt) (s watermillchat.ScheduledBroadcast, err error) {
+	if err = json.Unmarshal([]byte(stmt.GetText("broadcast")), &s.Broadcast); err != nil {
+		return s, err
+	}
+	s.ID = stmt.GetText("id")
+	s.At = stmt.GetInt64("at")
+	return s, nil
+}
+
+func (r *Repository) AddScheduled(ctx context.Context, s watermillchat.ScheduledBroadcast) error {
+	encoded, err := json.Marshal(s.Broadcast)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtAddScheduled.BindText(1, s.ID)
+	r.stmtAddScheduled.BindText(2, s.RoomName)
+	r.stmtAddScheduled.BindText(3, string(encoded))
+	r.stmtAddScheduled.BindInt64(4, s.At)
+	_, err = r.stmtAddScheduled.Step()
+	return errors.Join(err, r.stmtAddScheduled.Reset())
+}
+
+func (r *Repository) ClaimScheduled(ctx context.Context, now time.Time, lease time.Duration) (due []watermillchat.ScheduledBroadcast, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtClaimScheduled.BindInt64(1, now.Add(lease).Unix())
+	r.stmtClaimScheduled.BindInt64(2, now.Unix())
+	for {
+		if hasRow, err := r.stmtClaimScheduled.Step(); err != nil {
+			return nil, errors.Join(err, r.stmtClaimScheduled.Reset())
+		} else if !hasRow {
+			break
+		}
+		s, err := readScheduled(r.stmtClaimScheduled)
+		if err != nil {
+			r.logger.Error("unable to decode scheduled broadcast", slog.String("id", s.ID), slog.Any("error", err))
+			continue
+		}
+		due = append(due, s)
+	}
+	if err = r.stmtClaimScheduled.Reset(); err != nil {
+		return nil, err
+	}
+	// rows returned by an update are not ordered
+	slices.SortFunc(due, watermillchat.CompareScheduled)
+	return due, nil
+}
+
+func (r *Repository) RemoveScheduled(ctx context.Context, id string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtRemoveScheduled.BindText(1, id)
+	if _, err = r.stmtRemoveScheduled.Step(); err != nil {
+		return errors.Join(err, r.stmtRemoveScheduled.Reset())
+	}
+	if err = r.stmtRemoveScheduled.Reset(); err != nil {
+		return err
+	}
+	if r.db.Changes() == 0 {
+		return watermillchat.ErrScheduledBroadcastNotFound
+	}
+	return nil
+}
+
+func (r *Repository) ListScheduled(ctx context.Context, roomName string) (list []watermillchat.ScheduledBroadcast, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtListScheduled.BindText(1, roomName)
+	for {
+		if hasRow, err := r.stmtListScheduled.Step(); err != nil {
+			return nil, errors.Join(err, r.stmtListScheduled.Reset())
+		} else if !hasRow {
+			break
+		}
+		s, err := readScheduled(r.stmtListScheduled)
+		if err != nil {
+			return nil, errors.Join(err, r.stmtListScheduled.Reset())
+		}
+		list = append(list, s)
+	}
+	return list, r.stmtListScheduled.Reset()
+}
@@ -0,0 +1,113 @@
+package sqlitehistory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dkotik/watermillchat"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// SearchPageSize is the number of results returned by [Repository.Search].
+const SearchPageSize = 25
+
+// setupSearch creates a full-text index over message content, which
+// is kept in sync with messages table using triggers. Messages
+// stored before the index existed are indexed on first run.
+func (r *Repository) setupSearch() (err error) {
+	exists := false
+	if err = sqlitex.ExecuteTransient(r.db,
+		`SELECT name FROM sqlite_master WHERE type='table' AND name='wmc_messages_fts'`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				exists = true
+				return nil
+			},
+		}); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	return sqlitex.ExecuteScript(r.db, `
+		CREATE VIRTUAL TABLE wmc_messages_fts USING fts5(
+			content,
+			content='wmc_messages',
+			content_rowid='seq'
+		);
+		CREATE TRIGGER IF NOT EXISTS wmc_messages_fts_insert AFTER INSERT ON wmc_messages BEGIN
+			INSERT INTO wmc_messages_fts(rowid, content) VALUES (new.seq, new.content);
+		END;
+		CREATE TRIGGER IF NOT EXISTS wmc_messages_fts_delete AFTER DELETE ON wmc_messages BEGIN
+			INSERT INTO wmc_messages_fts(wmc_messages_fts, rowid, content) VALUES ('delete', old.seq, old.content);
+		END;
+		CREATE TRIGGER IF NOT EXISTS wmc_messages_fts_update AFTER UPDATE OF content ON wmc_messages BEGIN
+			INSERT INTO wmc_messages_fts(wmc_messages_fts, rowid, content) VALUES ('delete', old.seq, old.content);
+			INSERT INTO wmc_messages_fts(rowid, content) VALUES (new.seq, new.content);
+		END;
+		INSERT INTO wmc_messages_fts(wmc_messages_fts) VALUES ('rebuild');
+	`, nil)
+}
+
+// matchQuery turns every word of a person's query into a quoted
+// phrase, so that full-text query syntax cannot be injected.
+// All words must match.
+func matchQuery(query string) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
+
+func (r *Repository) Search(ctx context.Context, query, roomFilter, cursor string) (results []watermillchat.Broadcast, nextCursor string, err error) {
+	match := matchQuery(query)
+	if match == "" {
+		return nil, "", nil
+	}
+	var before int64
+	if cursor != "" {
+		if before, err = strconv.ParseInt(cursor, 10, 64); err != nil || before < 1 {
+			return nil, "", fmt.Errorf("%w: %q", watermillchat.ErrInvalidSearchCursor, cursor)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtSearch.BindText(1, match)
+	r.stmtSearch.BindText(2, roomFilter)
+	r.stmtSearch.BindInt64(3, before)
+	r.stmtSearch.BindInt64(4, SearchPageSize+1)
+	var lastSeq int64
+	for {
+		if hasRow, err := r.stmtSearch.Step(); err != nil {
+			return nil, "", errors.Join(err, r.stmtSearch.Reset())
+		} else if !hasRow {
+			break
+		}
+		if len(results) == SearchPageSize {
+			nextCursor = strconv.FormatInt(lastSeq, 10)
+			continue // drain the extra row
+		}
+		lastSeq = r.stmtSearch.GetInt64("seq")
+		results = append(results, watermillchat.Broadcast{
+			Message:  readMessage(r.stmtSearch),
+			RoomName: r.stmtSearch.GetText("room_name"),
+		})
+	}
+	if err = r.stmtSearch.Reset(); err != nil {
+		return nil, "", err
+	}
+	for i := range results {
+		if err = r.getRelations(&results[i].Message); err != nil {
+			return nil, "", err
+		}
+	}
+	return results, nextCursor, nil
+}
@@ -1,14 +1,18 @@
 /*
-Package sqlitehistory implements [watermillchat.HistoryRepository]
+Package sqlitehistory implements [watermillchat.HistoryRepository],
+[watermillchat.RoomDirectory], and [watermillchat.ScheduleStore]
 using a modern SQLite backend.
 */
 package sqlitehistory
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"slices"
+	"sync"
 	"time"
 
 	"github.com/dkotik/watermillchat"
@@ -21,10 +25,54 @@ type Repository struct {
 	mostMessagesPerRoom int64
 	retention           time.Duration
 	logger              *slog.Logger
+	blobs               watermillchat.BlobStore
 
-	stmtInsert  *sqlite.Stmt
-	stmtCollect *sqlite.Stmt
-	stmtClean   *sqlite.Stmt
+	stmtInsert          *sqlite.Stmt
+	stmtInsertMention   *sqlite.Stmt
+	stmtCollect         *sqlite.Stmt
+	stmtLocate          *sqlite.Stmt
+	stmtCollectAfter    *sqlite.Stmt
+	stmtCollectBefore   *sqlite.Stmt
+	stmtCollectMentions *sqlite.Stmt
+	stmtClean           *sqlite.Stmt
+	stmtCleanMentions   *sqlite.Stmt
+	stmtSearch          *sqlite.Stmt
+
+	stmtInsertAttachment   *sqlite.Stmt
+	stmtCollectAttachments *sqlite.Stmt
+	stmtCleanAttachments   *sqlite.Stmt
+	stmtExpiredAttachments *sqlite.Stmt
+	stmtHasAttachment      *sqlite.Stmt
+
+	stmtUpsertPreviews  *sqlite.Stmt
+	stmtCollectPreviews *sqlite.Stmt
+	stmtCleanPreviews   *sqlite.Stmt
+
+	stmtEdit           *sqlite.Stmt
+	stmtDeleteMentions *sqlite.Stmt
+
+	stmtDeleteReaction   *sqlite.Stmt
+	stmtInsertReaction   *sqlite.Stmt
+	stmtCollectReactions *sqlite.Stmt
+	stmtCleanReactions   *sqlite.Stmt
+
+	stmtInsertPin     *sqlite.Stmt
+	stmtDeletePin     *sqlite.Stmt
+	stmtCollectPinned *sqlite.Stmt
+
+	stmtGetRoom    *sqlite.Stmt
+	stmtSetRoom    *sqlite.Stmt
+	stmtCreateRoom *sqlite.Stmt
+	stmtListRooms  *sqlite.Stmt
+
+	stmtAddScheduled    *sqlite.Stmt
+	stmtClaimScheduled  *sqlite.Stmt
+	stmtRemoveScheduled *sqlite.Stmt
+	stmtListScheduled   *sqlite.Stmt
+
+	// mu serializes access to the connection,
+	// which is not safe for concurrent use.
+	mu sync.Mutex
 }
 
 type RepositoryParameters struct {
@@ -50,6 +98,15 @@ type RepositoryParameters struct {
 	// Logger reports any problems associated with delivery.
 	// Defaults to [slog.Default].
 	Logger *slog.Logger
+
+	// Clock paces message clean up.
+	// Defaults to [watermillchat.SystemClock].
+	Clock watermillchat.Clock
+
+	// BlobStore keeps message attachments. Files attached
+	// only to cleaned up messages are deleted from it.
+	// Can be <nil>, if attachments are not used.
+	BlobStore watermillchat.BlobStore
 }
 
 func NewUsingFile(f string, p RepositoryParameters) (*Repository, error) {
@@ -107,6 +164,9 @@ func New(p RepositoryParameters) (r *Repository, err error) {
 		}
 		p.CleanUpFrequency = watermillchat.DefaultCleanupFrequency
 	}
+	if p.Clock == nil {
+		p.Clock = watermillchat.SystemClock{}
+	}
 	if p.MostMessagesPerRoom < 1 {
 		if p.MostMessagesPerRoom != 0 {
 			return nil, errors.New("message retention limit cannot be less than one")
@@ -119,21 +179,30 @@ func New(p RepositoryParameters) (r *Repository, err error) {
 		mostMessagesPerRoom: p.MostMessagesPerRoom,
 		retention:           p.Retention,
 		logger:              p.Logger,
+		blobs:               p.BlobStore,
 	}
 
+	if err = r.migrateMessages(); err != nil {
+		return nil, fmt.Errorf("unable to migrate messages: %w", err)
+	}
 	if err = sqlitex.ExecuteTransient(r.db, `
 		CREATE TABLE IF NOT EXISTS wmc_messages (
-			id BLOB NOT NULL PRIMARY KEY,
+			seq INTEGER PRIMARY KEY,
+			id BLOB NOT NULL UNIQUE,
 			room_name TEXT NOT NULL,
 			author_id TEXT,
 			author_name TEXT,
 			content TEXT NOT NULL,
 			created_at INTEGER NOT NULL,
-			updated_at
+			updated_at,
+			action INTEGER NOT NULL DEFAULT 0
 		)
 	`, nil); err != nil {
 		return nil, err
 	}
+	if err = r.migrateMessageActions(); err != nil {
+		return nil, fmt.Errorf("unable to migrate messages: %w", err)
+	}
 	if err = sqlitex.ExecuteTransient(r.db, `
 		CREATE INDEX IF NOT EXISTS wmc_room_name ON wmc_messages(room_name)
 	`, nil); err != nil {
@@ -144,8 +213,94 @@ func New(p RepositoryParameters) (r *Repository, err error) {
 	`, nil); err != nil {
 		return nil, err
 	}
+	if err = sqlitex.ExecuteTransient(r.db, `
+		CREATE TABLE IF NOT EXISTS wmc_mentions (
+			message_id BLOB NOT NULL,
+			identity_id TEXT NOT NULL,
+			identity_name TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (message_id, identity_id)
+		)
+	`, nil); err != nil {
+		return nil, err
+	}
+	if err = sqlitex.ExecuteTransient(r.db, `
+		CREATE INDEX IF NOT EXISTS wmc_mentions_identity_id ON wmc_mentions(identity_id)
+	`, nil); err != nil {
+		return nil, err
+	}
+
+	if err = sqlitex.ExecuteTransient(r.db, `
+		CREATE TABLE IF NOT EXISTS wmc_attachments (
+			message_id BLOB NOT NULL,
+			position INTEGER NOT NULL,
+			attachment_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			content_type TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (message_id, position)
+		)
+	`, nil); err != nil {
+		return nil, err
+	}
+	if err = sqlitex.ExecuteTransient(r.db, `
+		CREATE INDEX IF NOT EXISTS wmc_attachments_attachment_id ON wmc_attachments(attachment_id)
+	`, nil); err != nil {
+		return nil, err
+	}
+
+	if err = sqlitex.ExecuteTransient(r.db, `
+		CREATE TABLE IF NOT EXISTS wmc_previews (
+			message_id BLOB NOT NULL PRIMARY KEY,
+			previews TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		)
+	`, nil); err != nil {
+		return nil, err
+	}
+
+	if err = sqlitex.ExecuteTransient(r.db, `
+		CREATE TABLE IF NOT EXISTS wmc_reactions (
+			message_id BLOB NOT NULL,
+			emoji TEXT NOT NULL,
+			identity_id TEXT NOT NULL,
+			identity_name TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (message_id, emoji, identity_id)
+		)
+	`, nil); err != nil {
+		return nil, err
+	}
+
+	if err = sqlitex.ExecuteTransient(r.db, `
+		CREATE TABLE IF NOT EXISTS wmc_pins (
+			room_name TEXT NOT NULL,
+			message_id BLOB NOT NULL,
+			pinned_by_id TEXT,
+			pinned_by_name TEXT,
+			pinned_at INTEGER NOT NULL,
+			PRIMARY KEY (room_name, message_id)
+		)
+	`, nil); err != nil {
+		return nil, err
+	}
 
-	r.stmtInsert, err = r.db.Prepare(`INSERT INTO wmc_messages (id, room_name, author_id, author_name, content, created_at, updated_at) VALUES (?,?,?,?,?,?,?)`)
+	if err = r.setupDirectory(); err != nil {
+		return nil, fmt.Errorf("unable to set up room directory: %w", err)
+	}
+	if err = r.setupSchedule(); err != nil {
+		return nil, fmt.Errorf("unable to set up schedule: %w", err)
+	}
+	if err = r.setupSearch(); err != nil {
+		return nil, fmt.Errorf("unable to set up full-text search: %w", err)
+	}
+
+	r.stmtInsert, err = r.db.Prepare(`INSERT OR IGNORE INTO wmc_messages (id, room_name, author_id, author_name, content, created_at, updated_at, action) VALUES (?,?,?,?,?,?,?,?)`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtInsertMention, err = r.db.Prepare(`INSERT OR IGNORE INTO wmc_mentions (message_id, identity_id, identity_name, created_at) VALUES (?,?,?,?)`)
 	if err != nil {
 		return nil, err
 	}
@@ -153,32 +308,408 @@ func New(p RepositoryParameters) (r *Repository, err error) {
 	if err != nil {
 		return nil, err
 	}
-	r.stmtClean, err = r.db.Prepare(`DELETE FROM wmc_messages WHERE created_at<?`)
+	r.stmtLocate, err = r.db.Prepare(`SELECT seq FROM wmc_messages WHERE id=? AND room_name=?`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtCollectAfter, err = r.db.Prepare(`SELECT * FROM wmc_messages WHERE room_name=? AND seq>? ORDER BY seq LIMIT ?`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtCollectBefore, err = r.db.Prepare(`SELECT * FROM wmc_messages WHERE room_name=? AND seq<? ORDER BY seq DESC LIMIT ?`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtCollectMentions, err = r.db.Prepare(`SELECT identity_id, identity_name FROM wmc_mentions WHERE message_id=? ORDER BY identity_id`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtClean, err = r.db.Prepare(`DELETE FROM wmc_messages WHERE created_at<? AND id NOT IN (SELECT message_id FROM wmc_pins)`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtCleanMentions, err = r.db.Prepare(`DELETE FROM wmc_mentions WHERE created_at<? AND message_id NOT IN (SELECT message_id FROM wmc_pins)`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtInsertAttachment, err = r.db.Prepare(`INSERT OR IGNORE INTO wmc_attachments (message_id, position, attachment_id, name, content_type, size, created_at) VALUES (?,?,?,?,?,?,?)`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtCollectAttachments, err = r.db.Prepare(`SELECT attachment_id, name, content_type, size FROM wmc_attachments WHERE message_id=? ORDER BY position`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtCleanAttachments, err = r.db.Prepare(`DELETE FROM wmc_attachments WHERE created_at<? AND message_id NOT IN (SELECT message_id FROM wmc_pins)`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtExpiredAttachments, err = r.db.Prepare(`
+		SELECT DISTINCT attachment_id FROM wmc_attachments
+		WHERE created_at<?1 AND message_id NOT IN (SELECT message_id FROM wmc_pins)
+			AND attachment_id NOT IN (
+				SELECT attachment_id FROM wmc_attachments
+				WHERE created_at>=?1 OR message_id IN (SELECT message_id FROM wmc_pins)
+			)`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtHasAttachment, err = r.db.Prepare(`SELECT 1 FROM wmc_attachments WHERE attachment_id=? LIMIT 1`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtUpsertPreviews, err = r.db.Prepare(`INSERT OR REPLACE INTO wmc_previews (message_id, previews, created_at) SELECT id, ?, created_at FROM wmc_messages WHERE id=?`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtCollectPreviews, err = r.db.Prepare(`SELECT previews FROM wmc_previews WHERE message_id=?`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtCleanPreviews, err = r.db.Prepare(`DELETE FROM wmc_previews WHERE created_at<? AND message_id NOT IN (SELECT message_id FROM wmc_pins)`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtEdit, err = r.db.Prepare(`UPDATE wmc_messages SET content=?, updated_at=? WHERE id=?`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtDeleteMentions, err = r.db.Prepare(`DELETE FROM wmc_mentions WHERE message_id=?`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtDeleteReaction, err = r.db.Prepare(`DELETE FROM wmc_reactions WHERE message_id=? AND emoji=? AND identity_id=?`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtInsertReaction, err = r.db.Prepare(`INSERT INTO wmc_reactions (message_id, emoji, identity_id, identity_name, created_at) SELECT id, ?, ?, ?, created_at FROM wmc_messages WHERE id=?`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtCollectReactions, err = r.db.Prepare(`SELECT emoji, identity_id, identity_name FROM wmc_reactions WHERE message_id=? ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtCleanReactions, err = r.db.Prepare(`DELETE FROM wmc_reactions WHERE created_at<? AND message_id NOT IN (SELECT message_id FROM wmc_pins)`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtInsertPin, err = r.db.Prepare(`INSERT OR IGNORE INTO wmc_pins (room_name, message_id, pinned_by_id, pinned_by_name, pinned_at) VALUES (?,?,?,?,?)`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtDeletePin, err = r.db.Prepare(`DELETE FROM wmc_pins WHERE room_name=? AND message_id=?`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtCollectPinned, err = r.db.Prepare(`
+		SELECT m.* FROM wmc_pins AS p JOIN wmc_messages AS m ON m.id = p.message_id
+		WHERE p.room_name=? ORDER BY p.pinned_at, p.rowid`)
+	if err != nil {
+		return nil, err
+	}
+	r.stmtSearch, err = r.db.Prepare(`
+		SELECT m.*
+		FROM wmc_messages_fts AS f JOIN wmc_messages AS m ON m.seq = f.rowid
+		WHERE wmc_messages_fts MATCH ?1
+			AND (?2 = '' OR m.room_name = ?2)
+			AND (?3 = 0 OR m.seq < ?3)
+		ORDER BY m.seq DESC LIMIT ?4`)
 	if err != nil {
 		return nil, err
 	}
 
-	go func(ctx context.Context, frequency, retention time.Duration) {
-		tick := time.NewTicker(frequency)
+	go func(ctx context.Context, tick watermillchat.Ticker, retention time.Duration) {
+		defer tick.Stop()
 		var t time.Time
 		var err error
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case t = <-tick.C:
-				r.stmtClean.BindInt64(1, int64(t.Add(-retention).Unix()))
-				_, err = r.stmtClean.Step()
-				if err = errors.Join(err, r.stmtClean.Reset()); err != nil {
+			case t = <-tick.C():
+				if err = r.clean(ctx, t.Add(-retention).Unix()); err != nil {
 					slog.Error("failed to clean up messages", slog.Any("error", err))
 				}
 			}
 		}
-	}(p.Context, p.CleanUpFrequency, p.Retention)
+	}(p.Context, p.Clock.NewTicker(p.CleanUpFrequency), p.Retention)
 	return r, nil
 }
 
+// migrateMessages gives messages tables created before the
+// seq column a stable integer key. Otherwise, VACUUM is free to
+// renumber rows, breaking full-text index and pagination, which
+// refer to messages by row identifiers.
+func (r *Repository) migrateMessages() error {
+	legacy := false
+	if err := sqlitex.ExecuteTransient(r.db,
+		`SELECT 1 FROM sqlite_master WHERE type='table' AND name='wmc_messages'
+			AND NOT EXISTS (SELECT 1 FROM pragma_table_info('wmc_messages') WHERE name='seq')`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				legacy = true
+				return nil
+			},
+		}); err != nil {
+		return err
+	}
+	if !legacy {
+		return nil
+	}
+	return sqlitex.ExecuteScript(r.db, `
+		DROP TRIGGER IF EXISTS wmc_messages_fts_insert;
+		DROP TRIGGER IF EXISTS wmc_messages_fts_delete;
+		DROP TRIGGER IF EXISTS wmc_messages_fts_update;
+		DROP TABLE IF EXISTS wmc_messages_fts;
+		CREATE TABLE wmc_messages_migrated (
+			seq INTEGER PRIMARY KEY,
+			id BLOB NOT NULL UNIQUE,
+			room_name TEXT NOT NULL,
+			author_id TEXT,
+			author_name TEXT,
+			content TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			updated_at
+		);
+		INSERT INTO wmc_messages_migrated (seq, id, room_name, author_id, author_name, content, created_at, updated_at)
+			SELECT rowid, id, room_name, author_id, author_name, content, created_at, updated_at
+			FROM wmc_messages ORDER BY rowid;
+		DROP TABLE wmc_messages;
+		ALTER TABLE wmc_messages_migrated RENAME TO wmc_messages;
+	`, nil)
+}
+
+// migrateMessageActions adds the action column
+// to messages tables created before it.
+func (r *Repository) migrateMessageActions() error {
+	missing := false
+	if err := sqlitex.ExecuteTransient(r.db,
+		`SELECT 1 WHERE NOT EXISTS (SELECT 1 FROM pragma_table_info('wmc_messages') WHERE name='action')`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				missing = true
+				return nil
+			},
+		}); err != nil {
+		return err
+	}
+	if !missing {
+		return nil
+	}
+	return sqlitex.ExecuteTransient(r.db, `ALTER TABLE wmc_messages ADD COLUMN action INTEGER NOT NULL DEFAULT 0`, nil)
+}
+
+// readMessage decodes a message from the current row of
+// a statement that selects all columns of the messages table.
+func readMessage(stmt *sqlite.Stmt) watermillchat.Message {
+	var author *watermillchat.Identity
+	if authorID := stmt.GetText("author_id"); authorID != "" {
+		author = &watermillchat.Identity{
+			ID:   authorID,
+			Name: stmt.GetText("author_name"),
+		}
+	}
+	return watermillchat.Message{
+		ID:        stmt.GetText("id"),
+		Author:    author,
+		Content:   stmt.GetText("content"),
+		CreatedAt: stmt.GetInt64("created_at"),
+		UpdatedAt: stmt.GetInt64("updated_at"),
+		Action:    stmt.GetBool("action"),
+	}
+}
+
+func (r *Repository) clean(ctx context.Context, cutoff int64) error {
+	expired, err := r.cleanMessages(cutoff)
+	if err != nil || r.blobs == nil {
+		return err
+	}
+	// files are deleted after their last reference is gone
+	for _, id := range expired {
+		if err = r.blobs.Delete(ctx, id); err != nil && !errors.Is(err, watermillchat.ErrBlobNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanMessages deletes messages older than the cutoff
+// with their relations and returns identifiers of
+// attachments that no other message refers to.
+func (r *Repository) cleanMessages(cutoff int64) (expired []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtExpiredAttachments.BindInt64(1, cutoff)
+	for {
+		if hasRow, err := r.stmtExpiredAttachments.Step(); err != nil {
+			return nil, errors.Join(err, r.stmtExpiredAttachments.Reset())
+		} else if !hasRow {
+			break
+		}
+		expired = append(expired, r.stmtExpiredAttachments.GetText("attachment_id"))
+	}
+	if err = r.stmtExpiredAttachments.Reset(); err != nil {
+		return nil, err
+	}
+
+	r.stmtClean.BindInt64(1, cutoff)
+	_, err = r.stmtClean.Step()
+	if err = errors.Join(err, r.stmtClean.Reset()); err != nil {
+		return nil, err
+	}
+	r.stmtCleanMentions.BindInt64(1, cutoff)
+	_, err = r.stmtCleanMentions.Step()
+	if err = errors.Join(err, r.stmtCleanMentions.Reset()); err != nil {
+		return nil, err
+	}
+	r.stmtCleanAttachments.BindInt64(1, cutoff)
+	_, err = r.stmtCleanAttachments.Step()
+	if err = errors.Join(err, r.stmtCleanAttachments.Reset()); err != nil {
+		return nil, err
+	}
+	r.stmtCleanReactions.BindInt64(1, cutoff)
+	_, err = r.stmtCleanReactions.Step()
+	if err = errors.Join(err, r.stmtCleanReactions.Reset()); err != nil {
+		return nil, err
+	}
+	r.stmtCleanPreviews.BindInt64(1, cutoff)
+	_, err = r.stmtCleanPreviews.Step()
+	if err = errors.Join(err, r.stmtCleanPreviews.Reset()); err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
+
+// HasAttachment is true while any kept message refers to
+// the attachment. Pass it to a blob store pruning uploads
+// that were never attached, such as the one of the localblob package.
+func (r *Repository) HasAttachment(ctx context.Context, id string) (ok bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtHasAttachment.BindText(1, id)
+	ok, err = r.stmtHasAttachment.Step()
+	return ok, errors.Join(err, r.stmtHasAttachment.Reset())
+}
+
+func (r *Repository) getMentions(messageID string) (mentions []watermillchat.Identity, err error) {
+	r.stmtCollectMentions.BindText(1, messageID)
+	for {
+		if hasRow, err := r.stmtCollectMentions.Step(); err != nil {
+			return nil, errors.Join(err, r.stmtCollectMentions.Reset())
+		} else if !hasRow {
+			break
+		}
+		mentions = append(mentions, watermillchat.Identity{
+			ID:   r.stmtCollectMentions.GetText("identity_id"),
+			Name: r.stmtCollectMentions.GetText("identity_name"),
+		})
+	}
+	return mentions, r.stmtCollectMentions.Reset()
+}
+
+// getReactions groups reactions by emoji in the order they first appeared.
+func (r *Repository) getReactions(messageID string) (reactions []watermillchat.Reaction, err error) {
+	r.stmtCollectReactions.BindText(1, messageID)
+	for {
+		if hasRow, err := r.stmtCollectReactions.Step(); err != nil {
+			return nil, errors.Join(err, r.stmtCollectReactions.Reset())
+		} else if !hasRow {
+			break
+		}
+		emoji := r.stmtCollectReactions.GetText("emoji")
+		author := watermillchat.Identity{
+			ID:   r.stmtCollectReactions.GetText("identity_id"),
+			Name: r.stmtCollectReactions.GetText("identity_name"),
+		}
+		if i := slices.IndexFunc(reactions, func(existing watermillchat.Reaction) bool {
+			return existing.Emoji == emoji
+		}); i >= 0 {
+			reactions[i].Authors = append(reactions[i].Authors, author)
+		} else {
+			reactions = append(reactions, watermillchat.Reaction{Emoji: emoji, Authors: []watermillchat.Identity{author}})
+		}
+	}
+	return reactions, r.stmtCollectReactions.Reset()
+}
+
+func (r *Repository) getAttachments(messageID string) (attachments []watermillchat.Attachment, err error) {
+	r.stmtCollectAttachments.BindText(1, messageID)
+	for {
+		if hasRow, err := r.stmtCollectAttachments.Step(); err != nil {
+			return nil, errors.Join(err, r.stmtCollectAttachments.Reset())
+		} else if !hasRow {
+			break
+		}
+		attachments = append(attachments, watermillchat.Attachment{
+			ID:          r.stmtCollectAttachments.GetText("attachment_id"),
+			Name:        r.stmtCollectAttachments.GetText("name"),
+			ContentType: r.stmtCollectAttachments.GetText("content_type"),
+			Size:        r.stmtCollectAttachments.GetInt64("size"),
+		})
+	}
+	return attachments, r.stmtCollectAttachments.Reset()
+}
+
+func (r *Repository) getPreviews(messageID string) (previews []watermillchat.LinkPreview, err error) {
+	r.stmtCollectPreviews.BindText(1, messageID)
+	hasRow, err := r.stmtCollectPreviews.Step()
+	if err != nil {
+		return nil, errors.Join(err, r.stmtCollectPreviews.Reset())
+	}
+	if hasRow {
+		err = json.Unmarshal([]byte(r.stmtCollectPreviews.GetText("previews")), &previews)
+	}
+	return previews, errors.Join(err, r.stmtCollectPreviews.Reset())
+}
+
+// getRelations loads mentions, attachments, and link previews of a message.
+func (r *Repository) getRelations(m *watermillchat.Message) (err error) {
+	if m.Mentions, err = r.getMentions(m.ID); err != nil {
+		return err
+	}
+	if m.Attachments, err = r.getAttachments(m.ID); err != nil {
+		return err
+	}
+	if m.Reactions, err = r.getReactions(m.ID); err != nil {
+		return err
+	}
+	m.Previews, err = r.getPreviews(m.ID)
+	return err
+}
+
+// GetPinnedMessages returns messages pinned in the room,
+// which are kept regardless of retention.
+func (r *Repository) GetPinnedMessages(ctx context.Context, roomName string) (messages []watermillchat.Message, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stmtCollectPinned.BindText(1, roomName)
+	for {
+		if hasRow, err := r.stmtCollectPinned.Step(); err != nil {
+			return nil, errors.Join(err, r.stmtCollectPinned.Reset())
+		} else if !hasRow {
+			break
+		}
+		messages = append(messages, readMessage(r.stmtCollectPinned))
+	}
+	if err = r.stmtCollectPinned.Reset(); err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		if err = r.getRelations(&messages[i]); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
 func (r *Repository) GetRoomMessages(ctx context.Context, roomName string) (messages []watermillchat.Message, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.stmtCollect.BindText(1, roomName)
 	r.stmtCollect.BindInt64(2, r.mostMessagesPerRoom)
 	for {
@@ -187,24 +718,91 @@ func (r *Repository) GetRoomMessages(ctx context.Context, roomName string) (mess
 		} else if !hasRow {
 			break
 		}
-		var author *watermillchat.Identity
-		if authorID := r.stmtCollect.GetText("author_id"); authorID != "" {
-			author = &watermillchat.Identity{
-				ID:   authorID,
-				Name: r.stmtCollect.GetText("author_name"),
-			}
-		}
-		messages = append(messages, watermillchat.Message{
-			ID:        r.stmtCollect.GetText("id"),
-			Author:    author,
-			Content:   r.stmtCollect.GetText("content"),
-			CreatedAt: r.stmtCollect.GetInt64("created_at"),
-			UpdatedAt: r.stmtCollect.GetInt64("updated_at"),
-		})
+		messages = append(messages, readMessage(r.stmtCollect))
 	}
 	if err = r.stmtCollect.Reset(); err != nil {
 		return nil, err
 	}
+	for i := range messages {
+		if err = r.getRelations(&messages[i]); err != nil {
+			return nil, err
+		}
+	}
 	slices.Reverse(messages)
 	return messages, nil
 }
+
+// GetRoomMessagesAfter returns messages stored after the given one
+// in the order they were stored. Edited messages keep their place.
+func (r *Repository) GetRoomMessagesAfter(ctx context.Context, roomName, messageID string, limit int) (messages []watermillchat.Message, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	after, err := r.locate(roomName, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return r.collectAround(r.stmtCollectAfter, roomName, after, limit)
+}
+
+// GetRoomMessagesBefore returns messages stored before the given one
+// in the order they were stored. Edited messages keep their place.
+func (r *Repository) GetRoomMessagesBefore(ctx context.Context, roomName, messageID string, limit int) (messages []watermillchat.Message, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, err := r.locate(roomName, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if messages, err = r.collectAround(r.stmtCollectBefore, roomName, before, limit); err != nil {
+		return nil, err
+	}
+	slices.Reverse(messages)
+	return messages, nil
+}
+
+// locate finds the storage order of a message.
+func (r *Repository) locate(roomName, messageID string) (rowID int64, err error) {
+	r.stmtLocate.BindText(1, messageID)
+	r.stmtLocate.BindText(2, roomName)
+	hasRow, err := r.stmtLocate.Step()
+	if err != nil {
+		return 0, errors.Join(err, r.stmtLocate.Reset())
+	}
+	if hasRow {
+		rowID = r.stmtLocate.ColumnInt64(0)
+	}
+	if err = r.stmtLocate.Reset(); err != nil {
+		return 0, err
+	}
+	if !hasRow {
+		return 0, watermillchat.ErrMessageNotFound
+	}
+	return rowID, nil
+}
+
+// collectAround reads up to limit messages of a room
+// on one side of the located row, depending on statement.
+func (r *Repository) collectAround(stmt *sqlite.Stmt, roomName string, rowID int64, limit int) (messages []watermillchat.Message, err error) {
+	stmt.BindText(1, roomName)
+	stmt.BindInt64(2, rowID)
+	stmt.BindInt64(3, int64(limit))
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, errors.Join(err, stmt.Reset())
+		} else if !hasRow {
+			break
+		}
+		messages = append(messages, readMessage(stmt))
+	}
+	if err = stmt.Reset(); err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		if err = r.getRelations(&messages[i]); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
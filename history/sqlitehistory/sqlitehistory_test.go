@@ -2,12 +2,19 @@ package sqlitehistory_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/blob/localblob"
 	"github.com/dkotik/watermillchat/history/sqlitehistory"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
 )
 
 func TestFileBacked(t *testing.T) {
@@ -101,3 +108,652 @@ func testInsert(t *testing.T, history *sqlitehistory.Repository) {
 		t.Fatal("returned message ID does not match the original")
 	}
 }
+
+func TestMentionRecords(t *testing.T) {
+	history, err := sqlitehistory.New(sqlitehistory.RepositoryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	if err = history.Insert(ctx, watermillchat.Broadcast{Message: watermillchat.Message{
+		ID:      "mentioning",
+		Content: "hello @alice",
+		Mentions: []watermillchat.Identity{
+			{ID: "alice-id", Name: "Alice"},
+		},
+	}, RoomName: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := history.GetRoomMessages(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || len(messages[0].Mentions) != 1 || messages[0].Mentions[0].ID != "alice-id" {
+		t.Fatal("mention records were not restored:", messages)
+	}
+}
+
+func TestAttachmentRecords(t *testing.T) {
+	history, err := sqlitehistory.New(sqlitehistory.RepositoryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	attachments := []watermillchat.Attachment{
+		{ID: "second", Name: "b.png", ContentType: "image/png", Size: 20},
+		{ID: "first", Name: "a.pdf", ContentType: "application/pdf", Size: 10},
+	}
+	if err = history.Insert(ctx, watermillchat.Broadcast{Message: watermillchat.Message{
+		ID:          "attaching",
+		Attachments: attachments,
+	}, RoomName: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := history.GetRoomMessages(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || !slices.Equal(messages[0].Attachments, attachments) {
+		t.Fatal("attachment records were not restored in order:", messages)
+	}
+}
+
+func TestActionRecords(t *testing.T) {
+	history, err := sqlitehistory.New(sqlitehistory.RepositoryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	if err = history.Insert(ctx, watermillchat.Broadcast{Message: watermillchat.Message{
+		ID:      "waving",
+		Author:  &watermillchat.Identity{ID: "alice", Name: "Alice"},
+		Content: "waves",
+		Action:  true,
+	}, RoomName: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := history.GetRoomMessages(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || !messages[0].Action || messages[0].Author == nil {
+		t.Fatal("action message was not restored:", messages)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	history, err := sqlitehistory.New(sqlitehistory.RepositoryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	total := sqlitehistory.SearchPageSize + 5
+	for i := range total {
+		room := "first"
+		if i%2 == 1 {
+			room = "second"
+		}
+		if err = history.Insert(ctx, watermillchat.Broadcast{Message: watermillchat.Message{
+			ID:        fmt.Sprintf("message%d", i),
+			Content:   fmt.Sprintf("needle number %d in a haystack", i),
+			CreatedAt: int64(i),
+		}, RoomName: room}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = history.Insert(ctx, watermillchat.Broadcast{Message: watermillchat.Message{
+		ID:      "unrelated",
+		Content: `just hay" OR "needle`,
+	}, RoomName: "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, cursor, err := history.Search(ctx, "Needle haystack", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != sqlitehistory.SearchPageSize || cursor == "" {
+		t.Fatal("unexpected first page size:", len(results), cursor)
+	}
+	if results[0].ID != fmt.Sprintf("message%d", total-1) {
+		t.Fatal("results are not sorted newest first:", results[0].ID)
+	}
+	rest, cursor, err := history.Search(ctx, "needle haystack", "", cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 5 || cursor != "" {
+		t.Fatal("unexpected second page size:", len(rest), cursor)
+	}
+
+	results, _, err = history.Search(ctx, "needle", "second", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.RoomName != "second" {
+			t.Fatal("room filter was not applied:", result.RoomName)
+		}
+	}
+
+	results, _, err = history.Search(ctx, `hay" OR "needle`, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != "unrelated" {
+		t.Fatal("query syntax was not escaped:", results)
+	}
+}
+
+func TestPreviewRecords(t *testing.T) {
+	history, err := sqlitehistory.New(sqlitehistory.RepositoryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	if err = history.Insert(ctx, watermillchat.Broadcast{Message: watermillchat.Message{
+		ID:      "linking",
+		Content: "see https://example.com",
+	}, RoomName: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	previews := []watermillchat.LinkPreview{{URL: "https://example.com", Title: "Example"}}
+	for _, id := range []string{"linking", "missing"} {
+		if err = history.SetPreviews(ctx, watermillchat.PreviewEvent{
+			RoomName:  "test",
+			MessageID: id,
+			Previews:  previews,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages, err := history.GetRoomMessages(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || !slices.Equal(messages[0].Previews, previews) {
+		t.Fatal("link previews were not restored:", messages)
+	}
+}
+
+func TestPinnedRecords(t *testing.T) {
+	history, err := sqlitehistory.New(sqlitehistory.RepositoryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	for _, id := range []string{"pinned", "expiring"} {
+		if err = history.Insert(ctx, watermillchat.Broadcast{Message: watermillchat.Message{
+			ID:        id,
+			Content:   id + " message",
+			CreatedAt: 1,
+		}, RoomName: "test"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = history.Pin(ctx, watermillchat.PinEvent{
+		RoomName: "test",
+		Message:  watermillchat.Message{ID: "pinned"},
+		PinnedBy: &watermillchat.Identity{ID: "moderator", Name: "Moderator"},
+		PinnedAt: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = history.Clean(10); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := history.GetRoomMessages(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].ID != "pinned" {
+		t.Fatal("pinned message did not survive retention:", messages)
+	}
+	pinned, err := history.GetPinnedMessages(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pinned) != 1 || pinned[0].Content != "pinned message" {
+		t.Fatal("pinned message was not restored:", pinned)
+	}
+
+	if err = history.Unpin(ctx, watermillchat.UnpinEvent{RoomName: "test", MessageID: "pinned"}); err != nil {
+		t.Fatal(err)
+	}
+	if pinned, err = history.GetPinnedMessages(ctx, "test"); err != nil || len(pinned) != 0 {
+		t.Fatal("message was not unpinned:", pinned, err)
+	}
+}
+
+func TestAttachmentCleanUp(t *testing.T) {
+	blobs, err := localblob.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := sqlitehistory.New(sqlitehistory.RepositoryParameters{
+		BlobStore: blobs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	attach := func(messageID string, createdAt int64, attachmentIDs ...string) {
+		var attachments []watermillchat.Attachment
+		for _, id := range attachmentIDs {
+			attachment, err := blobs.Store(ctx, watermillchat.Attachment{ID: id}, strings.NewReader(id))
+			if err != nil && !strings.Contains(err.Error(), "already exists") {
+				t.Fatal(err)
+			}
+			attachment.Size = int64(len(id))
+			attachments = append(attachments, attachment)
+		}
+		if err = history.Insert(ctx, watermillchat.Broadcast{Message: watermillchat.Message{
+			ID:          messageID,
+			Content:     messageID,
+			CreatedAt:   createdAt,
+			Attachments: attachments,
+		}, RoomName: "test"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	attach("expiring", 1, "expired", "shared")
+	attach("recent", 20, "shared")
+	attach("pinned", 1, "kept")
+	if err = history.Pin(ctx, watermillchat.PinEvent{
+		RoomName: "test",
+		Message:  watermillchat.Message{ID: "pinned"},
+		PinnedAt: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = history.Clean(10); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = blobs.Stat(ctx, "expired"); !errors.Is(err, watermillchat.ErrBlobNotFound) {
+		t.Fatal("attachment of a cleaned up message was kept:", err)
+	}
+	for _, id := range []string{"shared", "kept"} {
+		if _, err = blobs.Stat(ctx, id); err != nil {
+			t.Fatal("attachment of a kept message was deleted:", id, err)
+		}
+		if ok, err := history.HasAttachment(ctx, id); err != nil || !ok {
+			t.Fatal("kept attachment is not referenced:", id, err)
+		}
+	}
+	if ok, err := history.HasAttachment(ctx, "expired"); err != nil || ok {
+		t.Fatal("cleaned up attachment is still referenced:", err)
+	}
+}
+
+func TestRoomDirectory(t *testing.T) {
+	history, err := sqlitehistory.New(sqlitehistory.RepositoryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	if _, err = history.GetRoomMetadata(ctx, "lobby"); !errors.Is(err, watermillchat.ErrRoomNotFound) {
+		t.Fatal("unknown room was found:", err)
+	}
+	expected := watermillchat.RoomMetadata{
+		Name:      "lobby",
+		Title:     "The Lobby",
+		Topic:     "Say hello",
+		Creator:   &watermillchat.Identity{ID: "creator", Name: "Creator"},
+		CreatedAt: 1,
+		UpdatedAt: 2,
+		Kicked:    []string{"bob", "eve"},
+	}
+	for _, m := range []watermillchat.RoomMetadata{{Name: "attic", Title: "Attic"}, expected} {
+		if err = history.SetRoomMetadata(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = history.CreateRoomMetadata(ctx, watermillchat.RoomMetadata{Name: "lobby", Title: "Taken"}); !errors.Is(err, watermillchat.ErrRoomExists) {
+		t.Fatal("described room was created again:", err)
+	}
+	if err = history.CreateRoomMetadata(ctx, watermillchat.RoomMetadata{Name: "cellar", Title: "Cellar"}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := history.GetRoomMetadata(ctx, "lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Title != expected.Title || m.Topic != expected.Topic || *m.Creator != *expected.Creator || m.UpdatedAt != 2 {
+		t.Fatal("unexpected room metadata:", m)
+	}
+	if !slices.Equal(m.Kicked, expected.Kicked) {
+		t.Fatal("kicked identities were not stored:", m.Kicked)
+	}
+	list, err := history.ListRoomMetadata(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Name != "attic" || list[0].Creator != nil || list[0].Kicked != nil || list[1].Name != "cellar" || list[2].Name != "lobby" {
+		t.Fatal("unexpected room list:", list)
+	}
+}
+
+func TestRoomDirectoryMigration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	conn, err := sqlite.OpenConn(filepath.Join(t.TempDir(), "test.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// rooms table as it was created before the kicked column
+	if err = sqlitex.ExecuteScript(conn, `
+		CREATE TABLE wmc_rooms (
+			name TEXT NOT NULL PRIMARY KEY,
+			title TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			description TEXT NOT NULL,
+			creator_id TEXT,
+			creator_name TEXT,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+		INSERT INTO wmc_rooms (name, title, topic, description, created_at, updated_at) VALUES ('lobby', 'The Lobby', '', '', 1, 1);
+	`, nil); err != nil {
+		t.Fatal(err)
+	}
+	history, err := sqlitehistory.New(sqlitehistory.RepositoryParameters{
+		Context:    ctx,
+		Connection: conn,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := history.GetRoomMetadata(ctx, "lobby")
+	if err != nil || m.Title != "The Lobby" || m.Kicked != nil {
+		t.Fatal("legacy room was not read:", m, err)
+	}
+	m.Kicked = []string{"bob"}
+	if err = history.SetRoomMetadata(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = history.GetRoomMetadata(ctx, "lobby"); err != nil || !slices.Equal(m.Kicked, []string{"bob"}) {
+		t.Fatal("kicked identities were not stored:", m, err)
+	}
+}
+
+func TestScheduleSurvivesRestart(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	file := filepath.Join(t.TempDir(), "schedule.sqlite")
+	now := time.Unix(1_700_000_000, 0)
+
+	firstCtx, stop := context.WithCancel(ctx)
+	first, err := sqlitehistory.NewUsingFile(file, sqlitehistory.RepositoryParameters{Context: firstCtx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range []string{"later", "sooner"} {
+		if err = first.AddScheduled(ctx, watermillchat.ScheduledBroadcast{
+			ID: id,
+			Broadcast: watermillchat.Broadcast{
+				RoomName: "lobby",
+				Message:  watermillchat.Message{Content: id},
+			},
+			At: now.Add(time.Hour * time.Duration(2-i)).Unix(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// claimed but never published before stopping
+	if due, err := first.ClaimScheduled(ctx, now.Add(time.Hour), time.Minute); err != nil || len(due) != 1 || due[0].Content != "sooner" {
+		t.Fatal("unexpected claim:", due, err)
+	}
+	stop()
+
+	second, err := sqlitehistory.NewUsingFile(file, sqlitehistory.RepositoryParameters{Context: ctx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := second.ListScheduled(ctx, "lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].ID != "sooner" || pending[1].ID != "later" {
+		t.Fatal("unexpected schedule after restart:", pending)
+	}
+	if due, err := second.ClaimScheduled(ctx, now.Add(time.Hour), time.Minute); err != nil || len(due) != 0 {
+		t.Fatal("leased broadcast was claimed twice:", due, err)
+	}
+	due, err := second.ClaimScheduled(ctx, now.Add(time.Hour+time.Minute), time.Minute)
+	if err != nil || len(due) != 1 || due[0].ID != "sooner" {
+		t.Fatal("broadcast with expired lease was not claimed again:", due, err)
+	}
+	if err = second.RemoveScheduled(ctx, "sooner"); err != nil {
+		t.Fatal(err)
+	}
+	if err = second.RemoveScheduled(ctx, "sooner"); !errors.Is(err, watermillchat.ErrScheduledBroadcastNotFound) {
+		t.Fatal("removed broadcast was removed again:", err)
+	}
+}
+
+func TestRoomMessagesAfterAndBefore(t *testing.T) {
+	history, err := sqlitehistory.New(sqlitehistory.RepositoryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	for _, b := range []watermillchat.Broadcast{
+		{Message: watermillchat.Message{ID: "first", Content: "first", CreatedAt: 1}, RoomName: "test"},
+		{Message: watermillchat.Message{ID: "elsewhere", Content: "elsewhere", CreatedAt: 2}, RoomName: "other"},
+		{Message: watermillchat.Message{ID: "second", Content: "second", CreatedAt: 3}, RoomName: "test"},
+		{Message: watermillchat.Message{ID: "third", Content: "third", CreatedAt: 4}, RoomName: "test"},
+	} {
+		if err = history.Insert(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages, err := history.GetRoomMessagesAfter(ctx, "test", "first", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].ID != "second" || messages[1].ID != "third" {
+		t.Fatal("unexpected messages after the first:", messages)
+	}
+	if messages, err = history.GetRoomMessagesAfter(ctx, "test", "first", 1); err != nil {
+		t.Fatal(err)
+	} else if len(messages) != 1 || messages[0].ID != "second" {
+		t.Fatal("limit was not applied:", messages)
+	}
+	if _, err = history.GetRoomMessagesAfter(ctx, "test", "elsewhere", 10); !errors.Is(err, watermillchat.ErrMessageNotFound) {
+		t.Fatal("message of another room was found:", err)
+	}
+
+	if messages, err = history.GetRoomMessagesBefore(ctx, "test", "third", 10); err != nil {
+		t.Fatal(err)
+	} else if len(messages) != 2 || messages[0].ID != "first" || messages[1].ID != "second" {
+		t.Fatal("unexpected messages before the third:", messages)
+	}
+	if messages, err = history.GetRoomMessagesBefore(ctx, "test", "third", 1); err != nil {
+		t.Fatal(err)
+	} else if len(messages) != 1 || messages[0].ID != "second" {
+		t.Fatal("limit did not keep the closest messages:", messages)
+	}
+	if _, err = history.GetRoomMessagesBefore(ctx, "test", "elsewhere", 10); !errors.Is(err, watermillchat.ErrMessageNotFound) {
+		t.Fatal("message of another room was found:", err)
+	}
+}
+
+func TestEditAndReactionRecords(t *testing.T) {
+	history, err := sqlitehistory.New(sqlitehistory.RepositoryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	if err = history.Insert(ctx, watermillchat.Broadcast{Message: watermillchat.Message{
+		ID:        "edited",
+		Content:   "helo",
+		CreatedAt: 1,
+	}, RoomName: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = history.Edit(ctx, watermillchat.EditEvent{
+		RoomName:  "test",
+		MessageID: "edited",
+		Content:   "hello @alice",
+		Mentions:  []watermillchat.Identity{{ID: "alice-id", Name: "Alice"}},
+		UpdatedAt: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	alice := watermillchat.Identity{ID: "alice-id", Name: "Alice"}
+	bob := watermillchat.Identity{ID: "bob-id", Name: "Bob"}
+	for _, e := range []watermillchat.ReactionEvent{
+		{MessageID: "edited", Emoji: "👍", Author: alice},
+		{MessageID: "edited", Emoji: "🎉", Author: bob},
+		{MessageID: "edited", Emoji: "👍", Author: bob},
+		{MessageID: "edited", Emoji: "🎉", Author: bob}, // removes the second one
+	} {
+		if err = history.React(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages, err := history.GetRoomMessages(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Fatal("unexpected number of messages:", len(messages))
+	}
+	m := messages[0]
+	if m.Content != "hello @alice" || m.UpdatedAt != 2 || len(m.Mentions) != 1 {
+		t.Fatalf("edit was not stored: %+v", m)
+	}
+	if len(m.Reactions) != 1 || m.Reactions[0].Emoji != "👍" || len(m.Reactions[0].Authors) != 2 {
+		t.Fatalf("reactions were not stored: %+v", m.Reactions)
+	}
+}
+
+func TestSearchSurvivesVacuum(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	conn, err := sqlite.OpenConn(filepath.Join(t.TempDir(), "test.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// messages table as it was created before the seq column
+	if err = sqlitex.ExecuteScript(conn, `
+		CREATE TABLE wmc_messages (
+			id BLOB NOT NULL PRIMARY KEY,
+			room_name TEXT NOT NULL,
+			author_id TEXT,
+			author_name TEXT,
+			content TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			updated_at
+		);
+		INSERT INTO wmc_messages (id, room_name, content, created_at) VALUES ('legacy', 'test', 'legacy needle', 1);
+	`, nil); err != nil {
+		t.Fatal(err)
+	}
+	history, err := sqlitehistory.New(sqlitehistory.RepositoryParameters{
+		Context:    ctx,
+		Connection: conn,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, content := range []string{"first needle", "second needle", "third needle"} {
+		if err = history.Insert(ctx, watermillchat.Broadcast{Message: watermillchat.Message{
+			ID:        fmt.Sprintf("message%d", i),
+			Content:   content,
+			CreatedAt: int64(i + 2),
+		}, RoomName: "test"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// VACUUM may renumber rows without an explicit key
+	if err = sqlitex.ExecuteTransient(conn, `DELETE FROM wmc_messages WHERE id='message0'`, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = sqlitex.ExecuteTransient(conn, `VACUUM`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	results, _, err := history.Search(ctx, "third", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != "message2" {
+		t.Fatal("search index lost track of messages:", results)
+	}
+	results, _, err = history.Search(ctx, "needle", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[2].ID != "legacy" {
+		t.Fatal("migrated messages were not indexed:", results)
+	}
+	messages, err := history.GetRoomMessagesAfter(ctx, "test", "legacy", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].ID != "message1" || messages[1].ID != "message2" {
+		t.Fatal("migrated messages are out of order:", messages)
+	}
+
+	if _, _, err = history.Search(ctx, "needle", "", "not a cursor"); !errors.Is(err, watermillchat.ErrInvalidSearchCursor) {
+		t.Fatal("malformed cursor was accepted:", err)
+	}
+}
+
+func TestRepeatedInsertIsIgnored(t *testing.T) {
+	history, err := sqlitehistory.New(sqlitehistory.RepositoryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	for _, content := range []string{"original", "repeated"} {
+		if err = history.Insert(ctx, watermillchat.Broadcast{Message: watermillchat.Message{
+			ID:      "scheduled",
+			Content: content,
+		}, RoomName: "test"}); err != nil {
+			t.Fatal("repeated broadcast was not acknowledged:", err)
+		}
+	}
+	messages, err := history.GetRoomMessages(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Content != "original" {
+		t.Fatal("repeated broadcast was stored:", messages)
+	}
+}
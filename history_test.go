@@ -3,7 +3,9 @@ package watermillchat
 import (
 	"context"
 	"testing"
-	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
 )
 
 func TestRoomMessagesRentention(t *testing.T) {
@@ -12,7 +14,15 @@ func TestRoomMessagesRentention(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// every broadcast reaches the room before publishing returns
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		BlockPublishUntilSubscriberAck: true,
+	}, watermill.NopLogger{})
 	chat, err := New(ctx, Configuration{
+		Watermill: WatermillConfiguration{
+			Publisher:  pubSub,
+			Subscriber: pubSub,
+		},
 		History: HistoryConfiguration{
 			MostMessagesPerRoom: limitMessagesPerRoom,
 		},
@@ -32,8 +42,6 @@ func TestRoomMessagesRentention(t *testing.T) {
 		}
 	}
 
-	<-time.After(time.Millisecond * 60)
-
 	chat.mu.Lock()
 	count := len(chat.rooms[testRoomNameForRetention].messages)
 	chat.mu.Unlock()
@@ -0,0 +1,424 @@
+package httpmux
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// APIVersion is the path segment shared by JSON API routes.
+// It changes only when the API breaks compatibility.
+const APIVersion = "v1"
+
+const (
+	DefaultAPIPageSize = 50
+	MostAPIPageSize    = 500
+)
+
+// Event types of the JSON API message stream. The data
+// of each event is a JSON array of [watermillchat.Message]s.
+const (
+	// APIStreamEventReset replaces every message the client has.
+	APIStreamEventReset = "reset"
+	// APIStreamEventMessages adds new messages and replaces
+	// edited ones that have the same ID.
+	APIStreamEventMessages = "messages"
+)
+
+// APIRoomList is the response body of the room listing.
+type APIRoomList struct {
+	Rooms []watermillchat.RoomListing
+}
+
+// APIMessagePage is a page of room history, oldest first.
+type APIMessagePage struct {
+	Messages []watermillchat.Message
+	// Cursor is the "before" query value of the
+	// previous page. Empty on the oldest page.
+	Cursor string `json:",omitempty"`
+}
+
+// APIMessageDraft is the request body of a new message.
+type APIMessageDraft struct {
+	Content string
+}
+
+// errAPIAccepted is returned by operations that acted
+// on a request without a result to respond with.
+var errAPIAccepted = errors.New("request was accepted")
+
+// AddAPI registers the versioned JSON API on the mux and
+// describes it with an OpenAPI document served at
+// {prefix}{version}/openapi.json. The prefix must begin and end
+// with a slash. Every route is wrapped by the authenticator.
+// Errors should be written by [hypermedia.NewJSONErrorHandler].
+func AddAPI(
+	mux *http.ServeMux,
+	prefix string,
+	c *watermillchat.Chat,
+	streams *Streams,
+	authenticator Middleware,
+	eh hypermedia.ErrorHandler,
+) {
+	if mux == nil {
+		panic("cannot use a <nil> mux")
+	}
+	if !strings.HasPrefix(prefix, "/") || !strings.HasSuffix(prefix, "/") {
+		panic("API prefix must begin and end with a slash")
+	}
+	if c == nil {
+		panic("cannot use a <nil> Watermill chat")
+	}
+	if streams == nil {
+		panic("cannot use a <nil> stream limiter")
+	}
+	if authenticator == nil {
+		panic("cannot use a <nil> authenticator")
+	}
+	if eh == nil {
+		panic("cannot use a <nil> error handler")
+	}
+
+	prefix += APIVersion + "/"
+	roomSelector := NewRoomSelectorFromURL("roomName")
+	operations := []apiOperation{
+		newAPIOperation(
+			http.MethodGet, prefix+"rooms", "listRooms",
+			"List public rooms, the most recently active first",
+			http.StatusOK, eh,
+			func(r *http.Request, _ struct{}) (APIRoomList, error) {
+				rooms, err := c.PublicRooms(r.Context())
+				return APIRoomList{Rooms: rooms}, err
+			},
+		),
+		newAPIOperation(
+			http.MethodGet, prefix+"rooms/{roomName}/messages", "listMessages",
+			"List room messages older than the cursor, oldest first",
+			http.StatusOK, eh,
+			func(r *http.Request, _ struct{}) (page APIMessagePage, err error) {
+				roomName, err := roomSelector(r)
+				if err != nil {
+					return page, err
+				}
+				limit, err := apiPageSize(r)
+				if err != nil {
+					return page, err
+				}
+				page.Messages, page.Cursor, err = c.RoomHistory(
+					r.Context(), roomName, r.URL.Query().Get("before"), limit)
+				return page, localizeBroadcastError(err)
+			},
+			apiParameter{Name: "before", Description: "Cursor of the previous page"},
+			apiParameter{Name: "limit", Description: fmt.Sprintf("Page size up to %d, defaults to %d", MostAPIPageSize, DefaultAPIPageSize), Integer: true},
+		),
+		acceptingAPIOperation(newAPIOperation(
+			http.MethodPost, prefix+"rooms/{roomName}/messages", "sendMessage",
+			"Send a message as the authenticated identity",
+			http.StatusCreated, eh,
+			func(r *http.Request, draft APIMessageDraft) (m watermillchat.Message, err error) {
+				identity, ok := watermillchat.IdentityFromContext(r.Context())
+				if !ok {
+					return m, hypermedia.ErrForbidden
+				}
+				roomName, err := roomSelector(r)
+				if err != nil {
+					return m, err
+				}
+				m, err = c.Send(r.Context(), watermillchat.Broadcast{
+					RoomName: roomName,
+					Message: watermillchat.Message{
+						Author:    &identity,
+						Content:   strings.TrimSpace(draft.Content),
+						CreatedAt: c.Clock().Now().Unix(),
+					},
+				})
+				if err == nil && m.ID == "" {
+					return m, errAPIAccepted // ran a command
+				}
+				return m, localizeBroadcastError(err)
+			},
+		), `Content starting with "`+watermillchat.CommandPrefix+`" ran a command instead of publishing a message. `+
+			`Replies of the command arrive on the room stream.`),
+		{
+			Method:  http.MethodGet,
+			Path:    prefix + "rooms/{roomName}/stream",
+			ID:      "streamMessages",
+			Summary: "Stream room messages as server sent events",
+			Description: `The first "` + APIStreamEventReset + `" event holds retained messages. ` +
+				`Following "` + APIStreamEventMessages + `" events hold new and edited messages. ` +
+				`Reconnecting clients that send the Last-Event-ID header receive only the messages they missed.`,
+			Response:    reflect.TypeFor[[]watermillchat.Message](),
+			StatusCode:  http.StatusOK,
+			ContentType: "text/event-stream",
+			Handler:     newAPIStreamHandler(c, roomSelector, streams, eh),
+		},
+	}
+
+	document, err := newOpenAPIDocument("Watermill Chat", operations)
+	if err != nil {
+		panic(fmt.Errorf("unable to generate OpenAPI document: %w", err))
+	}
+	mux.Handle("GET "+prefix+"openapi.json", hypermedia.NewAsset("application/json", document))
+	for _, o := range operations {
+		mux.Handle(o.Method+" "+o.Path, authenticator(o.Handler))
+	}
+}
+
+// newAPIOperation derives the request and response descriptions
+// from the handler. Request body is decoded for every input
+// type except empty struct.
+func newAPIOperation[In, Out any](
+	method, path, id, summary string,
+	statusCode int,
+	eh hypermedia.ErrorHandler,
+	handle func(*http.Request, In) (Out, error),
+	query ...apiParameter,
+) apiOperation {
+	operation := apiOperation{
+		Method:     method,
+		Path:       path,
+		ID:         id,
+		Summary:    summary,
+		Query:      query,
+		Response:   reflect.TypeFor[Out](),
+		StatusCode: statusCode,
+	}
+	if reflect.TypeFor[In]() != reflect.TypeFor[struct{}]() {
+		operation.Request = reflect.TypeFor[In]()
+	}
+
+	operation.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in In
+		if operation.Request != nil {
+			if err := decodeAPIRequest(w, r, &in); err != nil {
+				eh.HandlerError(w, r, err)
+				return
+			}
+		}
+		out, err := handle(r, in)
+		if errors.Is(err, errAPIAccepted) {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if err != nil {
+			var rateLimited *watermillchat.RateLimitError
+			if errors.As(err, &rateLimited) {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(rateLimited)))
+			}
+			eh.HandlerError(w, r, err)
+			return
+		}
+		body, err := json.Marshal(out)
+		if err != nil {
+			eh.HandlerError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		_, _ = w.Write(body)
+	})
+	return operation
+}
+
+// acceptingAPIOperation documents the [http.StatusAccepted]
+// response without a body that the operation writes when
+// its handler returns [errAPIAccepted].
+func acceptingAPIOperation(operation apiOperation, description string) apiOperation {
+	operation.Accepted = description
+	return operation
+}
+
+// decodeAPIRequest requires JSON content type, which browsers do
+// not send across sites without asking the server first.
+func decodeAPIRequest(w http.ResponseWriter, r *http.Request, v any) error {
+	if contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); contentType != "application/json" {
+		return &hypermedia.LocalizedError{
+			Cause:      fmt.Errorf("unsupported content type: %q", contentType),
+			StatusCode: http.StatusUnsupportedMediaType,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.UnsupportedMediaType",
+					Other: "Request body must be JSON",
+				},
+			},
+		}
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, DefaultMostSendRequestBytes)).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return &hypermedia.LocalizedError{
+				Cause:      err,
+				StatusCode: http.StatusRequestEntityTooLarge,
+				Message: &i18n.LocalizeConfig{
+					DefaultMessage: &i18n.Message{
+						ID:    "watermillchat.error.RequestTooLarge",
+						Other: "Message is too long",
+					},
+				},
+			}
+		}
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusBadRequest,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.MalformedRequest",
+					Other: "Request body is not valid JSON",
+				},
+			},
+		}
+	}
+	return nil
+}
+
+func apiPageSize(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return DefaultAPIPageSize, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > MostAPIPageSize {
+		return 0, &hypermedia.LocalizedError{
+			Cause:      fmt.Errorf("%w: %q", watermillchat.ErrInvalidPageSize, value),
+			StatusCode: http.StatusBadRequest,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.InvalidPageSize",
+					Other: "Page size must be between 1 and {{.Most}}",
+				},
+				TemplateData: map[string]any{
+					"Most": MostAPIPageSize,
+				},
+			},
+		}
+	}
+	return limit, nil
+}
+
+func newAPIStreamHandler(
+	c *watermillchat.Chat,
+	selector RoomSelector,
+	streams *Streams,
+	eh hypermedia.ErrorHandler,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomName, err := selector(r)
+		if err != nil {
+			eh.HandlerError(w, r, err)
+			return
+		}
+		stream, err := streams.open(r)
+		if err != nil {
+			eh.HandlerError(w, r, err)
+			return
+		}
+		defer stream.close()
+
+		var messages <-chan []watermillchat.Message
+		lastEventID := r.Header.Get("Last-Event-ID")
+		replaying := false
+		if lastEventID != "" {
+			messages, replaying = c.SubscribeAfter(r.Context(), roomName, lastEventID)
+		} else {
+			messages = c.Subscribe(r.Context(), roomName)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if err = http.NewResponseController(w).Flush(); err != nil {
+			return
+		}
+
+		event := APIStreamEventReset
+		seen := make(map[string]struct{})
+		for {
+			select {
+			case <-c.Closing():
+				stream.reconnect(w)
+			case <-stream.expired:
+				stream.expire(w)
+			case <-stream.heartbeat.C():
+				if err = stream.beat(w); err != nil {
+					slog.DebugContext(r.Context(), "failed to deliver server sent event to the client", slog.Any("error", err))
+				}
+			case batch, ok := <-messages:
+				if !ok {
+					select {
+					case <-c.Closing():
+						stream.reconnect(w)
+					default:
+					}
+					return
+				}
+				if replaying {
+					// skip messages the client received before reconnecting
+					replaying = false
+					event = APIStreamEventMessages
+					for i, m := range batch {
+						if m.ID == lastEventID {
+							for _, received := range batch[:i+1] {
+								seen[received.ID] = struct{}{}
+							}
+							batch = batch[i+1:]
+							break
+						}
+					}
+					if len(batch) == 0 {
+						continue
+					}
+				}
+				// edited messages do not move the client forward;
+				// batches are oldest first, so the last new one is the newest
+				lastNew := ""
+				for _, m := range batch {
+					if _, ok := seen[m.ID]; !ok {
+						seen[m.ID] = struct{}{}
+						if !m.Ephemeral { // not replayed
+							lastNew = m.ID
+						}
+					}
+				}
+				if err = writeAPIEvent(w, event, lastNew, batch); err != nil {
+					slog.DebugContext(r.Context(), "failed to deliver server sent event to the client", slog.Any("error", err))
+					return
+				}
+				event = APIStreamEventMessages
+			}
+		}
+	}
+}
+
+func writeAPIEvent(w http.ResponseWriter, event, id string, batch []watermillchat.Message) error {
+	if batch == nil {
+		batch = []watermillchat.Message{} // not null
+	}
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	b := &bytes.Buffer{}
+	b.WriteString("event: " + event + "\n")
+	if id != "" {
+		b.WriteString("id: " + id + "\n")
+	}
+	b.WriteString("data: ")
+	b.Write(data)
+	b.WriteString("\n\n")
+	if _, err = io.Copy(w, b); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
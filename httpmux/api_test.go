@@ -0,0 +1,191 @@
+package httpmux_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+func TestAPI(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = chat.CreateRoom(ctx, watermillchat.RoomMetadata{Name: "lobby", Title: "Lobby"}); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	httpmux.AddAPI(
+		mux,
+		"/api/",
+		chat,
+		newStreams(t, httpmux.StreamConfiguration{}),
+		httpmux.NaiveBearerHeaderAuthenticatorUnsafe,
+		hypermedia.NewJSONErrorHandler(i18n.NewBundle(hypermedia.DefaultLanguage)),
+	)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	streamCtx, stop := context.WithCancel(ctx)
+	defer stop() // before the server waits for streams to end
+
+	request := func(ctx context.Context, method, path, identity, body string) *http.Response {
+		t.Helper()
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+		r, err := http.NewRequestWithContext(ctx, method, server.URL+"/api/v1/"+path, reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		if identity != "" {
+			r.Header.Set("Authorization", "Bearer "+identity+":"+identity)
+		}
+		response, err := server.Client().Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { response.Body.Close() })
+		return response
+	}
+	decode := func(response *http.Response, statusCode int, v any) {
+		t.Helper()
+		if response.StatusCode != statusCode {
+			body, _ := io.ReadAll(response.Body)
+			t.Fatalf("unexpected status code %d: %s", response.StatusCode, body)
+		}
+		if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send := func(content string) watermillchat.Message {
+		t.Helper()
+		m := watermillchat.Message{}
+		decode(request(ctx, http.MethodPost, "rooms/lobby/messages", "alice", `{"Content":"`+content+`"}`), http.StatusCreated, &m)
+		if m.ID == "" || m.Content != content || m.Author == nil || m.Author.ID != "alice" {
+			t.Fatalf("unexpected message: %+v", m)
+		}
+		return m
+	}
+
+	t.Run("rooms", func(t *testing.T) {
+		list := httpmux.APIRoomList{}
+		decode(request(ctx, http.MethodGet, "rooms", "", ""), http.StatusOK, &list)
+		if len(list.Rooms) != 1 || list.Rooms[0].Title != "Lobby" {
+			t.Fatalf("unexpected rooms: %+v", list.Rooms)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		jsonError := hypermedia.JSONError{}
+		decode(request(ctx, http.MethodPost, "rooms/lobby/messages", "", `{"Content":"helo"}`), http.StatusForbidden, &jsonError)
+		if jsonError.StatusCode != http.StatusForbidden || jsonError.Message == "" {
+			t.Fatalf("unexpected error body: %+v", jsonError)
+		}
+		decode(request(ctx, http.MethodPost, "rooms/lobby/messages", "alice", `{"Content":"   "}`), http.StatusUnprocessableEntity, &jsonError)
+		if jsonError.Message != "Message is empty" {
+			t.Fatalf("unexpected error body: %+v", jsonError)
+		}
+		decode(request(ctx, http.MethodGet, "rooms/lobby/messages?before=unknown", "", ""), http.StatusNotFound, &jsonError)
+		decode(request(ctx, http.MethodGet, "rooms/lobby/messages?limit=0", "", ""), http.StatusBadRequest, &jsonError)
+	})
+
+	t.Run("commands", func(t *testing.T) {
+		response := request(ctx, http.MethodPost, "rooms/lobby/messages", "alice", `{"Content":"/help"}`)
+		if body, _ := io.ReadAll(response.Body); response.StatusCode != http.StatusAccepted || len(body) != 0 {
+			t.Fatalf("unexpected command response %d: %s", response.StatusCode, body)
+		}
+	})
+
+	t.Run("history", func(t *testing.T) {
+		sent := []watermillchat.Message{send("first"), send("second"), send("third")}
+		page := httpmux.APIMessagePage{}
+		decode(request(ctx, http.MethodGet, "rooms/lobby/messages?limit=2", "", ""), http.StatusOK, &page)
+		if len(page.Messages) != 2 || page.Messages[1].ID != sent[2].ID || page.Cursor != sent[1].ID {
+			t.Fatalf("unexpected latest page: %+v", page)
+		}
+		before := page.Cursor
+		page = httpmux.APIMessagePage{}
+		decode(request(ctx, http.MethodGet, "rooms/lobby/messages?limit=2&before="+before, "", ""), http.StatusOK, &page)
+		if len(page.Messages) != 1 || page.Messages[0].ID != sent[0].ID || page.Cursor != "" {
+			t.Fatalf("unexpected oldest page: %+v", page)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		response := request(streamCtx, http.MethodGet, "rooms/lobby/stream", "bob", "")
+		if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+			t.Fatal("unexpected content type:", contentType)
+		}
+		scanner := bufio.NewScanner(response.Body)
+		readStream(t, scanner, "event: "+httpmux.APIStreamEventReset)
+		readStream(t, scanner, "third")
+
+		fourth := send("fourth")
+		received := readStream(t, scanner, "fourth")
+		if !strings.Contains(received, "event: "+httpmux.APIStreamEventMessages+"\nid: "+fourth.ID+"\n") {
+			t.Fatal("unexpected event:", received)
+		}
+		fifth := send("fifth")
+
+		// reconnect after missing the fifth message
+		r, err := http.NewRequestWithContext(streamCtx, http.MethodGet, server.URL+"/api/v1/rooms/lobby/stream", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Last-Event-ID", fourth.ID)
+		replayed, err := server.Client().Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer replayed.Body.Close()
+		scanner = bufio.NewScanner(replayed.Body)
+		received = readStream(t, scanner, "\n\n")
+		if !strings.Contains(received, "id: "+fifth.ID+"\n") || strings.Contains(received, "fourth") {
+			t.Fatal("missed messages were not replayed:", received)
+		}
+	})
+
+	t.Run("OpenAPI document", func(t *testing.T) {
+		document := struct {
+			Paths      map[string]map[string]any
+			Components struct {
+				Schemas map[string]any
+			}
+		}{}
+		decode(request(ctx, http.MethodGet, "openapi.json", "", ""), http.StatusOK, &document)
+		for path, method := range map[string]string{
+			"/api/v1/rooms":                     "get",
+			"/api/v1/rooms/{roomName}/messages": "post",
+			"/api/v1/rooms/{roomName}/stream":   "get",
+		} {
+			if _, ok := document.Paths[path][method]; !ok {
+				t.Error("operation is not described:", method, path)
+			}
+		}
+		if _, ok := document.Paths["/api/v1/rooms/{roomName}/messages"]["post"].(map[string]any)["responses"].(map[string]any)["202"]; !ok {
+			t.Error("command response is not described")
+		}
+		for _, schema := range []string{"Message", "APIMessageDraft", "JSONError"} {
+			if _, ok := document.Components.Schemas[schema]; !ok {
+				t.Error("schema is not described:", schema)
+			}
+		}
+	})
+}
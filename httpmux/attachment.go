@@ -0,0 +1,254 @@
+package httpmux
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// DefaultMostUploadBytes limits the size of a file
+// accepted by [NewUploadHandler].
+const DefaultMostUploadBytes = 8 << 20
+
+// attachmentPath follows the mux prefix.
+const attachmentPath = "attachments/"
+
+// attachmentLink carries the file name, so that saved downloads
+// are named sensibly. Empty prefix leaves the link relative,
+// which resolves correctly only on room pages.
+func attachmentLink(prefix string, a watermillchat.Attachment) string {
+	name := a.Name
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+	return prefix + attachmentPath + url.PathEscape(a.ID) + "/" + url.PathEscape(name)
+}
+
+// DefaultUploadContentTypes are accepted by [NewUploadHandler]
+// as reported by [http.DetectContentType].
+var DefaultUploadContentTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"application/pdf",
+	"text/plain; charset=utf-8",
+}
+
+// NewUploadHandler stores the "file" field of a multipart form
+// in the [watermillchat.BlobStore] and responds with the JSON
+// description of the new [watermillchat.Attachment]. The content
+// type is sniffed rather than trusted from the request.
+func NewUploadHandler(
+	store watermillchat.BlobStore,
+	mostBytes int64,
+	allowedContentTypes []string,
+	eh hypermedia.ErrorHandler,
+) http.HandlerFunc {
+	if store == nil {
+		panic("cannot use a <nil> blob store")
+	}
+	if mostBytes < 1 {
+		panic("upload size limit cannot be lower than one")
+	}
+	if len(allowedContentTypes) == 0 {
+		panic("at least one upload content type is required")
+	}
+	if eh == nil {
+		panic("cannot use a <nil> error handler")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := watermillchat.IdentityFromContext(r.Context())
+		if !ok {
+			eh.HandlerError(w, r, hypermedia.ErrForbidden)
+			return
+		}
+		// leave room for multipart boundaries and headers
+		r.Body = http.MaxBytesReader(w, r.Body, mostBytes+DefaultMostSendRequestBytes)
+		reader, err := r.MultipartReader()
+		if err != nil {
+			eh.HandlerError(w, r, err)
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					err = &hypermedia.LocalizedError{
+						Cause:      errors.New("upload form does not contain a file"),
+						StatusCode: http.StatusBadRequest,
+						Message: &i18n.LocalizeConfig{
+							DefaultMessage: &i18n.Message{
+								ID:    "watermillchat.error.UploadMissing",
+								Other: "Choose a file to upload",
+							},
+						},
+					}
+				}
+				eh.HandlerError(w, r, localizeUploadError(err, mostBytes))
+				return
+			}
+			if part.FormName() != "file" {
+				continue
+			}
+
+			content := bufio.NewReaderSize(part, 512)
+			head, err := content.Peek(512)
+			if err != nil && !errors.Is(err, io.EOF) {
+				eh.HandlerError(w, r, localizeUploadError(err, mostBytes))
+				return
+			}
+			contentType := http.DetectContentType(head)
+			if !slices.Contains(allowedContentTypes, contentType) {
+				eh.HandlerError(w, r, &hypermedia.LocalizedError{
+					Cause:      errors.New("upload content type is not allowed: " + contentType),
+					StatusCode: http.StatusUnsupportedMediaType,
+					Message: &i18n.LocalizeConfig{
+						DefaultMessage: &i18n.Message{
+							ID:    "watermillchat.error.UploadType",
+							Other: "This kind of file cannot be attached",
+						},
+					},
+				})
+				return
+			}
+
+			attachment, err := store.Store(r.Context(), watermillchat.Attachment{
+				ID:          watermill.NewULID(),
+				Name:        filepath.Base(part.FileName()),
+				ContentType: contentType,
+				UploaderID:  identity.ID,
+			}, &limitedReader{Reader: content, Remaining: mostBytes})
+			if err != nil {
+				eh.HandlerError(w, r, localizeUploadError(err, mostBytes))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err = json.NewEncoder(w).Encode(attachment); err != nil {
+				slog.DebugContext(r.Context(), "failed to deliver upload response", slog.Any("error", err))
+			}
+			return
+		}
+	}
+}
+
+// NewAttachmentHandler serves attachment contents by identifier.
+// Only images are displayed inline, everything else is downloaded.
+func NewAttachmentHandler(
+	store watermillchat.BlobStore,
+	routePathSegmentName string,
+	eh hypermedia.ErrorHandler,
+) http.HandlerFunc {
+	if store == nil {
+		panic("cannot use a <nil> blob store")
+	}
+	if eh == nil {
+		panic("cannot use a <nil> error handler")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		attachment, content, err := store.Open(r.Context(), r.PathValue(routePathSegmentName))
+		if err != nil {
+			if errors.Is(err, watermillchat.ErrBlobNotFound) {
+				err = hypermedia.ErrNotFound
+			}
+			eh.HandlerError(w, r, err)
+			return
+		}
+		defer content.Close()
+
+		disposition := "attachment"
+		if attachment.IsImage() {
+			disposition = "inline"
+		}
+		w.Header().Set("Content-Type", attachment.ContentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{
+			"filename": attachment.Name,
+		}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		if _, err = io.Copy(w, content); err != nil {
+			slog.DebugContext(r.Context(), "failed to deliver attachment", slog.Any("error", err))
+		}
+	}
+}
+
+// resolveAttachments looks up attachments named by
+// comma-separated identifiers in the "attachments" form value.
+// Files uploaded by someone else are treated as missing.
+func resolveAttachments(r *http.Request, store watermillchat.BlobStore, identity watermillchat.Identity) (attachments []watermillchat.Attachment, err error) {
+	for _, id := range strings.Split(r.FormValue("attachments"), ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		if store == nil {
+			return nil, fmt.Errorf("%w: %s", watermillchat.ErrBlobNotFound, id)
+		}
+		attachment, err := store.Stat(r.Context(), id)
+		if err != nil {
+			return nil, err
+		}
+		if attachment.UploaderID != identity.ID {
+			return nil, fmt.Errorf("%w: %s", watermillchat.ErrBlobNotFound, id)
+		}
+		// the author is the uploader
+		attachment.UploaderID = ""
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+var errUploadTooLarge = errors.New("uploaded file is too large")
+
+// limitedReader fails instead of truncating like [io.LimitedReader].
+type limitedReader struct {
+	io.Reader
+	Remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (n int, err error) {
+	n, err = l.Reader.Read(p)
+	if l.Remaining -= int64(n); l.Remaining < 0 {
+		return n, errUploadTooLarge
+	}
+	return n, err
+}
+
+func localizeUploadError(err error, mostBytes int64) error {
+	var tooLarge *http.MaxBytesError
+	if !errors.Is(err, errUploadTooLarge) && !errors.As(err, &tooLarge) {
+		return err
+	}
+	megabytes := max(mostBytes>>20, 1)
+	return &hypermedia.LocalizedError{
+		Cause:      err,
+		StatusCode: http.StatusRequestEntityTooLarge,
+		Message: &i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "watermillchat.error.UploadTooLarge",
+				One:   "File is too large, the limit is {{.Megabytes}} megabyte",
+				Other: "File is too large, the limit is {{.Megabytes}} megabytes",
+			},
+			PluralCount: megabytes,
+			TemplateData: map[string]any{
+				"Megabytes": megabytes,
+			},
+		},
+	}
+}
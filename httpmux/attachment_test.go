@@ -0,0 +1,135 @@
+package httpmux_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/blob/localblob"
+	"github.com/dkotik/watermillchat/httpmux"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+func TestUploadHandler(t *testing.T) {
+	store, err := localblob.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := httpmux.NewUploadHandler(store, 1024, []string{"image/png"}, hypermedia.PlainTextErrorHandler)
+
+	send := func(name string, contents []byte) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		part, err := form.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = part.Write(contents); err != nil {
+			t.Fatal(err)
+		}
+		if err = form.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/upload", body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		r = r.WithContext(watermillchat.ContextWithIdentity(r.Context(), watermillchat.Identity{ID: "test", Name: "Test"}))
+		w := httptest.NewRecorder()
+		upload.ServeHTTP(w, r)
+		return w
+	}
+
+	picture := &bytes.Buffer{}
+	if err = png.Encode(picture, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	w := send("../../dot.png", picture.Bytes())
+	if w.Code != http.StatusOK {
+		t.Fatal("image upload failed:", w.Code, w.Body.String())
+	}
+	attachment := watermillchat.Attachment{}
+	if err = json.NewDecoder(w.Body).Decode(&attachment); err != nil {
+		t.Fatal(err)
+	}
+	if attachment.Name != "dot.png" || attachment.ContentType != "image/png" || attachment.Size != int64(picture.Len()) || attachment.UploaderID != "test" {
+		t.Fatal("unexpected attachment description:", attachment)
+	}
+
+	if w = send("fake.png", []byte("<html><script>alert(1)</script>")); w.Code != http.StatusUnsupportedMediaType {
+		t.Fatal("disguised upload was accepted:", w.Code)
+	}
+	large := append(picture.Bytes(), bytes.Repeat([]byte{0}, 2048)...)
+	if w = send("large.png", large); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatal("oversized upload was accepted:", w.Code)
+	}
+
+	mux, err := httpmux.New(httpmux.Configuration{
+		Authenticator: httpmux.NaiveBearerHeaderAuthenticatorUnsafe,
+		BlobStore:     store,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/attachments/"+attachment.ID+"/dot.png", nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), picture.Bytes()) {
+		t.Fatal("attachment was not served:", w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "inline") || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatal("attachment served with unsafe headers:", w.Header())
+	}
+}
+
+func TestMessageSendChecksAttachmentUploader(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := localblob.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Store(ctx, watermillchat.Attachment{
+		ID:          "upload",
+		Name:        "notes.txt",
+		ContentType: "text/plain; charset=utf-8",
+		UploaderID:  "alice",
+	}, strings.NewReader("notes")); err != nil {
+		t.Fatal(err)
+	}
+	handler := httpmux.NaiveBearerHeaderAuthenticatorUnsafe(httpmux.NewMessageSendHandler(
+		chat, store, hypermedia.NewPlainTextErrorHandler(i18n.NewBundle(hypermedia.DefaultLanguage))))
+
+	send := func(author, attachmentID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/send", strings.NewReader("roomName=lobby&content=hello&attachments="+attachmentID))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Authorization", "Bearer "+author)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+		return w
+	}
+	for attachmentID, author := range map[string]string{
+		"upload":    "bob:Bob",
+		"unknown":   "alice:Alice",
+		"..%2Fetc":  "alice:Alice",
+		"upload,x!": "alice:Alice",
+	} {
+		if w := send(author, attachmentID); w.Code != http.StatusUnprocessableEntity {
+			t.Fatal("unavailable attachment was not refused:", attachmentID, w.Code, w.Body.String())
+		}
+	}
+	if w := send("alice:Alice", "upload"); w.Code != http.StatusOK {
+		t.Fatal("uploader could not attach their file:", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,116 @@
+package httpmux
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+)
+
+const (
+	// DefaultCSRFCookieName holds the token half of the double-submit
+	// pair that is kept by the browser.
+	DefaultCSRFCookieName = "wmc_csrf"
+
+	// DefaultCSRFHeaderName carries the token half of the double-submit
+	// pair that is sent by post.js script.
+	DefaultCSRFHeaderName = "X-CSRF-Token"
+
+	// DefaultCSRFFormValueName is checked when the header is absent,
+	// which allows plain HTML forms to submit the token.
+	DefaultCSRFFormValueName = "csrf"
+)
+
+type csrfContextKeyType struct{}
+
+var csrfContextKey csrfContextKeyType
+
+// CSRFTokenFromContext returns the token issued to the request
+// by [NewCSRFMiddleware] for rendering into pages.
+func CSRFTokenFromContext(ctx context.Context) (token string, ok bool) {
+	token, ok = ctx.Value(csrfContextKey).(string)
+	return
+}
+
+// NewCSRFMiddleware protects unsafe requests from cross-site forgery.
+// Unsafe requests must originate from the same site according to
+// Sec-Fetch-Site or Origin headers and must carry a token that matches
+// the cookie value, the double-submit pattern. Safe requests
+// are issued a token cookie, if one is missing.
+func NewCSRFMiddleware(eh hypermedia.ErrorHandler) Middleware {
+	if eh == nil {
+		panic("cannot use a <nil> error handler")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := ""
+			if cookie, err := r.Cookie(DefaultCSRFCookieName); err == nil {
+				token = cookie.Value
+			}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				if token == "" {
+					token = newCSRFToken()
+					http.SetCookie(w, &http.Cookie{
+						Name:     DefaultCSRFCookieName,
+						Value:    token,
+						Path:     "/",
+						HttpOnly: true,
+						Secure:   r.TLS != nil,
+						SameSite: http.SameSiteStrictMode,
+					})
+				}
+			default:
+				if !isSameOriginRequest(r) {
+					eh.HandlerError(w, r, hypermedia.ErrForbidden)
+					return
+				}
+				submitted := r.Header.Get(DefaultCSRFHeaderName)
+				if submitted == "" {
+					submitted = r.PostFormValue(DefaultCSRFFormValueName)
+				}
+				if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(submitted)) != 1 {
+					eh.HandlerError(w, r, hypermedia.ErrForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(
+				context.WithValue(r.Context(), csrfContextKey, token)))
+		})
+	}
+}
+
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // never returns an error
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func isSameOriginRequest(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return true
+	case "":
+		// older browsers do not send fetch metadata
+	default:
+		return false
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// non-browser clients; the token is still checked
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
@@ -0,0 +1,59 @@
+package httpmux_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dkotik/watermillchat/httpmux"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	handler := httpmux.NewCSRFMiddleware(hypermedia.PlainTextErrorHandler)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, _ := httpmux.CSRFTokenFromContext(r.Context())
+			_, _ = w.Write([]byte(token))
+		}),
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/room", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != httpmux.DefaultCSRFCookieName {
+		t.Fatal("token cookie was not issued:", cookies)
+	}
+	token := cookies[0].Value
+	if w.Body.String() != token {
+		t.Fatal("rendered token does not match the cookie")
+	}
+
+	post := func(token, site string) int {
+		r := httptest.NewRequest(http.MethodPost, "/send", strings.NewReader("content=test"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookies[0])
+		if token != "" {
+			r.Header.Set(httpmux.DefaultCSRFHeaderName, token)
+		}
+		if site != "" {
+			r.Header.Set("Sec-Fetch-Site", site)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := post(token, "same-origin"); code != http.StatusOK {
+		t.Fatal("valid request was rejected:", code)
+	}
+	if code := post("", "same-origin"); code != http.StatusForbidden {
+		t.Fatal("request without token was accepted:", code)
+	}
+	if code := post(token+"x", "same-origin"); code != http.StatusForbidden {
+		t.Fatal("request with mismatched token was accepted:", code)
+	}
+	if code := post(token, "cross-site"); code != http.StatusForbidden {
+		t.Fatal("cross-site request was accepted:", code)
+	}
+}
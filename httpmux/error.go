@@ -0,0 +1,215 @@
+package httpmux
+
+import (
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// localizeBroadcastError wraps errors returned by [watermillchat.Chat.Broadcast]
+// into [hypermedia.LocalizedError]s with translatable messages for the room form.
+func localizeBroadcastError(err error) error {
+	var rateLimited *watermillchat.RateLimitError
+	if errors.As(err, &rateLimited) {
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusTooManyRequests,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.RateLimited",
+					One:   "You are sending messages too quickly, please wait {{.Seconds}} second",
+					Other: "You are sending messages too quickly, please wait {{.Seconds}} seconds",
+				},
+				PluralCount: retryAfterSeconds(rateLimited),
+				TemplateData: map[string]any{
+					"Seconds": retryAfterSeconds(rateLimited),
+				},
+			},
+		}
+	}
+
+	var tooLarge *watermillchat.ContentTooLargeError
+	if errors.As(err, &tooLarge) {
+		message := &i18n.Message{
+			ID:    "watermillchat.error.TooManyRunes",
+			One:   "Message is too long, the limit is {{.Limit}} character",
+			Other: "Message is too long, the limit is {{.Limit}} characters",
+		}
+		switch tooLarge.Unit {
+		case "lines":
+			message = &i18n.Message{
+				ID:    "watermillchat.error.TooManyLines",
+				One:   "Message has too many lines, the limit is {{.Limit}} line",
+				Other: "Message has too many lines, the limit is {{.Limit}} lines",
+			}
+		case "attachments":
+			message = &i18n.Message{
+				ID:    "watermillchat.error.TooManyAttachments",
+				One:   "Message has too many attachments, the limit is {{.Limit}} file",
+				Other: "Message has too many attachments, the limit is {{.Limit}} files",
+			}
+		}
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: message,
+				PluralCount:    tooLarge.Limit,
+				TemplateData: map[string]any{
+					"Limit": tooLarge.Limit,
+				},
+			},
+		}
+	}
+
+	if errors.Is(err, watermillchat.ErrBlobNotFound) {
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusUnprocessableEntity,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.AttachmentNotFound",
+					Other: "Attached file is no longer available, please upload it again",
+				},
+			},
+		}
+	}
+
+	if errors.Is(err, watermillchat.ErrEmptyMessage) {
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusUnprocessableEntity,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.EmptyMessage",
+					Other: "Message is empty",
+				},
+			},
+		}
+	}
+
+	var moderated *watermillchat.ModerationError
+	if errors.As(err, &moderated) {
+		message := &i18n.Message{
+			ID:    "watermillchat.error.MessageRejected",
+			Other: "Message was rejected by moderation",
+		}
+		if moderated.Decision == watermillchat.DecisionHold {
+			message = &i18n.Message{
+				ID:    "watermillchat.error.MessageHeldForReview",
+				Other: "Message will appear after a moderator reviews it",
+			}
+		}
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: moderated.HyperTextStatusCode(),
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: message,
+			},
+		}
+	}
+
+	if errors.Is(err, watermillchat.ErrChatClosed) {
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusServiceUnavailable,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.ChatClosed",
+					Other: "Server is restarting, please try again in a moment",
+				},
+			},
+		}
+	}
+
+	if errors.Is(err, watermillchat.ErrNotAuthor) || errors.Is(err, watermillchat.ErrIdentityRequired) {
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusForbidden,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.NotAuthor",
+					Other: "Only the author can change this message",
+				},
+			},
+		}
+	}
+
+	if errors.Is(err, watermillchat.ErrUnknownCommand) {
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusBadRequest,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.UnknownCommand",
+					Other: "Unknown command, type /help for the list",
+				},
+			},
+		}
+	}
+
+	if errors.Is(err, watermillchat.ErrCommandNotPermitted) {
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusForbidden,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.CommandNotPermitted",
+					Other: "You are not allowed to use this command",
+				},
+			},
+		}
+	}
+
+	if errors.Is(err, watermillchat.ErrKicked) {
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusForbidden,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.Kicked",
+					Other: "You were kicked out of this room",
+				},
+			},
+		}
+	}
+
+	if errors.Is(err, watermillchat.ErrMessageNotFound) {
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusNotFound,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.MessageNotFound",
+					Other: "Message is no longer available",
+				},
+			},
+		}
+	}
+
+	var invalid *watermillchat.InvalidContentError
+	if errors.As(err, &invalid) {
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusUnprocessableEntity,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.InvalidContent",
+					Other: "Message cannot be sent: {{.Reason}}",
+				},
+				TemplateData: map[string]any{
+					"Reason": invalid.Reason,
+				},
+			},
+		}
+	}
+	return err
+}
+
+func retryAfterSeconds(err *watermillchat.RateLimitError) int {
+	return int(math.Ceil(err.RetryAfter.Seconds()))
+}
@@ -0,0 +1,131 @@
+package httpmux
+
+import (
+	"bytes"
+	"context"
+	_ "embed" // for template history.html
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// DefaultHistoryContextMessages is the number of messages
+// shown on each side of a message found by search.
+const DefaultHistoryContextMessages = 10
+
+//go:embed history.html
+var historyTemplateSource string
+
+var historyTemplate = template.Must(template.New("history").Parse(historyTemplateSource))
+
+// HistoryRenderer displays a message found by search among the
+// messages around it, including those a room no longer retains.
+type HistoryRenderer struct {
+	RoomPathPrefix string
+	RoomName       string
+	MessageID      string
+	Messages       []watermillchat.Message
+}
+
+type historyMessage struct {
+	Found    bool
+	Rendered template.HTML
+}
+
+func (r HistoryRenderer) Render(ctx context.Context, w io.Writer, l *i18n.Localizer) (err error) {
+	data := struct {
+		Title    string
+		Messages []historyMessage
+		RoomLink string
+		OpenRoom string
+	}{
+		Messages: make([]historyMessage, 0, len(r.Messages)),
+		RoomLink: r.RoomPathPrefix + url.PathEscape(r.RoomName),
+	}
+	b := &bytes.Buffer{}
+	for _, m := range r.Messages {
+		b.Reset()
+		renderMessage(b, l, m, r.RoomPathPrefix, true)
+		data.Messages = append(data.Messages, historyMessage{
+			Found:    m.ID == r.MessageID,
+			Rendered: template.HTML(b.String()),
+		})
+	}
+	if data.Title, err = l.Localize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "watermillchat.history.title",
+			Other: "Conversation in {{.RoomName}}",
+		},
+		TemplateData: map[string]any{
+			"RoomName": r.RoomName,
+		},
+	}); err != nil {
+		return err
+	}
+	if data.OpenRoom, err = l.Localize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "watermillchat.history.room",
+			Other: "Open the room",
+		},
+	}); err != nil {
+		return err
+	}
+	return historyTemplate.Execute(w, data)
+}
+
+// NewHistoryHandler renders a [HistoryRenderer] page for the message
+// identified by the messageID path value in the selected room.
+func NewHistoryHandler(
+	c *watermillchat.Chat,
+	selector RoomSelector,
+	page func(hypermedia.Renderable) hypermedia.Renderable,
+	roomPathPrefix string,
+	eh hypermedia.ErrorHandler,
+	bundle *i18n.Bundle,
+) http.HandlerFunc {
+	if c == nil {
+		panic("cannot use a <nil> Watermill chat")
+	}
+	if selector == nil {
+		panic("cannot use a <nil> room selector")
+	}
+	if page == nil {
+		panic("cannot use a <nil> page renderer")
+	}
+	if eh == nil {
+		panic("cannot use a <nil> error handler")
+	}
+	if bundle == nil {
+		panic("cannot use a <nil> localization bundle")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomName, err := selector(r)
+		if err != nil {
+			eh.HandlerError(w, r, err)
+			return
+		}
+		renderer := HistoryRenderer{
+			RoomPathPrefix: roomPathPrefix,
+			RoomName:       roomName,
+			MessageID:      strings.TrimSpace(r.PathValue("messageID")),
+		}
+		renderer.Messages, err = c.MessageContext(
+			r.Context(), roomName, renderer.MessageID, DefaultHistoryContextMessages)
+		if err != nil {
+			if errors.Is(err, watermillchat.ErrMessageNotFound) {
+				err = hypermedia.ErrNotFound
+			}
+			eh.HandlerError(w, r, err)
+			return
+		}
+		hypermedia.NewPage(page(renderer), eh, bundle).ServeHTTP(w, r)
+	}
+}
@@ -10,13 +10,12 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
-	"time"
 
 	"github.com/dkotik/watermillchat"
 	"github.com/dkotik/watermillchat/httpmux/hypermedia"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
-	"golang.org/x/exp/rand"
 )
 
 //go:embed page.css
@@ -41,6 +40,14 @@ type Configuration struct {
 	Authenticator Middleware
 	Rendering     RenderingConfiguration
 	Logger        *slog.Logger
+
+	// BlobStore keeps message attachments. Uploads
+	// are disabled when <nil>.
+	BlobStore watermillchat.BlobStore
+
+	// Streams limits server sent event streams. Defaults
+	// to [NewStreams] with default [StreamConfiguration].
+	Streams *Streams
 }
 
 func (c Configuration) Validate() (err error) {
@@ -68,6 +75,9 @@ func (c Configuration) Validate() (err error) {
 	if c.Logger == nil {
 		err = errors.Join(err, errors.New("missing Logger"))
 	}
+	if c.Streams == nil {
+		err = errors.Join(err, errors.New("missing Streams"))
+	}
 	return err
 }
 
@@ -114,6 +124,11 @@ func New(c Configuration) (mux *http.ServeMux, err error) {
 	if c.Logger == nil {
 		c.Logger = slog.Default()
 	}
+	if c.Streams == nil {
+		if c.Streams, err = NewStreams(StreamConfiguration{}); err != nil {
+			return nil, err
+		}
+	}
 	if err = c.Validate(); err != nil {
 		return nil, err
 	}
@@ -137,50 +152,130 @@ func New(c Configuration) (mux *http.ServeMux, err error) {
 			c.Rendering.PageHead,
 			[]hypermedia.RenderableError{
 				hypermedia.ErrNotFound,
+				hypermedia.ErrBadRequest,
 				hypermedia.ErrInternalServerError,
 			}), c.Logger)
 
-	mux.HandleFunc(c.Prefix+"{roomName}/messages", NewRoomMessagesHandler(
+	// identified streams also receive private command replies
+	mux.Handle(c.Prefix+"{roomName}/messages", c.Authenticator(NewRoomMessagesHandler(
 		c.Chat,
 		NewRoomSelectorFromURL("roomName"),
+		c.Streams,
 		errorHandler,
-	))
-	mux.Handle(c.Prefix+"send", c.Authenticator(NewMessageSendHandler(
+		c.Rendering.Localization,
+	)))
+	plainTextErrorHandler := hypermedia.ErrorHandlerWithLogger(
+		hypermedia.NewPlainTextErrorHandler(c.Rendering.Localization), c.Logger)
+	csrf := NewCSRFMiddleware(plainTextErrorHandler)
+	mux.Handle(c.Prefix+"send", csrf(c.Authenticator(NewMessageSendHandler(
+		c.Chat,
+		c.BlobStore,
+		plainTextErrorHandler,
+	))))
+	if c.BlobStore != nil {
+		mux.Handle("POST "+c.Prefix+"upload", csrf(c.Authenticator(NewUploadHandler(
+			c.BlobStore,
+			DefaultMostUploadBytes,
+			DefaultUploadContentTypes,
+			plainTextErrorHandler,
+		))))
+		mux.HandleFunc("GET "+c.Prefix+attachmentPath+"{attachmentID}/{fileName}", NewAttachmentHandler(
+			c.BlobStore,
+			"attachmentID",
+			errorHandler,
+		))
+	}
+	mux.Handle("GET "+c.Prefix+"{roomName}/socket", c.Authenticator(NewRoomSocketHandler(
 		c.Chat,
-		hypermedia.ErrorHandlerWithLogger(hypermedia.PlainTextErrorHandler, c.Logger),
+		NewRoomSelectorFromURL("roomName"),
+		c.Streams,
+		plainTextErrorHandler,
+		c.Rendering.Localization,
 	)))
-
-	randomRoomRedirectSelector := http.HandlerFunc(
-		func(w http.ResponseWriter, r *http.Request) {
-			// TODO: extract room history
-			// to avoid redirecting to an active room
-
-			const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-			seed := rand.NewSource(uint64(time.Now().UnixNano()))
-			random := rand.New(seed)
-
-			result := make([]byte, 32)
-			for i := range result {
-				result[i] = charset[random.Intn(len(charset))]
-			}
-			http.Redirect(w, r, c.Prefix+string(result), http.StatusTemporaryRedirect)
-		},
+	mux.Handle(c.Prefix+"notifications", c.Authenticator(NewNotificationsHandler(
+		c.Chat,
+		c.Prefix,
+		c.Streams,
+		plainTextErrorHandler,
+	)))
+	AddAPI(
+		mux,
+		c.Prefix+"api/",
+		c.Chat,
+		c.Streams,
+		c.Authenticator,
+		hypermedia.ErrorHandlerWithLogger(
+			hypermedia.NewJSONErrorHandler(c.Rendering.Localization), c.Logger),
 	)
-	mux.HandleFunc(c.Prefix+"index.html", randomRoomRedirectSelector)
-	mux.HandleFunc(c.Prefix+"{$}", randomRoomRedirectSelector)
 
-	mux.HandleFunc(c.Prefix+"{roomName}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc(c.Prefix+"search", NewSearchHandler(
+		c.Chat,
+		page,
+		errorHandler,
+		c.Rendering.Localization,
+	))
+	mux.HandleFunc("GET "+c.Prefix+"search/{roomName}/{messageID}", NewHistoryHandler(
+		c.Chat,
+		NewRoomSelectorFromURL("roomName"),
+		page,
+		c.Prefix,
+		errorHandler,
+		c.Rendering.Localization,
+	))
+
+	index := csrf(NewIndexHandler(
+		c.Chat,
+		page,
+		c.Prefix,
+		errorHandler,
+		c.Rendering.Localization,
+	))
+	mux.Handle("GET "+c.Prefix+"index.html", index)
+	mux.Handle("GET "+c.Prefix+"{$}", index)
+	mux.Handle("POST "+c.Prefix+"create", csrf(c.Authenticator(NewRoomCreateHandler(
+		c.Chat,
+		c.Prefix,
+		plainTextErrorHandler,
+	))))
+	mux.HandleFunc("GET "+c.Prefix+"random", NewRandomRoomHandler(
+		c.Chat,
+		c.Prefix,
+		errorHandler,
+	))
+
+	mux.Handle("POST "+c.Prefix+"{roomName}/metadata", csrf(c.Authenticator(NewRoomMetadataHandler(
+		c.Chat,
+		NewRoomSelectorFromURL("roomName"),
+		plainTextErrorHandler,
+	))))
+
+	head := c.Rendering.PageHead
+	mux.Handle(c.Prefix+"{roomName}", csrf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// TODO: replace with RoomSelector
 		roomName := strings.TrimSpace(r.PathValue("roomName"))
 		if roomName == "" {
 			panic("not found") // TODO: replace with hypermedia.ErrNotFound
 			// return
 		}
-		hypermedia.NewPage(page(RoomRenderer{
+		metadata, err := c.Chat.RoomMetadata(r.Context(), roomName)
+		if err != nil {
+			errorHandler.HandlerError(w, r, err)
+			return
+		}
+		token, _ := CSRFTokenFromContext(r.Context())
+		uploadPath := ""
+		if c.BlobStore != nil {
+			uploadPath = c.Prefix + "upload"
+		}
+		hypermedia.NewPage(hypermedia.NewPageRenderer(roomHead(head, metadata))(RoomRenderer{
 			RoomName:        roomName,
+			Metadata:        metadata,
 			MessageSendPath: c.Prefix + "send",
+			UploadPath:      uploadPath,
+			MetadataPath:    c.Prefix + url.PathEscape(roomName) + "/metadata",
+			CSRFToken:       token,
 		}), errorHandler, c.Rendering.Localization).ServeHTTP(w, r)
-	}))
+	})))
 
 	// show a 404 page for everything else
 	mux.Handle(c.Prefix, notFound)
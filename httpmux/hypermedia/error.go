@@ -55,6 +55,60 @@ var PlainTextErrorHandler = ErrorHandlerFunc(
 	},
 )
 
+// LocalizedError attaches a translatable explanation
+// and a status code to an error for display to a person.
+type LocalizedError struct {
+	Cause      error
+	StatusCode int
+	Message    *i18n.LocalizeConfig
+}
+
+func (e *LocalizedError) Error() string {
+	return e.Cause.Error()
+}
+
+func (e *LocalizedError) Unwrap() error {
+	return e.Cause
+}
+
+func (e *LocalizedError) HyperTextStatusCode() int {
+	return e.StatusCode
+}
+
+// Localize translates the explanation. Falls back
+// on the original error message.
+func (e *LocalizedError) Localize(l *i18n.Localizer) string {
+	if e.Message == nil {
+		return e.Error()
+	}
+	message, err := l.Localize(e.Message)
+	if err != nil {
+		return e.Error()
+	}
+	return message
+}
+
+// NewPlainTextErrorHandler is a [PlainTextErrorHandler] that
+// writes [LocalizedError] messages in the language matching
+// the Accept-Language request header.
+func NewPlainTextErrorHandler(bundle *i18n.Bundle) ErrorHandler {
+	if bundle == nil {
+		panic("cannot use a <nil> localization bundle")
+	}
+	return ErrorHandlerFunc(
+		func(w http.ResponseWriter, r *http.Request, err error) {
+			var localized *LocalizedError
+			if !errors.As(err, &localized) {
+				PlainTextErrorHandler(w, r, err)
+				return
+			}
+			http.Error(w, localized.Localize(
+				i18n.NewLocalizer(bundle, r.Header.Get("Accept-Language")),
+			), localized.HyperTextStatusCode())
+		},
+	)
+}
+
 type codeToLocalizedErrorPageKey struct {
 	HyperTextStatusCode int
 	Language            language.Tag
@@ -237,6 +291,18 @@ func (e renderableError) Describe() (title, description *i18n.LocalizeConfig) {
 					Other: "There is no content for this link.",
 				},
 			}
+	case http.StatusBadRequest:
+		return &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "hypermedia.BadRequestError.Title",
+					Other: "Invalid Request",
+				},
+			}, &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "hypermedia.BadRequestError.Description",
+					Other: "This link is malformed or no longer valid.",
+				},
+			}
 	case http.StatusForbidden:
 		return &i18n.LocalizeConfig{
 				DefaultMessage: &i18n.Message{
@@ -293,6 +359,7 @@ func (e renderableError) Render(ctx context.Context, w io.Writer, l *i18n.Locali
 
 const (
 	ErrNotFound            = renderableError(http.StatusNotFound)
+	ErrBadRequest          = renderableError(http.StatusBadRequest)
 	ErrForbidden           = renderableError(http.StatusForbidden)
 	ErrInternalServerError = renderableError(http.StatusInternalServerError)
 )
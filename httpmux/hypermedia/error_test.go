@@ -3,6 +3,7 @@ package hypermedia_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -38,3 +39,69 @@ func TestErrorRendering(t *testing.T) {
 	}
 	// t.Fatal(b.String())
 }
+
+func TestLocalizedPlainTextError(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hypermedia.NewPlainTextErrorHandler(
+		i18n.NewBundle(hypermedia.DefaultLanguage),
+	).HandlerError(recorder, request, &hypermedia.LocalizedError{
+		Cause:      errors.New("test"),
+		StatusCode: http.StatusTooManyRequests,
+		Message: &i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "hypermedia.test.Localized",
+				Other: "Localized {{.Value}}",
+			},
+			TemplateData: map[string]any{"Value": 1},
+		},
+	})
+
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatal("unexpected status code:", recorder.Code)
+	}
+	if body := recorder.Body.String(); body != "Localized 1\n" {
+		t.Fatalf("unexpected error message: %q", body)
+	}
+}
+
+func TestJSONError(t *testing.T) {
+	handler := hypermedia.NewJSONErrorHandler(i18n.NewBundle(hypermedia.DefaultLanguage))
+	write := func(err error) (int, hypermedia.JSONError) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		request, requestErr := http.NewRequest(http.MethodGet, "/", nil)
+		if requestErr != nil {
+			t.Fatal(requestErr)
+		}
+		handler.HandlerError(recorder, request, err)
+		body := hypermedia.JSONError{}
+		if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return recorder.Code, body
+	}
+
+	if code, body := write(&hypermedia.LocalizedError{
+		Cause:      errors.New("test"),
+		StatusCode: http.StatusTooManyRequests,
+		Message: &i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "hypermedia.test.Localized",
+				Other: "Localized",
+			},
+		},
+	}); code != http.StatusTooManyRequests || body.StatusCode != code || body.Message != "Localized" {
+		t.Fatalf("unexpected localized error: %d %+v", code, body)
+	}
+	if code, body := write(hypermedia.ErrNotFound); code != http.StatusNotFound || body.Message != "Not Found" {
+		t.Fatalf("unexpected error with status code: %d %+v", code, body)
+	}
+	if code, body := write(errors.New("database password is wrong")); code != http.StatusInternalServerError || body.Message != "Internal Server Error" {
+		t.Fatalf("internal error was disclosed: %d %+v", code, body)
+	}
+}
@@ -0,0 +1,49 @@
+package hypermedia
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// JSONError is the body written by [NewJSONErrorHandler].
+type JSONError struct {
+	// StatusCode repeats the response status code
+	// for clients that lose the headers.
+	StatusCode int
+	// Message explains the error to a person.
+	Message string
+}
+
+// NewJSONErrorHandler writes a [JSONError] with the status code of
+// [Error]. [LocalizedError] messages are translated to the language
+// matching the Accept-Language request header. Other messages
+// are reduced to the status text, so that internal details
+// are not disclosed.
+func NewJSONErrorHandler(bundle *i18n.Bundle) ErrorHandler {
+	if bundle == nil {
+		panic("cannot use a <nil> localization bundle")
+	}
+	return ErrorHandlerFunc(
+		func(w http.ResponseWriter, r *http.Request, err error) {
+			body := JSONError{StatusCode: http.StatusInternalServerError}
+			var errorWithStatusCode Error
+			if errors.As(err, &errorWithStatusCode) {
+				body.StatusCode = errorWithStatusCode.HyperTextStatusCode()
+			}
+			body.Message = http.StatusText(body.StatusCode)
+			var localized *LocalizedError
+			if errors.As(err, &localized) && localized.Message != nil {
+				body.Message = localized.Localize(
+					i18n.NewLocalizer(bundle, r.Header.Get("Accept-Language")),
+				)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(body.StatusCode)
+			_ = json.NewEncoder(w).Encode(body)
+		},
+	)
+}
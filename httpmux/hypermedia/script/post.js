@@ -1,13 +1,19 @@
 export async function postForm(target, data, token) {
+  // cross-site request forgery token travels as a header
+  const { csrf, ...fields } = data;
+  const headers = {
+    Authorization: "Bearer " + token,
+    "Content-Type": "application/x-www-form-urlencoded;charset=UTF-8",
+  };
+  if (csrf) headers["X-CSRF-Token"] = csrf;
+
   return fetch(target, {
     method: "POST",
-    headers: {
-      Authorization: "Bearer " + token,
-      "Content-Type": "application/x-www-form-urlencoded;charset=UTF-8",
-    },
-    body: Object.keys(data)
+    credentials: "same-origin",
+    headers: headers,
+    body: Object.keys(fields)
       .map((key) => {
-        return encodeURIComponent(key) + "=" + encodeURIComponent(data[key]);
+        return encodeURIComponent(key) + "=" + encodeURIComponent(fields[key]);
       })
       .join("&"),
   })
@@ -21,4 +27,27 @@ export async function postForm(target, data, token) {
     });
 }
 
+export async function uploadFile(target, file, csrf, token) {
+  const body = new FormData();
+  body.append("file", file, file.name);
+  const headers = { Authorization: "Bearer " + token };
+  if (csrf) headers["X-CSRF-Token"] = csrf;
+
+  return fetch(target, {
+    method: "POST",
+    credentials: "same-origin",
+    headers: headers,
+    body: body,
+  })
+    .catch((networkError) => {
+      console.log("network error:", networkError);
+      throw new Error("disconnected from the server");
+    })
+    .then(async (res) => {
+      if (!res.ok) throw new Error(await res.text());
+      return res.json();
+    });
+}
+
 window.postForm = postForm;
+window.uploadFile = uploadFile;
@@ -0,0 +1,302 @@
+package httpmux
+
+import (
+	"context"
+	_ "embed" // for template index.html
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// DefaultRandomRoomAttempts limits how many random room names
+// are generated before giving up on finding an unused one.
+const DefaultRandomRoomAttempts = 8
+
+//go:embed index.html
+var indexTemplateSource string
+
+var indexTemplate = template.Must(template.New("index").Parse(indexTemplateSource))
+
+// IndexRenderer lists public rooms and offers to create
+// a named room or join a random one.
+type IndexRenderer struct {
+	RoomPathPrefix string
+	CreatePath     string
+	RandomPath     string
+	CSRFToken      string
+	Rooms          []watermillchat.RoomListing
+}
+
+type indexRoom struct {
+	Link         string
+	Title        string
+	Topic        string
+	Subscribers  int
+	LastActivity string
+}
+
+func (r IndexRenderer) Render(ctx context.Context, w io.Writer, l *i18n.Localizer) (err error) {
+	data := struct {
+		CreatePath  string
+		RandomPath  string
+		Store       string
+		Rooms       []indexRoom
+		Title       string
+		NoRooms     string
+		Create      string
+		NamePrompt  string
+		TitlePrompt string
+		TopicPrompt string
+		Random      string
+	}{
+		CreatePath: r.CreatePath,
+		RandomPath: r.RandomPath,
+		Rooms:      make([]indexRoom, 0, len(r.Rooms)),
+	}
+	store, err := json.Marshal(map[string]string{
+		"csrf":       r.CSRFToken,
+		"name":       "",
+		"title":      "",
+		"topic":      "",
+		"error":      "",
+		"authorName": "",
+	})
+	if err != nil {
+		return err
+	}
+	data.Store = string(store)
+	for _, room := range r.Rooms {
+		listed := indexRoom{
+			Link:        r.RoomPathPrefix + url.PathEscape(room.Name),
+			Title:       room.DisplayTitle(),
+			Topic:       room.Topic,
+			Subscribers: room.Subscribers,
+		}
+		if !room.LastActivity.IsZero() {
+			listed.LastActivity = room.LastActivity.UTC().Format(time.RFC3339)
+		}
+		data.Rooms = append(data.Rooms, listed)
+	}
+	for target, message := range map[*string]*i18n.Message{
+		&data.Title:       {ID: "watermillchat.index.title", Other: "Chat Rooms"},
+		&data.NoRooms:     {ID: "watermillchat.index.empty", Other: "There are no public rooms yet."},
+		&data.Create:      {ID: "watermillchat.index.create", Other: "Create Room"},
+		&data.NamePrompt:  {ID: "watermillchat.index.name", Other: "room-name"},
+		&data.TitlePrompt: {ID: "watermillchat.index.roomTitle", Other: "Title"},
+		&data.TopicPrompt: {ID: "watermillchat.index.topic", Other: "Topic"},
+		&data.Random:      {ID: "watermillchat.index.random", Other: "Join a random private room"},
+	} {
+		if *target, err = l.Localize(&i18n.LocalizeConfig{DefaultMessage: message}); err != nil {
+			return err
+		}
+	}
+	return indexTemplate.Execute(w, data)
+}
+
+// NewIndexHandler renders an [IndexRenderer] page. Room,
+// creation, and random room paths are joined to the prefix.
+func NewIndexHandler(
+	c *watermillchat.Chat,
+	page func(hypermedia.Renderable) hypermedia.Renderable,
+	prefix string,
+	eh hypermedia.ErrorHandler,
+	bundle *i18n.Bundle,
+) http.HandlerFunc {
+	if c == nil {
+		panic("cannot use a <nil> Watermill chat")
+	}
+	if page == nil {
+		panic("cannot use a <nil> page renderer")
+	}
+	if eh == nil {
+		panic("cannot use a <nil> error handler")
+	}
+	if bundle == nil {
+		panic("cannot use a <nil> localization bundle")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		rooms, err := c.PublicRooms(r.Context())
+		if err != nil {
+			eh.HandlerError(w, r, err)
+			return
+		}
+		token, _ := CSRFTokenFromContext(r.Context())
+		hypermedia.NewPage(page(IndexRenderer{
+			RoomPathPrefix: prefix,
+			CreatePath:     prefix + "create",
+			RandomPath:     prefix + "random",
+			CSRFToken:      token,
+			Rooms:          rooms,
+		}), eh, bundle).ServeHTTP(w, r)
+	}
+}
+
+// ReservedRoomNames are paths of the fixed routes registered by
+// [New] under its prefix. Rooms with these names could never be
+// opened, because the fixed routes take precedence.
+var ReservedRoomNames = []string{
+	"api",
+	"attachments",
+	"create",
+	"datastar.js",
+	"datastar.js.map",
+	"index.html",
+	"notifications",
+	"post.js",
+	"random",
+	"search",
+	"send",
+	"style.css",
+	"upload",
+}
+
+var errReservedRoomName = errors.New("room name is reserved")
+
+// NewRoomCreateHandler describes a new public room using submitted
+// "name", "title", and "topic" form values. Responds with the room path.
+// Names listed in [ReservedRoomNames] are refused.
+func NewRoomCreateHandler(
+	c *watermillchat.Chat,
+	roomPathPrefix string,
+	eh hypermedia.ErrorHandler,
+) http.HandlerFunc {
+	if c == nil {
+		panic("cannot use a <nil> Watermill chat")
+	}
+	if eh == nil {
+		panic("cannot use a <nil> error handler")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, DefaultMostSendRequestBytes)
+		if err := r.ParseForm(); err != nil {
+			eh.HandlerError(w, r, err)
+			return
+		}
+		if _, ok := watermillchat.IdentityFromContext(r.Context()); !ok {
+			eh.HandlerError(w, r, hypermedia.ErrForbidden)
+			return
+		}
+		roomName := strings.TrimSpace(r.FormValue("name"))
+		if slices.Contains(ReservedRoomNames, roomName) {
+			eh.HandlerError(w, r, localizeRoomCreateError(
+				fmt.Errorf("%w: %s", errReservedRoomName, roomName)))
+			return
+		}
+		err := c.CreateRoom(r.Context(), watermillchat.RoomMetadata{
+			Name:  roomName,
+			Title: r.FormValue("title"),
+			Topic: r.FormValue("topic"),
+		})
+		if err != nil {
+			eh.HandlerError(w, r, localizeRoomCreateError(err))
+			return
+		}
+		if _, err = io.WriteString(w, roomPathPrefix+url.PathEscape(roomName)); err != nil {
+			eh.HandlerError(w, r, err)
+		}
+	}
+}
+
+func localizeRoomCreateError(err error) error {
+	if errors.Is(err, watermillchat.ErrRoomExists) {
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusConflict,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.RoomExists",
+					Other: "Room with this name already exists",
+				},
+			},
+		}
+	}
+	if errors.Is(err, errReservedRoomName) {
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusUnprocessableEntity,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.ReservedRoomName",
+					Other: "Room name is reserved, please choose another",
+				},
+			},
+		}
+	}
+	var tooLarge *watermillchat.ContentTooLargeError
+	if errors.As(err, &tooLarge) {
+		return &hypermedia.LocalizedError{
+			Cause:      err,
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.RoomMetadataTooLong",
+					Other: "Room details are too long",
+				},
+			},
+		}
+	}
+	return &hypermedia.LocalizedError{
+		Cause:      err,
+		StatusCode: http.StatusUnprocessableEntity,
+		Message: &i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "watermillchat.error.InvalidRoomName",
+				Other: "Room name is invalid",
+			},
+		},
+	}
+}
+
+// NewRandomRoomHandler redirects to a randomly named room
+// that is not loaded, described, or remembered by history.
+func NewRandomRoomHandler(
+	c *watermillchat.Chat,
+	roomPathPrefix string,
+	eh hypermedia.ErrorHandler,
+) http.HandlerFunc {
+	if c == nil {
+		panic("cannot use a <nil> Watermill chat")
+	}
+	if eh == nil {
+		panic("cannot use a <nil> error handler")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		for range DefaultRandomRoomAttempts {
+			roomName := randomRoomName()
+			exists, err := c.RoomExists(r.Context(), roomName)
+			if err != nil {
+				eh.HandlerError(w, r, err)
+				return
+			}
+			if !exists {
+				http.Redirect(w, r, roomPathPrefix+roomName, http.StatusTemporaryRedirect)
+				return
+			}
+		}
+		eh.HandlerError(w, r, fmt.Errorf("unable to find an unused room name after %d attempts", DefaultRandomRoomAttempts))
+	}
+}
+
+func randomRoomName() string {
+	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	result := make([]byte, 32)
+	for i := range result {
+		result[i] = charset[rand.IntN(len(charset))]
+	}
+	return string(result)
+}
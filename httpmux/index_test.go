@@ -0,0 +1,76 @@
+package httpmux_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux"
+)
+
+func TestIndexPage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux, err := httpmux.New(httpmux.Configuration{
+		Chat:          chat,
+		Authenticator: httpmux.NaiveBearerHeaderAuthenticatorUnsafe,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatal("index page was not rendered:", w.Code)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	create := func(name string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(
+			"name="+name+"&title=General+%3Cb%3Etalk%3C%2Fb%3E&topic=anything"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Authorization", "Bearer alice:alice")
+		r.Header.Set(httpmux.DefaultCSRFHeaderName, cookie.Value)
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	if w = create("general"); w.Code != http.StatusOK || w.Body.String() != "/general" {
+		t.Fatal("room was not created:", w.Code, w.Body.String())
+	}
+	if w = create("general"); w.Code != http.StatusConflict {
+		t.Fatal("room was created twice:", w.Code)
+	}
+	if w = create("a%2Fb"); w.Code != http.StatusUnprocessableEntity {
+		t.Fatal("room with a slash in its name was created:", w.Code)
+	}
+	for _, reserved := range httpmux.ReservedRoomNames {
+		if w = create(url.QueryEscape(reserved)); w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("room named like the fixed %q route was created: %d", reserved, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := w.Body.String(); !strings.Contains(body, `href="/general"`) ||
+		!strings.Contains(body, "General &lt;b&gt;talk&lt;/b&gt;") {
+		t.Fatal("created room is not listed:", body)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/random", nil))
+	if location := w.Header().Get("Location"); w.Code != http.StatusTemporaryRedirect || len(location) != 33 {
+		t.Fatal("random room redirect failed:", w.Code, location)
+	}
+}
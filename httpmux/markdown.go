@@ -0,0 +1,235 @@
+package httpmux
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/dkotik/watermillchat"
+	nethtml "golang.org/x/net/html"
+)
+
+var (
+	markdownLinkPattern     = regexp.MustCompile(`\[([^\[\]\n]+)\]\(([^()\s]+)\)`)
+	markdownAutoLinkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"'` + "`" + `]+`)
+	markdownStrongPattern   = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
+	markdownEmphasisPattern = regexp.MustCompile(`\*([^*\n]+)\*`)
+	markdownUnderPattern    = regexp.MustCompile(`(^|[^\p{L}\p{N}_])_([^_\n]+)_($|[^\p{L}\p{N}_])`)
+	mentionPattern          = regexp.MustCompile(`@[\p{L}\p{N}_.\-]+`)
+)
+
+// RenderMarkdown converts message content into safe hyper text. It
+// supports emphasis, strong emphasis, code spans, fenced code blocks,
+// links, and automatic links. Everything else is escaped.
+// The result is passed through an allowlist sanitizer.
+func RenderMarkdown(content string) template.HTML {
+	return RenderMarkdownWithMentions(content, nil)
+}
+
+// RenderMarkdownWithMentions is [RenderMarkdown] that also
+// highlights @name references to mentioned identities.
+func RenderMarkdownWithMentions(content string, mentions []watermillchat.Identity) template.HTML {
+	r := markdownRenderer{Builder: &strings.Builder{}}
+	if len(mentions) > 0 {
+		r.mentions = make(map[string]struct{}, len(mentions))
+		for _, mentioned := range mentions {
+			r.mentions[watermillchat.NormalizeMentionName(mentioned.Name)] = struct{}{}
+		}
+	}
+	b := r.Builder
+	lines := strings.Split(content, "\n")
+	breakLine := false
+	for i := 0; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "```") {
+			end := i + 1
+			for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), "```") {
+				end++
+			}
+			b.WriteString("<pre><code>")
+			b.WriteString(html.EscapeString(strings.Join(lines[i+1:end], "\n")))
+			b.WriteString("</code></pre>")
+			i = end // skip the closing fence
+			breakLine = false
+			continue
+		}
+		if breakLine {
+			b.WriteString("<br>")
+		}
+		r.renderInline(lines[i])
+		breakLine = true
+	}
+	return template.HTML(SanitizeHTML(b.String()))
+}
+
+type markdownRenderer struct {
+	*strings.Builder
+	mentions map[string]struct{}
+}
+
+func (b markdownRenderer) renderInline(line string) {
+	for {
+		start := strings.IndexByte(line, '`')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(line[start+1:], '`')
+		if end < 0 {
+			break
+		}
+		end += start + 1
+		b.renderLinks(line[:start])
+		b.WriteString("<code>")
+		b.WriteString(html.EscapeString(line[start+1 : end]))
+		b.WriteString("</code>")
+		line = line[end+1:]
+	}
+	b.renderLinks(line)
+}
+
+func (b markdownRenderer) renderLinks(text string) {
+	for {
+		if match := markdownLinkPattern.FindStringSubmatchIndex(text); match != nil {
+			if auto := markdownAutoLinkPattern.FindStringIndex(text); auto == nil || auto[0] >= match[0] {
+				b.renderEmphasis(text[:match[0]])
+				label, link := text[match[2]:match[3]], text[match[4]:match[5]]
+				if href, ok := safeLink(link); ok {
+					b.writeAnchor(href, label)
+				} else {
+					b.renderEmphasis(text[match[0]:match[1]])
+				}
+				text = text[match[1]:]
+				continue
+			}
+		}
+		auto := markdownAutoLinkPattern.FindStringIndex(text)
+		if auto == nil {
+			break
+		}
+		link := strings.TrimRight(text[auto[0]:auto[1]], ".,;:!?)")
+		b.renderEmphasis(text[:auto[0]])
+		if href, ok := safeLink(link); ok {
+			b.writeAnchor(href, link)
+		} else {
+			b.WriteString(html.EscapeString(link))
+		}
+		text = text[auto[0]+len(link):]
+	}
+	b.renderEmphasis(text)
+}
+
+func (b markdownRenderer) renderEmphasis(text string) {
+	text = html.EscapeString(text)
+	if len(b.mentions) > 0 {
+		text = mentionPattern.ReplaceAllStringFunc(text, func(match string) string {
+			if _, ok := b.mentions[watermillchat.NormalizeMentionName(strings.TrimRight(match[1:], ".-"))]; ok {
+				return `<span class="mention">` + match + `</span>`
+			}
+			return match
+		})
+	}
+	text = markdownStrongPattern.ReplaceAllString(text, "<strong>$1</strong>")
+	text = markdownEmphasisPattern.ReplaceAllString(text, "<em>$1</em>")
+	text = markdownUnderPattern.ReplaceAllString(text, "$1<em>$2</em>$3")
+	b.WriteString(text)
+}
+
+func (b markdownRenderer) writeAnchor(href, label string) {
+	b.WriteString(`<a href="`)
+	b.WriteString(html.EscapeString(href))
+	b.WriteString(`" rel="nofollow noopener noreferrer" target="_blank">`)
+	b.renderEmphasis(label)
+	b.WriteString("</a>")
+}
+
+// safeLink returns an absolute link, if its scheme is allowed.
+func safeLink(link string) (string, bool) {
+	if strings.HasPrefix(strings.ToLower(link), "www.") {
+		link = "https://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" && u.Scheme != "mailto" {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return u.String(), true
+	default:
+		return "", false
+	}
+}
+
+var sanitizerAllowedAttributes = map[string]map[string]bool{
+	"a":      {"href": true, "rel": true, "target": true},
+	"br":     nil,
+	"code":   nil,
+	"em":     nil,
+	"pre":    nil,
+	"span":   {"class": true},
+	"strong": nil,
+}
+
+var sanitizerAllowedClasses = map[string]bool{
+	"mention": true,
+}
+
+// SanitizeHTML removes every element and attribute that is
+// not on the allowlist. Text content of removed elements is escaped.
+// Links are restricted to safe schemes.
+func SanitizeHTML(fragment string) string {
+	b := &strings.Builder{}
+	tokenizer := nethtml.NewTokenizer(strings.NewReader(fragment))
+	var open []string
+
+	for {
+		switch tokenizer.Next() {
+		case nethtml.ErrorToken:
+			for i := len(open) - 1; i >= 0; i-- {
+				b.WriteString("</" + open[i] + ">")
+			}
+			return b.String()
+		case nethtml.TextToken:
+			b.WriteString(html.EscapeString(string(tokenizer.Text())))
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			token := tokenizer.Token()
+			allowed, ok := sanitizerAllowedAttributes[token.Data]
+			if !ok {
+				continue
+			}
+			b.WriteString("<" + token.Data)
+			for _, attribute := range token.Attr {
+				if attribute.Namespace != "" || !allowed[attribute.Key] {
+					continue
+				}
+				value := attribute.Val
+				switch attribute.Key {
+				case "href":
+					if value, ok = safeLink(value); !ok {
+						continue
+					}
+				case "class":
+					if !sanitizerAllowedClasses[value] {
+						continue
+					}
+				}
+				b.WriteString(" " + attribute.Key + `="` + html.EscapeString(value) + `"`)
+			}
+			b.WriteString(">")
+			if token.Data != "br" {
+				open = append(open, token.Data)
+			}
+		case nethtml.EndTagToken:
+			name := tokenizer.Token().Data
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == name {
+					for j := len(open) - 1; j >= i; j-- {
+						b.WriteString("</" + open[j] + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		}
+	}
+}
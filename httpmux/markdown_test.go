@@ -0,0 +1,99 @@
+package httpmux_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux"
+	"golang.org/x/net/html"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	for content, expected := range map[string]string{
+		"plain & simple":                        "plain &amp; simple",
+		"**bold** and *italic*":                 "<strong>bold</strong> and <em>italic</em>",
+		"_under_ but snake_case_x":              "<em>under</em> but snake_case_x",
+		"run `rm -rf *` now":                    "run <code>rm -rf *</code> now",
+		"one\ntwo":                              "one<br>two",
+		"```\n<b>\n```\nafter":                  "<pre><code>&lt;b&gt;</code></pre>after",
+		"[docs](https://example.com/a?b=c&d=e)": `<a href="https://example.com/a?b=c&amp;d=e" rel="nofollow noopener noreferrer" target="_blank">docs</a>`,
+		"see https://example.com.":              `see <a href="https://example.com" rel="nofollow noopener noreferrer" target="_blank">https://example.com</a>.`,
+		"www.example.com":                       `<a href="https://www.example.com" rel="nofollow noopener noreferrer" target="_blank">www.example.com</a>`,
+	} {
+		if rendered := string(httpmux.RenderMarkdown(content)); rendered != expected {
+			t.Errorf("markdown %q rendered as %q instead of %q", content, rendered, expected)
+		}
+	}
+}
+
+func TestRenderMarkdownHostilePayloads(t *testing.T) {
+	for _, payload := range []string{
+		`<script>alert(1)</script>`,
+		`<img src=x onerror=alert(1)>`,
+		`"><svg onload=alert(1)>`,
+		`[click](javascript:alert(1))`,
+		`[click](JaVaScRiPt:alert(1))`,
+		`[click](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)`,
+		`[x](https://example.com/"onmouseover="alert(1))`,
+		`https://example.com/"onmouseover="alert(1)`,
+		"`</code><script>alert(1)</script>`",
+		"```\n</code></pre><script>alert(1)</script>",
+		`**<iframe src="https://evil.test">**`,
+		`<a href="javascript:alert(1)">x</a>`,
+		`&lt;script&gt;alert(1)&lt;/script&gt;`,
+	} {
+		assertNoScripts(t, payload, string(httpmux.RenderMarkdown(payload)))
+	}
+}
+
+func TestSanitizeHTML(t *testing.T) {
+	for fragment, expected := range map[string]string{
+		`<strong onclick="x()">ok</strong>`:    "<strong>ok</strong>",
+		`<script>alert(1)</script>`:            "alert(1)",
+		`<a href="javascript:alert(1)">x</a>`:  "<a>x</a>",
+		`<em>unclosed`:                         "<em>unclosed</em>",
+		`<div><code>nested</code></div>`:       "<code>nested</code>",
+		`<a href="https://example.com">ok</a>`: `<a href="https://example.com">ok</a>`,
+	} {
+		if sanitized := httpmux.SanitizeHTML(fragment); sanitized != expected {
+			t.Errorf("fragment %q sanitized as %q instead of %q", fragment, sanitized, expected)
+		}
+	}
+}
+
+func assertNoScripts(t *testing.T, payload, rendered string) {
+	t.Helper()
+	tokenizer := html.NewTokenizer(strings.NewReader(rendered))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "script", "img", "svg", "iframe", "object", "embed", "style":
+				t.Fatalf("payload %q produced element <%s>: %s", payload, token.Data, rendered)
+			}
+			for _, attribute := range token.Attr {
+				if strings.HasPrefix(attribute.Key, "on") {
+					t.Fatalf("payload %q produced event handler %q: %s", payload, attribute.Key, rendered)
+				}
+				if attribute.Key == "href" && !strings.HasPrefix(attribute.Val, "https://") {
+					t.Fatalf("payload %q produced unsafe link %q: %s", payload, attribute.Val, rendered)
+				}
+			}
+		}
+	}
+}
+
+func TestRenderMarkdownWithMentions(t *testing.T) {
+	rendered := string(httpmux.RenderMarkdownWithMentions(
+		"hi @AliceSmith and @nobody.",
+		[]watermillchat.Identity{{ID: "alice", Name: "Alice Smith"}},
+	))
+	expected := `hi <span class="mention">@AliceSmith</span> and @nobody.`
+	if rendered != expected {
+		t.Fatalf("mentions rendered as %q instead of %q", rendered, expected)
+	}
+}
@@ -2,30 +2,219 @@ package httpmux
 
 import (
 	"bytes"
+	"cmp"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
-	"text/template"
-	"time"
 
-	"github.com/ThreeDotsLabs/watermill"
 	"github.com/dkotik/watermillchat"
 	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
 	datastar "github.com/starfederation/datastar/code/go/sdk"
 )
 
-var messageTemplate = template.Must(template.New("message").Parse(
-	`<div class="message" data-scroll-into-view.smooth.vend>
+// DefaultMostSendRequestBytes limits the size of the form
+// submitted to [NewMessageSendHandler]. Message content is further
+// constrained by [watermillchat.ValidationConfiguration].
+const DefaultMostSendRequestBytes = 1 << 16
+
+var messageTemplate = template.Must(template.New("message").Funcs(template.FuncMap{
+	"attachmentLink": attachmentLink,
+}).Parse(
+	`<div id="message-{{ .ID }}" class="message{{ if .Ephemeral }} ephemeral{{ end }}{{ if .Action }} action{{ end }}"{{ if not .Updated }} data-scroll-into-view.smooth.vend{{ end }}>
   <p class="author{{if .System}} system{{end}}">{{ with .Author }}{{or .Name "???"}}{{else}}???{{end}}</p>
-  <p class="content">{{- .Content -}}</p>
+  <div class="content">{{- .Content -}}</div>
+  {{- with .Edited }}
+  <p class="edited">{{ . }}</p>
+  {{- end }}
+  {{- with .Visibility }}
+  <p class="visibility">{{ . }}</p>
+  {{- end }}
+  {{- with .Attachments }}
+  <div class="attachments">
+    {{- range . }}
+    {{- if .IsImage }}
+    <a href="{{ attachmentLink $.PathPrefix . }}" target="_blank"><img class="thumbnail" src="{{ attachmentLink $.PathPrefix . }}" alt="{{ .Name }}" loading="lazy"></a>
+    {{- else }}
+    <a class="download" href="{{ attachmentLink $.PathPrefix . }}" download="{{ .Name }}">{{ .Name }}</a>
+    {{- end }}
+    {{- end }}
+  </div>
+  {{- end }}
+  {{- range .Previews }}
+  <a class="preview" href="{{ .URL }}" rel="nofollow noopener noreferrer" target="_blank">
+    {{- if .Image }}
+    <img src="{{ .Image }}" alt="" loading="lazy" referrerpolicy="no-referrer">
+    {{- end }}
+    {{- with .SiteName }}
+    <span class="site">{{ . }}</span>
+    {{- end }}
+    {{- with .Title }}
+    <strong>{{ . }}</strong>
+    {{- end }}
+    {{- with .Description }}
+    <span class="description">{{ . }}</span>
+    {{- end }}
+  </a>
+  {{- end }}
+  {{- with .Reactions }}
+  <div class="reactions">
+    {{- range . }}
+    <span class="reaction" title="{{ range $i, $author := .Authors }}{{ if $i }}, {{ end }}{{ $author.Name }}{{ end }}">{{ .Emoji }} {{ len .Authors }}</span>
+    {{- end }}
+  </div>
+  {{- end }}
 </div>`))
 
+var pinnedTemplate = template.Must(template.New("pinned").Funcs(template.FuncMap{
+	"excerpt": excerpt,
+}).Parse(
+	`<section id="pinned">
+  {{- range . }}
+  <a class="pin" href="#message-{{ .ID }}">
+    <span class="author">{{ with .Author }}{{ or .Name "???" }}{{ else }}???{{ end }}</span>
+    <span class="excerpt">{{ excerpt .Content }}</span>
+  </a>
+  {{- end }}
+</section>`))
+
+var typingTemplate = template.Must(template.New("typing").Parse(
+	`<p id="typing">{{ . }}</p>`))
+
+// renderTyping lists identities that are typing.
+func renderTyping(w io.Writer, l *i18n.Localizer, identities []watermillchat.Identity) {
+	text := ""
+	if len(identities) > 0 {
+		names := make([]string, len(identities))
+		for i, identity := range identities {
+			names[i] = cmp.Or(identity.Name, "???")
+		}
+		text = localize(l, &i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "watermillchat.typing",
+				One:   "{{.Names}} is typing…",
+				Other: "{{.Names}} are typing…",
+			},
+			PluralCount: len(identities),
+			TemplateData: map[string]any{
+				"Names": strings.Join(names, ", "),
+			},
+		})
+	}
+	if err := typingTemplate.Execute(w, text); err != nil {
+		panic(fmt.Errorf("typing template execution failed: %w", err))
+	}
+}
+
+var restartNoticeTemplate = template.Must(template.New("restart").Parse(
+	`<div class="message notice" data-scroll-into-view.smooth.vend><p class="content">{{ . }}</p></div>`))
+
+// restartScript reloads the page after a pause,
+// which reconnects the stream to a running server.
+const restartScript = `setTimeout(() => window.location.reload(), 3000 + Math.random() * 2000)`
+
+// sendRestartNotice tells the client to reconnect,
+// because the chat is closing.
+func sendRestartNotice(sse *datastar.ServerSentEventGenerator, l *i18n.Localizer) {
+	b := &bytes.Buffer{}
+	if err := restartNoticeTemplate.Execute(b, localize(l, &i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "watermillchat.restarting",
+			Other: "Server is restarting, reconnecting…",
+		},
+	})); err != nil {
+		panic(fmt.Errorf("restart notice template execution failed: %w", err))
+	}
+	err := sse.MergeFragments(
+		b.String(),
+		datastar.WithSelector(".messages"),
+		datastar.WithMergeAppend(),
+	)
+	if err == nil {
+		err = sse.ExecuteScript(restartScript)
+	}
+	if err != nil {
+		slog.DebugContext(sse.Context(), "failed to deliver server sent event to the client", slog.Any("error", err))
+	}
+}
+
+// withEventID sets the identifier that the client sends
+// back in the Last-Event-ID header when it reconnects.
+func withEventID(id string) datastar.MergeFragmentOption {
+	return func(o *datastar.MergeFragmentOptions) {
+		o.EventID = id
+	}
+}
+
+// renderMessage links attachments under the path prefix of the mux.
+// localize falls back on the default message, which go-i18n
+// returns with an error for languages missing a translation.
+func localize(l *i18n.Localizer, c *i18n.LocalizeConfig) string {
+	if message, _ := l.Localize(c); message != "" {
+		return message
+	}
+	return c.DefaultMessage.Other
+}
+
+func renderMessage(w io.Writer, l *i18n.Localizer, message watermillchat.Message, pathPrefix string, updated bool) {
+	edited, visibility := "", ""
+	if message.UpdatedAt > 0 {
+		edited = localize(l, &i18n.LocalizeConfig{DefaultMessage: &i18n.Message{
+			ID:    "watermillchat.message.edited",
+			Other: "edited",
+		}})
+	}
+	if message.Ephemeral {
+		visibility = localize(l, &i18n.LocalizeConfig{DefaultMessage: &i18n.Message{
+			ID:    "watermillchat.message.private",
+			Other: "only visible to you",
+		}})
+	}
+	if err := messageTemplate.Execute(w, struct {
+		PathPrefix  string
+		ID          string
+		Author      *watermillchat.Identity
+		Content     template.HTML
+		System      bool
+		Action      bool
+		Ephemeral   bool
+		Updated     bool
+		Edited      string
+		Visibility  string
+		Attachments []watermillchat.Attachment
+		Previews    []watermillchat.LinkPreview
+		Reactions   []watermillchat.Reaction
+	}{
+		PathPrefix:  pathPrefix,
+		ID:          message.ID,
+		Author:      message.Author,
+		Content:     RenderMarkdownWithMentions(message.Content, message.Mentions),
+		System:      message.Author == nil,
+		Action:      message.Action && message.Author != nil,
+		Ephemeral:   message.Ephemeral,
+		Updated:     updated,
+		Edited:      edited,
+		Visibility:  visibility,
+		Attachments: message.Attachments,
+		Previews:    message.Previews,
+		Reactions:   message.Reactions,
+	}); err != nil {
+		panic(fmt.Errorf("message template execution failed: %w", err))
+	}
+}
+
 func NewRoomMessagesHandler(
 	c *watermillchat.Chat,
 	selector RoomSelector,
+	streams *Streams,
 	eh hypermedia.ErrorHandler,
+	bundle *i18n.Bundle,
 ) http.HandlerFunc {
 	if c == nil {
 		panic("cannot use a <nil> Watermill chat")
@@ -33,9 +222,15 @@ func NewRoomMessagesHandler(
 	if selector == nil {
 		panic("cannot use a <nil> selector")
 	}
+	if streams == nil {
+		panic("cannot use a <nil> stream limiter")
+	}
 	if eh == nil {
 		panic("cannot use a <nil> error handler")
 	}
+	if bundle == nil {
+		panic("cannot use a <nil> localization bundle")
+	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		roomName, err := selector(r)
@@ -43,42 +238,158 @@ func NewRoomMessagesHandler(
 			eh.HandlerError(w, r, err)
 			return
 		}
-		sse := datastar.NewSSE(w, r)
-		if err = sse.RemoveFragments("section.messages > .message"); err != nil {
+		stream, err := streams.open(r)
+		if err != nil {
 			eh.HandlerError(w, r, err)
 			return
 		}
+		defer stream.close()
+		l := i18n.NewLocalizer(bundle, r.Header.Get("Accept-Language"))
+
+		var messages <-chan []watermillchat.Message
+		lastEventID := r.Header.Get("Last-Event-ID")
+		replaying := false
+		if lastEventID != "" {
+			messages, replaying = c.SubscribeAfter(r.Context(), roomName, lastEventID)
+		} else {
+			messages = c.Subscribe(r.Context(), roomName)
+		}
+
+		sse := datastar.NewSSE(w, r)
+		if !replaying {
+			// client did not keep the messages or missed too many
+			if err = sse.RemoveFragments("section.messages > .message"); err != nil {
+				eh.HandlerError(w, r, err)
+				return
+			}
+		}
 		b := &bytes.Buffer{}
+		seen := make(map[string]struct{})
+		lastAppended := ""
 
-		for batch := range c.Subscribe(r.Context(), roomName) {
-			for _, message := range batch {
-				if err = messageTemplate.Execute(b, struct {
-					Author  *watermillchat.Identity
-					Content string
-					System  bool
-				}{
-					Author:  message.Author,
-					Content: message.Content,
-					System:  message.Author == nil,
-				}); err != nil {
-					panic(fmt.Errorf("message template execution failed: %w", err))
+		pinned := c.SubscribePinned(r.Context(), roomName)
+		typing := c.SubscribeTyping(r.Context(), roomName)
+		metadata := c.SubscribeRoomMetadata(r.Context(), roomName)
+		for {
+			select {
+			case <-c.Closing():
+				sendRestartNotice(sse, l)
+				return
+			case <-stream.expired:
+				stream.expire(w)
+			case <-stream.heartbeat.C():
+				if err = stream.beat(w); err != nil {
+					slog.DebugContext(r.Context(), "failed to deliver server sent event to the client", slog.Any("error", err))
+				}
+			case m, ok := <-metadata:
+				if !ok {
+					metadata = nil
+					continue
+				}
+				if err = roomHeaderTemplate.Execute(b, m); err != nil {
+					panic(fmt.Errorf("room header template execution failed: %w", err))
+				}
+				if err = roomTopicTemplate.Execute(b, m); err != nil {
+					panic(fmt.Errorf("room topic template execution failed: %w", err))
+				}
+				if err = sse.MergeFragments(b.String()); err != nil {
+					slog.DebugContext(r.Context(), "failed to deliver server sent event to the client", slog.Any("error", err))
+				}
+				b.Reset()
+			case set, ok := <-pinned:
+				if !ok {
+					pinned = nil
+					continue
+				}
+				if err = pinnedTemplate.Execute(b, set); err != nil {
+					panic(fmt.Errorf("pinned message template execution failed: %w", err))
+				}
+				if err = sse.MergeFragments(b.String()); err != nil {
+					slog.DebugContext(r.Context(), "failed to deliver server sent event to the client", slog.Any("error", err))
+				}
+				b.Reset()
+			case identities, ok := <-typing:
+				if !ok {
+					typing = nil
+					continue
+				}
+				renderTyping(b, l, identities)
+				if err = sse.MergeFragments(b.String()); err != nil {
+					slog.DebugContext(r.Context(), "failed to deliver server sent event to the client", slog.Any("error", err))
+				}
+				b.Reset()
+			case batch, ok := <-messages:
+				if !ok {
+					select {
+					case <-c.Closing():
+						sendRestartNotice(sse, l)
+					default:
+					}
+					return
+				}
+				if replaying {
+					// skip messages the client received before reconnecting
+					replaying = false
+					if i := slices.IndexFunc(batch, func(m watermillchat.Message) bool {
+						return m.ID == lastEventID
+					}); i >= 0 {
+						for _, message := range batch[:i+1] {
+							seen[message.ID] = struct{}{}
+						}
+						batch = batch[i+1:]
+					}
+				}
+				latest := make(map[string]int, len(batch))
+				for i, message := range batch {
+					latest[message.ID] = i
+				}
+				for i, message := range batch {
+					if latest[message.ID] != i {
+						continue // a newer version follows in the same batch
+					}
+					if _, ok := seen[message.ID]; ok && message.ID != "" {
+						// morph the rendered message, which is matched by its identifier;
+						// attachment links are relative to the room page
+						renderMessage(b, l, message, "", true)
+						if err = sse.MergeFragments(b.String()); err != nil {
+							slog.DebugContext(r.Context(), "failed to deliver server sent event to the client", slog.Any("error", err))
+						}
+						b.Reset()
+						continue
+					}
+					seen[message.ID] = struct{}{}
+					renderMessage(b, l, message, "", false)
+					if !message.Ephemeral { // not replayed
+						lastAppended = message.ID
+					}
+				}
+				if b.Len() == 0 {
+					continue
 				}
-			}
 
-			if err = sse.MergeFragments(
-				b.String(),
-				datastar.WithSelector(".messages"),
-				datastar.WithMergeAppend(),
-			); err != nil {
-				slog.DebugContext(r.Context(), "failed to deliver server sent event to the client", slog.Any("error", err))
+				// updates do not carry event identifiers, because
+				// reconnecting clients resume after the last new message,
+				// which is the newest one, since batches are oldest first
+				if err = sse.MergeFragments(
+					b.String(),
+					datastar.WithSelector(".messages"),
+					datastar.WithMergeAppend(),
+					withEventID(lastAppended),
+				); err != nil {
+					slog.DebugContext(r.Context(), "failed to deliver server sent event to the client", slog.Any("error", err))
+				}
+				b.Reset()
 			}
-			b.Reset()
 		}
 	}
 }
 
+// NewMessageSendHandler broadcasts submitted message content.
+// Attachments are resolved using the [watermillchat.BlobStore],
+// which can be <nil> to disable them.
 func NewMessageSendHandler(
 	c *watermillchat.Chat,
+	store watermillchat.BlobStore,
 	eh hypermedia.ErrorHandler,
 ) http.HandlerFunc {
 	if c == nil {
@@ -88,6 +399,24 @@ func NewMessageSendHandler(
 		panic("cannot use a <nil> error handler")
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, DefaultMostSendRequestBytes)
+		if err := r.ParseForm(); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				err = &hypermedia.LocalizedError{
+					Cause:      err,
+					StatusCode: http.StatusRequestEntityTooLarge,
+					Message: &i18n.LocalizeConfig{
+						DefaultMessage: &i18n.Message{
+							ID:    "watermillchat.error.RequestTooLarge",
+							Other: "Message is too long",
+						},
+					},
+				}
+			}
+			eh.HandlerError(w, r, err)
+			return
+		}
 		identity, ok := watermillchat.IdentityFromContext(r.Context())
 		if !ok {
 			eh.HandlerError(w, r, hypermedia.ErrForbidden)
@@ -99,20 +428,28 @@ func NewMessageSendHandler(
 			return
 		}
 
-		m := watermillchat.Message{
-			ID:        watermill.NewULID(),
-			Author:    &identity,
-			Content:   strings.TrimSpace(r.FormValue("content")),
-			CreatedAt: time.Now().Unix(),
+		attachments, err := resolveAttachments(r, store, identity)
+		if err != nil {
+			eh.HandlerError(w, r, localizeBroadcastError(err))
+			return
 		}
 
-		// err := c.Send(r.Context(), r.FormValue("roomName"), m)
-		err := c.Broadcast(r.Context(), watermillchat.Broadcast{
+		m, err := c.Send(r.Context(), watermillchat.Broadcast{
 			RoomName: roomName,
-			Message:  m,
+			Message: watermillchat.Message{
+				Author:      &identity,
+				Content:     strings.TrimSpace(r.FormValue("content")),
+				CreatedAt:   c.Clock().Now().Unix(),
+				Attachments: attachments,
+			},
 		})
 		if err != nil {
-			eh.HandlerError(w, r, err)
+			var rateLimited *watermillchat.RateLimitError
+			if errors.As(err, &rateLimited) {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(rateLimited)))
+			}
+			eh.HandlerError(w, r, localizeBroadcastError(err))
+			return
 		}
 		if _, err = io.WriteString(w, m.ID); err != nil {
 			eh.HandlerError(w, r, err)
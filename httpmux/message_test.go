@@ -0,0 +1,274 @@
+package httpmux_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+func TestRoomMessagesRestartNotice(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := httpmux.NewRoomMessagesHandler(
+		chat,
+		httpmux.NewRoomSelectorFromURLQueryValue("room"),
+		newStreams(t, httpmux.StreamConfiguration{}),
+		hypermedia.PlainTextErrorHandler,
+		i18n.NewBundle(hypermedia.DefaultLanguage),
+	)
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/messages?room=lobby", nil).WithContext(ctx))
+	}()
+	if err = chat.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("stream did not end when the chat closed")
+	case <-done:
+	}
+	if body := w.Body.String(); !strings.Contains(body, "restarting") || !strings.Contains(body, "window.location.reload") {
+		t.Fatal("restart notice was not sent:", body)
+	}
+}
+
+func TestRoomMessagesLocalizesNotices(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := i18n.NewBundle(hypermedia.DefaultLanguage)
+	if err = bundle.AddMessages(language.German, &i18n.Message{
+		ID:    "watermillchat.restarting",
+		Other: "Server startet neu, verbinde erneut…",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	handler := httpmux.NewRoomMessagesHandler(
+		chat,
+		httpmux.NewRoomSelectorFromURLQueryValue("room"),
+		newStreams(t, httpmux.StreamConfiguration{}),
+		hypermedia.PlainTextErrorHandler,
+		bundle,
+	)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/messages?room=lobby", nil).WithContext(ctx)
+	r.Header.Set("Accept-Language", "de")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(w, r)
+	}()
+	if err = chat.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("stream did not end when the chat closed")
+	case <-done:
+	}
+	if body := w.Body.String(); !strings.Contains(body, "Server startet neu") {
+		t.Fatal("restart notice was not localized:", body)
+	}
+}
+
+// readStream collects server sent events until the text appears.
+func readStream(t *testing.T, scanner *bufio.Scanner, text string) (received string) {
+	t.Helper()
+	for scanner.Scan() {
+		received += scanner.Text() + "\n"
+		if strings.Contains(received, text) {
+			return received
+		}
+	}
+	t.Fatalf("stream ended before %q was received: %s", text, received)
+	return ""
+}
+
+func TestRoomMessagesReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	// broadcasts reach the room in order before publishing returns
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		BlockPublishUntilSubscriberAck: true,
+	}, watermill.NopLogger{})
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		Watermill: watermillchat.WatermillConfiguration{
+			Publisher:  pubSub,
+			Subscriber: pubSub,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(httpmux.NewRoomMessagesHandler(
+		chat,
+		httpmux.NewRoomSelectorFromURLQueryValue("room"),
+		newStreams(t, httpmux.StreamConfiguration{}),
+		hypermedia.PlainTextErrorHandler,
+		i18n.NewBundle(hypermedia.DefaultLanguage),
+	))
+	defer server.Close()
+	streamCtx, stop := context.WithCancel(ctx)
+	defer stop() // before the server waits for streams to end
+
+	broadcast := func(content string) {
+		t.Helper()
+		if err := chat.Broadcast(ctx, watermillchat.Broadcast{
+			RoomName: "lobby",
+			Message:  watermillchat.Message{Content: content},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	connect := func(ctx context.Context, lastEventID string) *bufio.Scanner {
+		t.Helper()
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/messages?room=lobby", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastEventID != "" {
+			request.Header.Set("Last-Event-ID", lastEventID)
+		}
+		response, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { response.Body.Close() })
+		return bufio.NewScanner(response.Body)
+	}
+
+	broadcast("alpha")
+	firstCtx, disconnect := context.WithCancel(streamCtx)
+	received := readStream(t, connect(firstCtx, ""), "alpha")
+	disconnect() // in the middle of the stream
+
+	lastEventID := ""
+	for _, line := range strings.Split(received, "\n") {
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			lastEventID = id
+		}
+	}
+	if lastEventID == "" {
+		t.Fatal("message events do not carry identifiers:", received)
+	}
+
+	broadcast("bravo")
+	broadcast("charlie")
+	received = readStream(t, connect(streamCtx, lastEventID), "charlie")
+	if !strings.Contains(received, "bravo") {
+		t.Fatal("missed message was not replayed:", received)
+	}
+	if strings.Contains(received, "alpha") {
+		t.Fatal("received message was replayed:", received)
+	}
+	if strings.Contains(received, "remove-fragments") {
+		t.Fatal("messages were reset for a client that reconnected:", received)
+	}
+
+	// replayed batch carries the identifier of its newest message
+	for _, line := range strings.Split(received, "\n") {
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			lastEventID = id
+		}
+	}
+	broadcast("delta")
+	received = readStream(t, connect(streamCtx, lastEventID), "delta")
+	if strings.Contains(received, "bravo") || strings.Contains(received, "charlie") {
+		t.Fatal("messages of a replayed batch were replayed again:", received)
+	}
+}
+
+func TestMessageSendRespondsWithPublishedID(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	// every broadcast reaches the room before publishing returns
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		BlockPublishUntilSubscriberAck: true,
+	}, watermill.NopLogger{})
+	clock := watermillchat.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		Watermill: watermillchat.WatermillConfiguration{
+			Publisher:  pubSub,
+			Subscriber: pubSub,
+		},
+		Clock: clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := httpmux.NaiveBearerHeaderAuthenticatorUnsafe(httpmux.NewMessageSendHandler(
+		chat, nil, hypermedia.PlainTextErrorHandler))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/send", strings.NewReader("roomName=lobby&content=hello"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "Bearer alice:Alice")
+	handler.ServeHTTP(w, r.WithContext(ctx))
+	if w.Code != http.StatusOK {
+		t.Fatal("message was not sent:", w.Code, w.Body.String())
+	}
+
+	page, _, err := chat.RoomHistory(ctx, "lobby", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].ID != w.Body.String() {
+		t.Fatalf("response %q does not identify the published message: %+v", w.Body.String(), page)
+	}
+	if page[0].CreatedAt != clock.Now().Unix() {
+		t.Fatal("message time does not come from the chat clock:", page[0].CreatedAt)
+	}
+}
+
+func TestMessageSendReportsHeldMessages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		Moderation: watermillchat.ModerationConfiguration{
+			Filters: []watermillchat.MessageFilter{
+				watermillchat.MessageFilterFunc(func(ctx context.Context, b watermillchat.Broadcast) (watermillchat.Broadcast, watermillchat.Decision, error) {
+					return b, watermillchat.DecisionHold, nil
+				}),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := httpmux.NaiveBearerHeaderAuthenticatorUnsafe(httpmux.NewMessageSendHandler(
+		chat, nil, hypermedia.NewPlainTextErrorHandler(i18n.NewBundle(hypermedia.DefaultLanguage))))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/send", strings.NewReader("roomName=lobby&content=hello"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "Bearer alice:Alice")
+	handler.ServeHTTP(w, r.WithContext(ctx))
+	// the send form treats every successful response as posted
+	if w.Code < 300 || !strings.Contains(w.Body.String(), "after a moderator reviews it") {
+		t.Fatal("held message was reported as posted:", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,112 @@
+package httpmux
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+var roomHeaderTemplate = template.Must(template.New("roomHeader").Parse(
+	`<span id="room-title">{{ .DisplayTitle }}</span>`))
+
+var roomTopicTemplate = template.Must(template.New("roomTopic").Parse(
+	`<p id="room-topic" class="topic">{{ .Topic }}</p>`))
+
+// NewRoomMetadataHandler updates room title, topic, and description
+// from submitted form values. Only the creator of the room can change
+// it after it was first described.
+func NewRoomMetadataHandler(
+	c *watermillchat.Chat,
+	selector RoomSelector,
+	eh hypermedia.ErrorHandler,
+) http.HandlerFunc {
+	if c == nil {
+		panic("cannot use a <nil> Watermill chat")
+	}
+	if selector == nil {
+		panic("cannot use a <nil> selector")
+	}
+	if eh == nil {
+		panic("cannot use a <nil> error handler")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, DefaultMostSendRequestBytes)
+		if err := r.ParseForm(); err != nil {
+			eh.HandlerError(w, r, err)
+			return
+		}
+		identity, ok := watermillchat.IdentityFromContext(r.Context())
+		if !ok {
+			eh.HandlerError(w, r, hypermedia.ErrForbidden)
+			return
+		}
+		roomName, err := selector(r)
+		if err != nil {
+			eh.HandlerError(w, r, hypermedia.ErrNotFound)
+			return
+		}
+		existing, err := c.RoomMetadata(r.Context(), roomName)
+		if err != nil {
+			eh.HandlerError(w, r, err)
+			return
+		}
+		if existing.Creator != nil && existing.Creator.ID != identity.ID {
+			eh.HandlerError(w, r, hypermedia.ErrForbidden)
+			return
+		}
+
+		if err = c.UpdateRoomMetadata(r.Context(), watermillchat.RoomMetadata{
+			Name:        roomName,
+			Title:       r.FormValue("title"),
+			Topic:       r.FormValue("topic"),
+			Description: r.FormValue("description"),
+		}); err != nil {
+			var tooLarge *watermillchat.ContentTooLargeError
+			if errors.As(err, &tooLarge) {
+				err = &hypermedia.LocalizedError{
+					Cause:      err,
+					StatusCode: http.StatusRequestEntityTooLarge,
+					Message: &i18n.LocalizeConfig{
+						DefaultMessage: &i18n.Message{
+							ID:    "watermillchat.error.RoomMetadataTooLong",
+							Other: "Room details are too long",
+						},
+					},
+				}
+			}
+			eh.HandlerError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// roomHead names the page after the room.
+func roomHead(head hypermedia.Head, m watermillchat.RoomMetadata) hypermedia.Head {
+	head.Title = &i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "watermillchat.room.title",
+			Other: "{{.Title}} · Watermill Chat",
+		},
+		TemplateData: map[string]any{
+			"Title": m.DisplayTitle(),
+		},
+	}
+	if m.Topic != "" {
+		head.Description = &i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "watermillchat.room.description",
+				Other: "{{.Topic}}",
+			},
+			TemplateData: map[string]any{
+				"Topic": m.Topic,
+			},
+		}
+	}
+	return head
+}
@@ -0,0 +1,104 @@
+package httpmux
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	datastar "github.com/starfederation/datastar/code/go/sdk"
+)
+
+const excerptLength = 80
+
+// excerpt shortens message content for notifications and banners.
+func excerpt(content string) string {
+	if utf8.RuneCountInString(content) > excerptLength {
+		return string([]rune(content)[:excerptLength]) + "…"
+	}
+	return content
+}
+
+var notificationTemplate = template.Must(template.New("notification").Parse(
+	`<div class="notification">
+  <a href="{{ .Link }}"><span class="author">{{ with .Author }}{{ or .Name "???" }}{{ else }}???{{ end }}</span> @ {{ .RoomName }}</a>
+  <p class="excerpt">{{ .Excerpt }}</p>
+</div>`))
+
+// NewNotificationsHandler streams a notification fragment
+// every time the authenticated identity is mentioned in any room.
+// Links point to rooms by appending room name to the prefix.
+func NewNotificationsHandler(
+	c *watermillchat.Chat,
+	roomPathPrefix string,
+	streams *Streams,
+	eh hypermedia.ErrorHandler,
+) http.HandlerFunc {
+	if c == nil {
+		panic("cannot use a <nil> Watermill chat")
+	}
+	if streams == nil {
+		panic("cannot use a <nil> stream limiter")
+	}
+	if eh == nil {
+		panic("cannot use a <nil> error handler")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := watermillchat.IdentityFromContext(r.Context())
+		if !ok {
+			eh.HandlerError(w, r, hypermedia.ErrForbidden)
+			return
+		}
+		stream, err := streams.open(r)
+		if err != nil {
+			eh.HandlerError(w, r, err)
+			return
+		}
+		defer stream.close()
+		sse := datastar.NewSSE(w, r)
+		b := &bytes.Buffer{}
+
+		mentions := c.SubscribeMentions(r.Context(), identity.ID)
+		for {
+			select {
+			case <-stream.expired:
+				stream.expire(w)
+			case <-stream.heartbeat.C():
+				if err = stream.beat(w); err != nil {
+					slog.DebugContext(r.Context(), "failed to deliver server sent event to the client", slog.Any("error", err))
+				}
+			case mention, ok := <-mentions:
+				if !ok {
+					return
+				}
+				if err = notificationTemplate.Execute(b, struct {
+					Link     string
+					Author   *watermillchat.Identity
+					RoomName string
+					Excerpt  string
+				}{
+					Link:     roomPathPrefix + url.PathEscape(mention.RoomName),
+					Author:   mention.Message.Author,
+					RoomName: mention.RoomName,
+					Excerpt:  excerpt(mention.Message.Content),
+				}); err != nil {
+					panic(fmt.Errorf("notification template execution failed: %w", err))
+				}
+				if err = sse.MergeFragments(
+					b.String(),
+					datastar.WithSelector("#notifications"),
+					datastar.WithMergeAppend(),
+				); err != nil {
+					slog.DebugContext(r.Context(), "failed to deliver server sent event to the client", slog.Any("error", err))
+				}
+				b.Reset()
+			}
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package httpmux
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+)
+
+// apiOperation is a JSON API route together with
+// its description for the OpenAPI document.
+type apiOperation struct {
+	Method      string
+	Path        string
+	ID          string
+	Summary     string
+	Description string
+	Query       []apiParameter
+	// Request and Response are types of JSON bodies.
+	// Request is <nil> for operations without a body.
+	Request    reflect.Type
+	Response   reflect.Type
+	StatusCode int
+	// Accepted describes the [http.StatusAccepted] response
+	// without a body, if the operation has one.
+	Accepted string
+	// ContentType of the response. Defaults to "application/json".
+	ContentType string
+	Handler     http.Handler
+}
+
+type apiParameter struct {
+	Name        string
+	Description string
+	Integer     bool
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 any                       `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AnyOf                []*openAPISchema          `json:"anyOf,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIContent map[string]struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIBody struct {
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Content     openAPIContent `json:"content,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  []openAPIParameter     `json:"parameters,omitempty"`
+	RequestBody *openAPIBody           `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIBody `json:"responses"`
+}
+
+type openAPIDocument struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]*openAPISchema `json:"schemas"`
+	} `json:"components"`
+}
+
+var openAPIPathParameter = regexp.MustCompile(`\{(\w+)\}`)
+
+// newOpenAPIDocument describes operations with
+// schemas derived from their Go body types.
+func newOpenAPIDocument(title string, operations []apiOperation) ([]byte, error) {
+	document := openAPIDocument{
+		OpenAPI: "3.1.0",
+		Paths:   make(map[string]map[string]openAPIOperation),
+	}
+	document.Info.Title = title
+	document.Info.Version = APIVersion
+	schemas := make(map[string]*openAPISchema)
+	jsonError := openAPIContent{"application/json": {Schema: schemaOf(reflect.TypeFor[hypermedia.JSONError](), schemas)}}
+
+	for _, o := range operations {
+		operation := openAPIOperation{
+			OperationID: o.ID,
+			Summary:     o.Summary,
+			Description: o.Description,
+			Responses: map[string]openAPIBody{
+				"default": {Description: "Error", Content: jsonError},
+			},
+		}
+		for _, match := range openAPIPathParameter.FindAllStringSubmatch(o.Path, -1) {
+			operation.Parameters = append(operation.Parameters, openAPIParameter{
+				Name:     match[1],
+				In:       "path",
+				Required: true,
+				Schema:   &openAPISchema{Type: "string"},
+			})
+		}
+		for _, p := range o.Query {
+			parameter := openAPIParameter{
+				Name:        p.Name,
+				In:          "query",
+				Description: p.Description,
+				Schema:      &openAPISchema{Type: "string"},
+			}
+			if p.Integer {
+				parameter.Schema.Type = "integer"
+			}
+			operation.Parameters = append(operation.Parameters, parameter)
+		}
+		if o.Request != nil {
+			operation.RequestBody = &openAPIBody{
+				Required: true,
+				Content:  openAPIContent{"application/json": {Schema: schemaOf(o.Request, schemas)}},
+			}
+		}
+		contentType := o.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		operation.Responses[strconv.Itoa(o.StatusCode)] = openAPIBody{
+			Description: http.StatusText(o.StatusCode),
+			Content:     openAPIContent{contentType: {Schema: schemaOf(o.Response, schemas)}},
+		}
+		if o.Accepted != "" {
+			operation.Responses[strconv.Itoa(http.StatusAccepted)] = openAPIBody{Description: o.Accepted}
+		}
+
+		if document.Paths[o.Path] == nil {
+			document.Paths[o.Path] = make(map[string]openAPIOperation)
+		}
+		document.Paths[o.Path][strings.ToLower(o.Method)] = operation
+	}
+	document.Components.Schemas = schemas
+	return json.MarshalIndent(document, "", "  ")
+}
+
+// schemaOf follows the rules of [json.Marshal]. Named structs
+// are added to schemas and referred to, so that recursive
+// types do not recurse forever.
+func schemaOf(t reflect.Type, schemas map[string]*openAPISchema) *openAPISchema {
+	if t.Implements(reflect.TypeFor[encoding.TextMarshaler]()) {
+		if t == reflect.TypeFor[time.Time]() {
+			return &openAPISchema{Type: "string", Format: "date-time"}
+		}
+		return &openAPISchema{Type: "string"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return &openAPISchema{AnyOf: []*openAPISchema{
+			schemaOf(t.Elem(), schemas),
+			{Type: "null"},
+		}}
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &openAPISchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &openAPISchema{Type: []string{"string", "null"}, Format: "byte"}
+		}
+		return &openAPISchema{Type: []string{"array", "null"}, Items: schemaOf(t.Elem(), schemas)}
+	case reflect.Array:
+		return &openAPISchema{Type: "array", Items: schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return objectSchemaOf(t, schemas)
+		}
+		if _, ok := schemas[t.Name()]; !ok {
+			schemas[t.Name()] = nil // reserved for recursion
+			schemas[t.Name()] = objectSchemaOf(t, schemas)
+		}
+		return &openAPISchema{Ref: "#/components/schemas/" + t.Name()}
+	default:
+		return &openAPISchema{} // any value
+	}
+}
+
+func objectSchemaOf(t reflect.Type, schemas map[string]*openAPISchema) *openAPISchema {
+	object := &openAPISchema{
+		Type:       "object",
+		Properties: make(map[string]*openAPISchema),
+	}
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous && field.Type.Kind() == reflect.Struct {
+			continue // embedded fields are promoted
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		object.Properties[name] = schemaOf(field.Type, schemas)
+		if !strings.Contains(options, "omitempty") {
+			object.Required = append(object.Required, name)
+		}
+	}
+	return object
+}
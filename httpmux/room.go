@@ -3,12 +3,14 @@ package httpmux
 import (
 	"context"
 	_ "embed" // for template room.html
+	"encoding/json"
 	"fmt"
+	"html/template"
 	"io"
 	"net/http"
 	"strings"
-	"text/template"
 
+	"github.com/dkotik/watermillchat"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 )
 
@@ -21,13 +23,50 @@ var roomTemplate = template.Must(template.New("room").Funcs(template.FuncMap{
 
 type RoomRenderer struct {
 	RoomName        string
+	Metadata        watermillchat.RoomMetadata
 	MessageSendPath string
+	UploadPath      string
+	MetadataPath    string
 	MessageSource   string
 	HostName        string
+	CSRFToken       string
 }
 
-func (r RoomRenderer) Render(ctx context.Context, w io.Writer, l *i18n.Localizer) error {
-	return roomTemplate.Execute(w, r)
+// Store encodes initial Datastar signals as JSON, so that
+// room names and metadata cannot break out of the expression.
+func (r RoomRenderer) Store() (string, error) {
+	store, err := json.Marshal(map[string]string{
+		"roomName":        r.RoomName,
+		"roomTitle":       r.Metadata.Title,
+		"roomTopic":       r.Metadata.Topic,
+		"roomDescription": r.Metadata.Description,
+		"csrf":            r.CSRFToken,
+		"error":           "",
+		"authorName":      "",
+		"attachments":     "",
+	})
+	return string(store), err
+}
+
+func (r RoomRenderer) Render(ctx context.Context, w io.Writer, l *i18n.Localizer) (err error) {
+	data := struct {
+		RoomRenderer
+		EditLabel string
+		SaveLabel string
+	}{RoomRenderer: r}
+	if data.EditLabel, err = l.Localize(&i18n.LocalizeConfig{DefaultMessage: &i18n.Message{
+		ID:    "watermillchat.room.edit",
+		Other: "Room details",
+	}}); err != nil {
+		return err
+	}
+	if data.SaveLabel, err = l.Localize(&i18n.LocalizeConfig{DefaultMessage: &i18n.Message{
+		ID:    "watermillchat.room.save",
+		Other: "Save",
+	}}); err != nil {
+		return err
+	}
+	return roomTemplate.Execute(w, data)
 }
 
 type RoomSelector func(*http.Request) (string, error)
@@ -0,0 +1,148 @@
+package httpmux_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+func TestRoomRendererEscapesMetadata(t *testing.T) {
+	b := &bytes.Buffer{}
+	err := httpmux.RoomRenderer{
+		RoomName: `room'"><script>`,
+		Metadata: watermillchat.RoomMetadata{
+			Name:  `room'"><script>`,
+			Title: `<script>alert(1)</script>`,
+			Topic: `"><img src=x onerror=alert(1)>`,
+		},
+		MessageSendPath: "/chat/send",
+		MetadataPath:    "/chat/room/metadata",
+	}.Render(context.Background(), b, i18n.NewLocalizer(i18n.NewBundle(hypermedia.DefaultLanguage)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered := b.String()
+	for _, unexpected := range []string{"<script>alert", "<img src=x", `room'"><script>`} {
+		if strings.Contains(rendered, unexpected) {
+			t.Fatalf("rendered room page contains %q: %s", unexpected, rendered)
+		}
+	}
+	if !strings.Contains(rendered, `&lt;script&gt;alert(1)&lt;/script&gt;`) {
+		t.Fatal("room title is missing from the page:", rendered)
+	}
+}
+
+// connectRoom opens the room message stream of the page
+// as the identity the page sends in its request headers.
+func connectRoom(t *testing.T, ctx context.Context, server *httptest.Server, roomName, identity string) *bufio.Scanner {
+	t.Helper()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/"+roomName+"/messages", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", "Bearer "+identity+":"+identity)
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	if response.StatusCode != http.StatusOK {
+		t.Fatal("room stream was refused:", response.StatusCode)
+	}
+	return bufio.NewScanner(response.Body)
+}
+
+func TestRoomStreamDeliversCommandReplies(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux, err := httpmux.New(httpmux.Configuration{
+		Chat:          chat,
+		Authenticator: httpmux.NaiveBearerHeaderAuthenticatorUnsafe,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	streamCtx, stop := context.WithCancel(ctx)
+	defer stop() // before the server waits for streams to end
+
+	alice := watermillchat.Identity{ID: "alice", Name: "alice"}
+	if err = chat.Broadcast(ctx, watermillchat.Broadcast{
+		RoomName: "lobby",
+		Message:  watermillchat.Message{Author: &alice, Content: "ready"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	scanner := connectRoom(t, streamCtx, server, "lobby", "alice")
+	readStream(t, scanner, "ready") // subscribed
+
+	if _, err = chat.Send(ctx, watermillchat.Broadcast{
+		RoomName: "lobby",
+		Message:  watermillchat.Message{Author: &alice, Content: "/help"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	readStream(t, scanner, "Commands:")
+}
+
+func TestRoomStreamDeliversNotices(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux, err := httpmux.New(httpmux.Configuration{
+		Chat:          chat,
+		Authenticator: httpmux.NaiveBearerHeaderAuthenticatorUnsafe,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	streamCtx, stop := context.WithCancel(ctx)
+	defer stop() // before the server waits for streams to end
+
+	broadcast := func(content string) {
+		t.Helper()
+		if err := chat.Broadcast(ctx, watermillchat.Broadcast{
+			RoomName: "lobby",
+			Message:  watermillchat.Message{Content: content},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	broadcast("ready")
+	alice := connectRoom(t, streamCtx, server, "lobby", "alice")
+	bob := connectRoom(t, streamCtx, server, "lobby", "bob")
+	readStream(t, alice, "ready") // subscribed
+	readStream(t, bob, "ready")
+
+	if err = chat.Notify(ctx, "lobby", "alice", watermillchat.Message{Content: "only for alice"}); err != nil {
+		t.Fatal(err)
+	}
+	received := readStream(t, alice, "only for alice")
+	if !strings.Contains(received, `class="message ephemeral"`) {
+		t.Fatal("notice is not styled apart from messages:", received)
+	}
+	broadcast("for everyone")
+	if received = readStream(t, bob, "for everyone"); strings.Contains(received, "only for alice") {
+		t.Fatal("notice reached another identity:", received)
+	}
+}
@@ -0,0 +1,130 @@
+package httpmux
+
+import (
+	"context"
+	_ "embed" // for template search.html
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+//go:embed search.html
+var searchTemplateSource string
+
+var searchTemplate = template.Must(template.New("search").Parse(searchTemplateSource))
+
+// SearchRenderer displays a page of [watermillchat.Chat.Search] results.
+// Each result links to the message among the messages around it.
+type SearchRenderer struct {
+	SearchPath string
+	Query      string
+	RoomFilter string
+	Results    []watermillchat.Broadcast
+	NextCursor string
+}
+
+type searchResult struct {
+	Link     string
+	RoomName string
+	Author   *watermillchat.Identity
+	Content  template.HTML
+}
+
+func (r SearchRenderer) Render(ctx context.Context, w io.Writer, l *i18n.Localizer) (err error) {
+	data := struct {
+		Action      string
+		Query       string
+		RoomFilter  string
+		Results     []searchResult
+		NextPage    string
+		Title       string
+		Placeholder string
+		Submit      string
+		NoResults   string
+		More        string
+	}{
+		Action:     r.SearchPath,
+		Query:      r.Query,
+		RoomFilter: r.RoomFilter,
+		Results:    make([]searchResult, 0, len(r.Results)),
+	}
+	for _, result := range r.Results {
+		data.Results = append(data.Results, searchResult{
+			Link: r.SearchPath + "/" + url.PathEscape(result.RoomName) + "/" +
+				url.PathEscape(result.ID) + "#message-" + url.PathEscape(result.ID),
+			RoomName: result.RoomName,
+			Author:   result.Author,
+			Content:  RenderMarkdownWithMentions(result.Content, result.Mentions),
+		})
+	}
+	if r.NextCursor != "" {
+		data.NextPage = r.SearchPath + "?" + url.Values{
+			"q":      {r.Query},
+			"room":   {r.RoomFilter},
+			"cursor": {r.NextCursor},
+		}.Encode()
+	}
+	for target, message := range map[*string]*i18n.Message{
+		&data.Title:       {ID: "watermillchat.search.title", Other: "Search Messages"},
+		&data.Placeholder: {ID: "watermillchat.search.placeholder", Other: "Find messages containing..."},
+		&data.Submit:      {ID: "watermillchat.search.submit", Other: "Search"},
+		&data.NoResults:   {ID: "watermillchat.search.empty", Other: "No messages matched your search."},
+		&data.More:        {ID: "watermillchat.search.more", Other: "Older results"},
+	} {
+		if *target, err = l.Localize(&i18n.LocalizeConfig{DefaultMessage: message}); err != nil {
+			return err
+		}
+	}
+	return searchTemplate.Execute(w, data)
+}
+
+// NewSearchHandler renders a [SearchRenderer] page for
+// the "q", "room", and "cursor" URL query values.
+func NewSearchHandler(
+	c *watermillchat.Chat,
+	page func(hypermedia.Renderable) hypermedia.Renderable,
+	eh hypermedia.ErrorHandler,
+	bundle *i18n.Bundle,
+) http.HandlerFunc {
+	if c == nil {
+		panic("cannot use a <nil> Watermill chat")
+	}
+	if page == nil {
+		panic("cannot use a <nil> page renderer")
+	}
+	if eh == nil {
+		panic("cannot use a <nil> error handler")
+	}
+	if bundle == nil {
+		panic("cannot use a <nil> localization bundle")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		renderer := SearchRenderer{
+			SearchPath: r.URL.Path,
+			Query:      query.Get("q"),
+			RoomFilter: query.Get("room"),
+		}
+		var err error
+		renderer.Results, renderer.NextCursor, err = c.Search(
+			r.Context(), renderer.Query, renderer.RoomFilter, query.Get("cursor"))
+		if err != nil {
+			switch {
+			case errors.Is(err, watermillchat.ErrSearchUnsupported):
+				err = hypermedia.ErrNotFound
+			case errors.Is(err, watermillchat.ErrInvalidSearchCursor):
+				err = hypermedia.ErrBadRequest
+			}
+			eh.HandlerError(w, r, err)
+			return
+		}
+		hypermedia.NewPage(page(renderer), eh, bundle).ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,137 @@
+package httpmux_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+func TestSearchRenderer(t *testing.T) {
+	b := &bytes.Buffer{}
+	err := httpmux.SearchRenderer{
+		SearchPath: "/chat/search",
+		Query:      `"><script>`,
+		Results: []watermillchat.Broadcast{{
+			RoomName: "room one",
+			Message: watermillchat.Message{
+				ID:      "abc",
+				Content: "found <b>it</b>",
+			},
+		}},
+		NextCursor: "42",
+	}.Render(context.Background(), b, i18n.NewLocalizer(i18n.NewBundle(hypermedia.DefaultLanguage)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered := b.String()
+	for _, expected := range []string{
+		`href="/chat/search/room%20one/abc#message-abc"`,
+		`found &lt;b&gt;it&lt;/b&gt;`,
+		`cursor=42`,
+	} {
+		if !strings.Contains(rendered, expected) {
+			t.Errorf("rendered search page does not contain %q: %s", expected, rendered)
+		}
+	}
+	if strings.Contains(rendered, "<script>") {
+		t.Fatal("search query was not escaped:", rendered)
+	}
+}
+
+// searchableHistory rejects every cursor.
+type searchableHistory struct {
+	watermillchat.VoidHistoryRepository
+}
+
+func (h searchableHistory) Search(ctx context.Context, query, roomFilter, cursor string) ([]watermillchat.Broadcast, string, error) {
+	if cursor != "" {
+		return nil, "", watermillchat.ErrInvalidSearchCursor
+	}
+	return nil, "", nil
+}
+
+func TestSearchHandlers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		BlockPublishUntilSubscriberAck: true,
+	}, watermill.NopLogger{})
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		Watermill: watermillchat.WatermillConfiguration{
+			Publisher:  pubSub,
+			Subscriber: pubSub,
+		},
+		History: watermillchat.HistoryConfiguration{
+			Repository: searchableHistory{},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux, err := httpmux.New(httpmux.Configuration{
+		Chat:          chat,
+		Authenticator: httpmux.NaiveBearerHeaderAuthenticatorUnsafe,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+		return w
+	}
+
+	if w := get("/search?q=needle&cursor=malformed"); w.Code != http.StatusBadRequest {
+		t.Fatal("malformed cursor was not rejected:", w.Code)
+	}
+
+	alice := watermillchat.Identity{ID: "alice", Name: "Alice"}
+	var found string
+	for _, content := range []string{"before", "needle", "after"} {
+		b := watermillchat.Broadcast{
+			RoomName: "lobby",
+			Message:  watermillchat.Message{Author: &alice, Content: content},
+		}
+		if content == "needle" {
+			b.Attachments = []watermillchat.Attachment{{ID: "file1", Name: "notes.txt", ContentType: "text/plain"}}
+		}
+		b.Action = content == "after"
+		m, err := chat.Send(watermillchat.ContextWithIdentity(ctx, alice), b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content == "needle" {
+			found = m.ID
+		}
+	}
+	w := get("/search/lobby/" + found)
+	if w.Code != http.StatusOK {
+		t.Fatal("message context was not rendered:", w.Code, w.Body.String())
+	}
+	for _, expected := range []string{
+		`<div class="found"><div id="message-` + found,
+		`<div class="content">before</div>`,
+		`<div class="content">after</div>`,
+		`class="message action"`,
+		`href="/lobby"`,
+		`href="/attachments/file1/notes.txt"`, // not relative to the history page
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("message context does not contain %q: %s", expected, w.Body.String())
+		}
+	}
+	if w = get("/search/lobby/unknown"); w.Code != http.StatusNotFound {
+		t.Fatal("unknown message was found:", w.Code)
+	}
+}
@@ -0,0 +1,309 @@
+package httpmux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/net/websocket"
+)
+
+// Frame types sent to WebSocket clients.
+const (
+	SocketFrameMessages  = "messages"
+	SocketFrameReset     = "reset"
+	SocketFrameResult    = "result"
+	SocketFrameHeartbeat = "heartbeat"
+	SocketFrameReconnect = "reconnect"
+)
+
+// Command types accepted from WebSocket clients.
+const (
+	SocketCommandSend  = "send"
+	SocketCommandEdit  = "edit"
+	SocketCommandReact = "react"
+)
+
+var errUnknownSocketCommand = errors.New("unknown command")
+
+// SocketFrame is a JSON frame sent to WebSocket clients.
+// Messages arrive again with the same ID after they
+// are edited or reacted to.
+type SocketFrame struct {
+	Type     string
+	Messages []watermillchat.Message `json:",omitempty"`
+
+	// CommandID matches a result to its [SocketCommand].
+	CommandID string `json:",omitempty"`
+	// MessageID of a result identifies the message
+	// published by a [SocketCommandSend] command.
+	MessageID string `json:",omitempty"`
+	// StatusCode of a result follows HTTP conventions.
+	StatusCode int    `json:",omitempty"`
+	Error      string `json:",omitempty"`
+}
+
+// SocketCommand is a JSON frame received from WebSocket clients.
+// Each command is answered with a [SocketFrameResult] frame.
+// Frames larger than [DefaultMostSendRequestBytes] are rejected.
+type SocketCommand struct {
+	ID        string
+	Type      string
+	MessageID string `json:",omitempty"`
+	Content   string `json:",omitempty"`
+	Emoji     string `json:",omitempty"`
+}
+
+// NewRoomSocketHandler streams room messages over a WebSocket
+// and accepts [SocketCommand]s from the [watermillchat.Identity]
+// in context. Clients that reconnect can pass the last received
+// message ID in the "after" query value to receive only the
+// messages they missed. Otherwise, they receive a [SocketFrameReset]
+// frame followed by retained messages.
+func NewRoomSocketHandler(
+	c *watermillchat.Chat,
+	selector RoomSelector,
+	streams *Streams,
+	eh hypermedia.ErrorHandler,
+	bundle *i18n.Bundle,
+) http.HandlerFunc {
+	if c == nil {
+		panic("cannot use a <nil> Watermill chat")
+	}
+	if selector == nil {
+		panic("cannot use a <nil> selector")
+	}
+	if streams == nil {
+		panic("cannot use a <nil> stream limiter")
+	}
+	if eh == nil {
+		panic("cannot use a <nil> error handler")
+	}
+	if bundle == nil {
+		panic("cannot use a <nil> localization bundle")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomName, err := selector(r)
+		if err != nil {
+			eh.HandlerError(w, r, err)
+			return
+		}
+		stream, err := streams.open(r)
+		if err != nil {
+			eh.HandlerError(w, r, err)
+			return
+		}
+		defer stream.close()
+
+		websocket.Server{
+			Handshake: checkSocketOrigin,
+			Handler: func(ws *websocket.Conn) {
+				ws.MaxPayloadBytes = DefaultMostSendRequestBytes
+				(&socket{
+					Conn:      ws,
+					chat:      c,
+					roomName:  roomName,
+					stream:    stream,
+					localizer: i18n.NewLocalizer(bundle, r.Header.Get("Accept-Language")),
+				}).serve(r.Context(), r.URL.Query().Get("after"))
+			},
+		}.ServeHTTP(w, r)
+	}
+}
+
+// checkSocketOrigin rejects WebSockets opened by pages of other
+// sites, which would act with credentials of the visitor. Clients
+// other than browsers usually do not send an origin.
+func checkSocketOrigin(config *websocket.Config, r *http.Request) (err error) {
+	if r.Header.Get("Origin") == "" {
+		return nil
+	}
+	if config.Origin, err = websocket.Origin(config, r); err != nil {
+		return err
+	}
+	if config.Origin.Host != r.Host {
+		return fmt.Errorf("WebSocket origin does not match host: %s", config.Origin.Host)
+	}
+	return nil
+}
+
+type socket struct {
+	*websocket.Conn
+	chat      *watermillchat.Chat
+	roomName  string
+	stream    *stream
+	localizer *i18n.Localizer
+}
+
+func (s *socket) serve(ctx context.Context, after string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan SocketFrame)
+	go func() {
+		defer cancel() // client went away
+		s.receive(ctx, results)
+	}()
+
+	var messages <-chan []watermillchat.Message
+	replaying := false
+	if after != "" {
+		messages, replaying = s.chat.SubscribeAfter(ctx, s.roomName, after)
+	} else {
+		messages = s.chat.Subscribe(ctx, s.roomName)
+	}
+	if !replaying && !s.send(SocketFrame{Type: SocketFrameReset}) {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.chat.Closing():
+			s.send(SocketFrame{Type: SocketFrameReconnect})
+			return
+		case <-s.stream.expired:
+			s.stream.countExpired()
+			s.send(SocketFrame{Type: SocketFrameReconnect})
+			return
+		case <-s.stream.heartbeat.C():
+			if !s.send(SocketFrame{Type: SocketFrameHeartbeat}) {
+				return
+			}
+		case result := <-results:
+			if !s.send(result) {
+				return
+			}
+		case batch, ok := <-messages:
+			if !ok {
+				select {
+				case <-s.chat.Closing():
+					s.send(SocketFrame{Type: SocketFrameReconnect})
+				default:
+				}
+				return
+			}
+			if replaying {
+				// skip messages the client received before reconnecting
+				replaying = false
+				if i := slices.IndexFunc(batch, func(m watermillchat.Message) bool {
+					return m.ID == after
+				}); i >= 0 {
+					batch = batch[i+1:]
+				}
+				if len(batch) == 0 {
+					continue
+				}
+			}
+			if !s.send(SocketFrame{Type: SocketFrameMessages, Messages: batch}) {
+				return
+			}
+		}
+	}
+}
+
+// send writes a frame and reports if the client is still there.
+func (s *socket) send(frame SocketFrame) bool {
+	if err := websocket.JSON.Send(s.Conn, frame); err != nil {
+		slog.Debug("failed to deliver WebSocket frame to the client", slog.Any("error", err))
+		return false
+	}
+	return true
+}
+
+// receive runs commands until the client goes away. Commands
+// run apart from delivery, because publishing waits for it.
+func (s *socket) receive(ctx context.Context, results chan<- SocketFrame) {
+	for {
+		command := SocketCommand{}
+		err := websocket.JSON.Receive(s.Conn, &command)
+		var (
+			syntaxError    *json.SyntaxError
+			unmarshalError *json.UnmarshalTypeError
+			messageID      string
+		)
+		switch {
+		case errors.As(err, &syntaxError), errors.As(err, &unmarshalError):
+			err = &hypermedia.LocalizedError{Cause: err, StatusCode: http.StatusBadRequest}
+		case errors.Is(err, websocket.ErrFrameTooLarge):
+			// the rest of the frame is skipped by the next receive
+			err = &hypermedia.LocalizedError{Cause: err, StatusCode: http.StatusRequestEntityTooLarge}
+		case err != nil:
+			return
+		default:
+			messageID, err = s.run(ctx, command)
+		}
+
+		result := s.result(command.ID, err)
+		result.MessageID = messageID
+		select {
+		case <-ctx.Done():
+			return
+		case results <- result:
+		}
+	}
+}
+
+// run executes a command and returns the ID of the message
+// it published, if any.
+func (s *socket) run(ctx context.Context, command SocketCommand) (messageID string, err error) {
+	switch command.Type {
+	case SocketCommandSend:
+		identity, ok := watermillchat.IdentityFromContext(ctx)
+		if !ok {
+			return "", watermillchat.ErrIdentityRequired
+		}
+		m, err := s.chat.Send(ctx, watermillchat.Broadcast{
+			RoomName: s.roomName,
+			Message: watermillchat.Message{
+				Author:    &identity,
+				Content:   strings.TrimSpace(command.Content),
+				CreatedAt: s.chat.Clock().Now().Unix(),
+			},
+		})
+		return m.ID, err
+	case SocketCommandEdit:
+		return "", s.chat.Edit(ctx, s.roomName, command.MessageID, strings.TrimSpace(command.Content))
+	case SocketCommandReact:
+		return "", s.chat.React(ctx, s.roomName, command.MessageID, command.Emoji)
+	default:
+		return "", &hypermedia.LocalizedError{
+			Cause:      fmt.Errorf("%w: %q", errUnknownSocketCommand, command.Type),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+}
+
+// result describes the outcome of a command. Internal
+// errors are logged instead of being shown to the client.
+func (s *socket) result(commandID string, err error) SocketFrame {
+	frame := SocketFrame{
+		Type:       SocketFrameResult,
+		CommandID:  commandID,
+		StatusCode: http.StatusOK,
+	}
+	if err == nil {
+		return frame
+	}
+
+	err = localizeBroadcastError(err)
+	var localized *hypermedia.LocalizedError
+	if !errors.As(err, &localized) {
+		slog.Error("WebSocket command failed", slog.String("commandID", commandID), slog.Any("error", err))
+		frame.StatusCode = http.StatusInternalServerError
+		frame.Error = http.StatusText(http.StatusInternalServerError)
+		return frame
+	}
+	frame.StatusCode = localized.HyperTextStatusCode()
+	frame.Error = localized.Localize(s.localizer)
+	return frame
+}
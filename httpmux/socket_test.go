@@ -0,0 +1,166 @@
+package httpmux_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/net/websocket"
+)
+
+func TestRoomSocket(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /{roomName}/socket", httpmux.NaiveBearerHeaderAuthenticatorUnsafe(httpmux.NewRoomSocketHandler(
+		chat,
+		httpmux.NewRoomSelectorFromURL("roomName"),
+		newStreams(t, httpmux.StreamConfiguration{}),
+		hypermedia.PlainTextErrorHandler,
+		i18n.NewBundle(hypermedia.DefaultLanguage),
+	)))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dial := func(identity, origin, query string) (*websocket.Conn, error) {
+		t.Helper()
+		config, err := websocket.NewConfig(
+			"ws"+strings.TrimPrefix(server.URL, "http")+"/lobby/socket"+query,
+			origin,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Header.Set("Authorization", "Bearer "+identity+":"+identity)
+		return websocket.DialConfig(config)
+	}
+	// frames of other types are kept for later
+	pending := make(map[*websocket.Conn][]httpmux.SocketFrame)
+	receive := func(ws *websocket.Conn, frameType string) httpmux.SocketFrame {
+		t.Helper()
+		for i, frame := range pending[ws] {
+			if frame.Type == frameType {
+				pending[ws] = slices.Delete(pending[ws], i, i+1)
+				return frame
+			}
+		}
+		if err := ws.SetReadDeadline(time.Now().Add(time.Second * 3)); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			frame := httpmux.SocketFrame{}
+			if err := websocket.JSON.Receive(ws, &frame); err != nil {
+				t.Fatal("frame was not received:", frameType, err)
+			}
+			if frame.Type == frameType {
+				return frame
+			}
+			pending[ws] = append(pending[ws], frame)
+		}
+	}
+	command := func(ws *websocket.Conn, c httpmux.SocketCommand) httpmux.SocketFrame {
+		t.Helper()
+		if err := websocket.JSON.Send(ws, c); err != nil {
+			t.Fatal(err)
+		}
+		result := receive(ws, httpmux.SocketFrameResult)
+		if result.CommandID != c.ID {
+			t.Fatal("result does not match the command:", result.CommandID)
+		}
+		return result
+	}
+
+	if _, err = dial("alice", "http://elsewhere.example", ""); err == nil {
+		t.Fatal("WebSocket was opened by another site")
+	}
+
+	alice, err := dial("alice", server.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+	receive(alice, httpmux.SocketFrameReset)
+
+	result := command(alice, httpmux.SocketCommand{
+		ID:      "1",
+		Type:    httpmux.SocketCommandSend,
+		Content: "helo",
+	})
+	if result.StatusCode != http.StatusOK {
+		t.Fatal("message was not sent:", result.Error)
+	}
+	sent := receive(alice, httpmux.SocketFrameMessages).Messages[0]
+	if sent.Content != "helo" || sent.Author == nil || sent.Author.ID != "alice" {
+		t.Fatalf("unexpected message: %+v", sent)
+	}
+	if result.MessageID != sent.ID {
+		t.Fatal("result does not identify the sent message:", result.MessageID)
+	}
+
+	if result := command(alice, httpmux.SocketCommand{
+		ID:        "2",
+		Type:      httpmux.SocketCommandEdit,
+		MessageID: sent.ID,
+		Content:   "hello",
+	}); result.StatusCode != http.StatusOK {
+		t.Fatal("message was not edited:", result.Error)
+	}
+	if edited := receive(alice, httpmux.SocketFrameMessages).Messages[0]; edited.ID != sent.ID || edited.Content != "hello" {
+		t.Fatalf("unexpected edit: %+v", edited)
+	}
+
+	bob, err := dial("bob", server.URL, "?after="+sent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bob.Close()
+	if result := command(bob, httpmux.SocketCommand{
+		ID:        "3",
+		Type:      httpmux.SocketCommandEdit,
+		MessageID: sent.ID,
+		Content:   "hijacked",
+	}); result.StatusCode != http.StatusForbidden {
+		t.Fatal("someone else edited the message:", result.StatusCode)
+	}
+	if result := command(bob, httpmux.SocketCommand{
+		ID:        "4",
+		Type:      httpmux.SocketCommandReact,
+		MessageID: sent.ID,
+		Emoji:     "👍",
+	}); result.StatusCode != http.StatusOK {
+		t.Fatal("reaction was not added:", result.Error)
+	}
+	reacted := receive(bob, httpmux.SocketFrameMessages).Messages[0]
+	if len(reacted.Reactions) != 1 || reacted.Reactions[0].Authors[0].ID != "bob" {
+		t.Fatalf("unexpected reactions: %+v", reacted.Reactions)
+	}
+	if result := command(bob, httpmux.SocketCommand{ID: "5", Type: "delete"}); result.StatusCode != http.StatusBadRequest {
+		t.Fatal("unknown command was accepted:", result.StatusCode)
+	}
+
+	if err = websocket.JSON.Send(bob, httpmux.SocketCommand{
+		ID:      "6",
+		Type:    httpmux.SocketCommandSend,
+		Content: strings.Repeat("a", httpmux.DefaultMostSendRequestBytes),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if result := receive(bob, httpmux.SocketFrameResult); result.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatal("oversized frame was accepted:", result.StatusCode)
+	}
+	if result := command(bob, httpmux.SocketCommand{ID: "7", Type: httpmux.SocketCommandSend, Content: "still here"}); result.StatusCode != http.StatusOK {
+		t.Fatal("socket did not recover from an oversized frame:", result.Error)
+	}
+}
@@ -0,0 +1,261 @@
+package httpmux
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const (
+	DefaultStreamHeartbeat        = time.Second * 15
+	DefaultStreamLifetime         = time.Hour
+	DefaultMostStreamsPerIdentity = 8
+	DefaultMostStreamsPerAddress  = 32
+	DefaultMostStreams            = 10_000
+
+	// streamRetryJitter spreads out clients that reconnect together.
+	streamRetryJitter = time.Second * 5
+)
+
+var ErrTooManyStreams = errors.New("too many open streams")
+
+// StreamConfiguration keeps server sent event streams alive
+// through proxies and limits how many of them are open.
+type StreamConfiguration struct {
+	// Heartbeat is the pause between comments sent to keep
+	// idle streams open. Defaults to [DefaultStreamHeartbeat].
+	Heartbeat time.Duration
+
+	// Lifetime is how long a stream stays open before its client
+	// is told to reconnect. Reconnecting clients resume from the last
+	// received event, so they spread over servers without losing
+	// messages. Defaults to [DefaultStreamLifetime].
+	Lifetime time.Duration
+
+	// MostStreamsPerIdentity limits streams of each authenticated
+	// [watermillchat.Identity]. Defaults to [DefaultMostStreamsPerIdentity].
+	MostStreamsPerIdentity int
+
+	// MostAnonymousStreamsPerAddress limits streams without an identity
+	// opened from each remote address. Clients behind the same proxy
+	// share the limit. Defaults to [DefaultMostStreamsPerAddress].
+	MostAnonymousStreamsPerAddress int
+
+	// MostStreams limits all open streams.
+	// Defaults to [DefaultMostStreams].
+	MostStreams int
+
+	// Clock paces heartbeats. Defaults to [watermillchat.SystemClock].
+	Clock watermillchat.Clock
+}
+
+func (c StreamConfiguration) Validate() (err error) {
+	if c.Heartbeat < time.Second {
+		err = errors.Join(err, errors.New("stream heartbeat cannot be less than one second"))
+	}
+	if c.Lifetime < c.Heartbeat {
+		err = errors.Join(err, errors.New("stream lifetime cannot be less than heartbeat"))
+	}
+	if c.MostStreamsPerIdentity < 1 {
+		err = errors.Join(err, errors.New("streams per identity limit cannot be less than one"))
+	}
+	if c.MostAnonymousStreamsPerAddress < 1 {
+		err = errors.Join(err, errors.New("anonymous streams per address limit cannot be less than one"))
+	}
+	if c.MostStreams < c.MostStreamsPerIdentity {
+		err = errors.Join(err, errors.New("streams limit cannot be less than streams per identity limit"))
+	}
+	if c.Clock == nil {
+		err = errors.Join(err, errors.New("missing Clock"))
+	}
+	return err
+}
+
+// StreamMetrics counts server sent event streams.
+type StreamMetrics struct {
+	// Open streams right now.
+	Open int
+	// Opened streams since start.
+	Opened uint64
+	// Rejected streams over limits since start.
+	Rejected uint64
+	// Expired streams closed at the end of their lifetime since start.
+	Expired uint64
+}
+
+// Streams admits server sent event streams within limits.
+// It is shared by every streaming handler.
+type Streams struct {
+	heartbeat       time.Duration
+	lifetime        time.Duration
+	mostPerIdentity int
+	mostPerAddress  int
+	most            int
+	clock           watermillchat.Clock
+
+	mu          sync.Mutex
+	perIdentity map[string]int
+	perAddress  map[string]int
+	metrics     StreamMetrics
+}
+
+func NewStreams(c StreamConfiguration) (*Streams, error) {
+	if c.Heartbeat == 0 {
+		c.Heartbeat = DefaultStreamHeartbeat
+	}
+	if c.Lifetime == 0 {
+		c.Lifetime = DefaultStreamLifetime
+	}
+	if c.MostStreamsPerIdentity == 0 {
+		c.MostStreamsPerIdentity = DefaultMostStreamsPerIdentity
+	}
+	if c.MostAnonymousStreamsPerAddress == 0 {
+		c.MostAnonymousStreamsPerAddress = DefaultMostStreamsPerAddress
+	}
+	if c.MostStreams == 0 {
+		c.MostStreams = max(DefaultMostStreams, c.MostStreamsPerIdentity)
+	}
+	if c.Clock == nil {
+		c.Clock = watermillchat.SystemClock{}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &Streams{
+		heartbeat:       c.Heartbeat,
+		lifetime:        c.Lifetime,
+		mostPerIdentity: c.MostStreamsPerIdentity,
+		mostPerAddress:  c.MostAnonymousStreamsPerAddress,
+		most:            c.MostStreams,
+		clock:           c.Clock,
+		perIdentity:     make(map[string]int),
+		perAddress:      make(map[string]int),
+	}, nil
+}
+
+// Metrics returns a snapshot of stream counters.
+func (s *Streams) Metrics() StreamMetrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.metrics
+}
+
+// open admits a stream for the request, which must be closed.
+// Anonymous streams are counted by remote address.
+func (s *Streams) open(r *http.Request) (*stream, error) {
+	identityID, address := "", ""
+	if identity, ok := watermillchat.IdentityFromContext(r.Context()); ok {
+		identityID = identity.ID
+	} else if address, _, _ = net.SplitHostPort(r.RemoteAddr); address == "" {
+		address = r.RemoteAddr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.metrics.Open >= s.most {
+		s.metrics.Rejected++
+		return nil, &hypermedia.LocalizedError{
+			Cause:      ErrTooManyStreams,
+			StatusCode: http.StatusServiceUnavailable,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.ServerBusy",
+					Other: "Server is too busy, please try again later",
+				},
+			},
+		}
+	}
+	if (identityID != "" && s.perIdentity[identityID] >= s.mostPerIdentity) ||
+		(identityID == "" && s.perAddress[address] >= s.mostPerAddress) {
+		s.metrics.Rejected++
+		return nil, &hypermedia.LocalizedError{
+			Cause:      ErrTooManyStreams,
+			StatusCode: http.StatusTooManyRequests,
+			Message: &i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "watermillchat.error.TooManyStreams",
+					Other: "Chat is open in too many windows, please close some of them",
+				},
+			},
+		}
+	}
+	if identityID != "" {
+		s.perIdentity[identityID]++
+	} else {
+		s.perAddress[address]++
+	}
+	s.metrics.Open++
+	s.metrics.Opened++
+	return &stream{
+		streams:    s,
+		identityID: identityID,
+		address:    address,
+		heartbeat:  s.clock.NewTicker(s.heartbeat),
+		expired:    s.clock.After(s.lifetime),
+	}, nil
+}
+
+type stream struct {
+	streams    *Streams
+	identityID string
+	address    string
+	heartbeat  watermillchat.Ticker
+	expired    <-chan time.Time
+}
+
+func (s *stream) close() {
+	s.heartbeat.Stop()
+	s.streams.mu.Lock()
+	defer s.streams.mu.Unlock()
+	s.streams.metrics.Open--
+	if s.identityID == "" {
+		if s.streams.perAddress[s.address]--; s.streams.perAddress[s.address] < 1 {
+			delete(s.streams.perAddress, s.address)
+		}
+		return
+	}
+	if s.streams.perIdentity[s.identityID]--; s.streams.perIdentity[s.identityID] < 1 {
+		delete(s.streams.perIdentity, s.identityID)
+	}
+}
+
+func (s *stream) countExpired() {
+	s.streams.mu.Lock()
+	s.streams.metrics.Expired++
+	s.streams.mu.Unlock()
+}
+
+// beat writes a comment, which clients ignore.
+func (s *stream) beat(w http.ResponseWriter) error {
+	if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// expire ends the stream at the end of its lifetime.
+// See [stream.reconnect].
+func (s *stream) expire(w http.ResponseWriter) {
+	s.countExpired()
+	s.reconnect(w)
+}
+
+// reconnect tells the client when to reconnect and breaks the connection,
+// because clients only reconnect to streams that fail. The handler
+// must not write anything else.
+func (s *stream) reconnect(w http.ResponseWriter) {
+	retry := time.Second + time.Duration(rand.Int64N(int64(streamRetryJitter)))
+	if _, err := io.WriteString(w, "retry: "+strconv.FormatInt(retry.Milliseconds(), 10)+"\n\n"); err == nil {
+		_ = http.NewResponseController(w).Flush()
+	}
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,214 @@
+package httpmux_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/httpmux"
+	"github.com/dkotik/watermillchat/httpmux/hypermedia"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+func newStreams(t *testing.T, c httpmux.StreamConfiguration) *httpmux.Streams {
+	t.Helper()
+	streams, err := httpmux.NewStreams(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return streams
+}
+
+func TestStreamLimits(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	streams := newStreams(t, httpmux.StreamConfiguration{
+		MostStreamsPerIdentity: 1,
+		MostStreams:            2,
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/notifications", httpmux.NaiveBearerHeaderAuthenticatorUnsafe(
+		httpmux.NewNotificationsHandler(chat, "/", streams, hypermedia.PlainTextErrorHandler),
+	))
+	mux.Handle("/messages", httpmux.NewRoomMessagesHandler(
+		chat,
+		httpmux.NewRoomSelectorFromURLQueryValue("room"),
+		streams,
+		hypermedia.PlainTextErrorHandler,
+		i18n.NewBundle(hypermedia.DefaultLanguage),
+	))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	streamCtx, stop := context.WithCancel(ctx)
+	defer stop() // before the server waits for streams to end
+
+	connect := func(ctx context.Context, path, identity string) int {
+		t.Helper()
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity != "" {
+			request.Header.Set("Authorization", "Bearer "+identity+":"+identity)
+		}
+		response, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { response.Body.Close() })
+		return response.StatusCode
+	}
+
+	aliceCtx, disconnectAlice := context.WithCancel(streamCtx)
+	if status := connect(aliceCtx, "/notifications", "alice"); status != http.StatusOK {
+		t.Fatal("stream was not opened:", status)
+	}
+	if status := connect(streamCtx, "/notifications", "alice"); status != http.StatusTooManyRequests {
+		t.Fatal("identity opened too many streams:", status)
+	}
+	if status := connect(streamCtx, "/notifications", "bob"); status != http.StatusOK {
+		t.Fatal("stream of another identity was not opened:", status)
+	}
+	if status := connect(streamCtx, "/messages?room=lobby", ""); status != http.StatusServiceUnavailable {
+		t.Fatal("server opened too many streams:", status)
+	}
+	if metrics := streams.Metrics(); metrics.Open != 2 || metrics.Opened != 2 || metrics.Rejected != 2 {
+		t.Fatalf("unexpected stream metrics: %+v", metrics)
+	}
+
+	disconnectAlice()
+	for streams.Metrics().Open != 1 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("closed stream was not released")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	if status := connect(streamCtx, "/notifications", "alice"); status != http.StatusOK {
+		t.Fatal("stream was not opened after another one closed:", status)
+	}
+}
+
+func TestAnonymousStreamLimits(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	streams := newStreams(t, httpmux.StreamConfiguration{
+		MostAnonymousStreamsPerAddress: 1,
+	})
+	handler := httpmux.NewRoomMessagesHandler(
+		chat,
+		httpmux.NewRoomSelectorFromURLQueryValue("room"),
+		streams,
+		hypermedia.PlainTextErrorHandler,
+		i18n.NewBundle(hypermedia.DefaultLanguage),
+	)
+	server := httptest.NewServer(httpmux.NaiveBearerHeaderAuthenticatorUnsafe(handler))
+	defer server.Close()
+	streamCtx, stop := context.WithCancel(ctx)
+	defer stop() // before the server waits for streams to end
+
+	connect := func(ctx context.Context, identity string) int {
+		t.Helper()
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/messages?room=lobby", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity != "" {
+			request.Header.Set("Authorization", "Bearer "+identity+":"+identity)
+		}
+		response, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { response.Body.Close() })
+		return response.StatusCode
+	}
+
+	anonymousCtx, disconnect := context.WithCancel(streamCtx)
+	if status := connect(anonymousCtx, ""); status != http.StatusOK {
+		t.Fatal("anonymous stream was not opened:", status)
+	}
+	if status := connect(streamCtx, ""); status != http.StatusTooManyRequests {
+		t.Fatal("address opened too many anonymous streams:", status)
+	}
+	if status := connect(streamCtx, "alice"); status != http.StatusOK {
+		t.Fatal("authenticated stream was limited by address:", status)
+	}
+
+	disconnect()
+	for streams.Metrics().Open != 1 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("closed stream was not released")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	if status := connect(streamCtx, ""); status != http.StatusOK {
+		t.Fatal("anonymous stream was not opened after another one closed:", status)
+	}
+}
+
+func TestStreamHeartbeatAndLifetime(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := watermillchat.NewFakeClock(time.Now())
+	streams := newStreams(t, httpmux.StreamConfiguration{
+		Heartbeat: time.Second * 10,
+		Lifetime:  time.Minute,
+		Clock:     clock,
+	})
+	server := httptest.NewServer(httpmux.NewRoomMessagesHandler(
+		chat,
+		httpmux.NewRoomSelectorFromURLQueryValue("room"),
+		streams,
+		hypermedia.PlainTextErrorHandler,
+		i18n.NewBundle(hypermedia.DefaultLanguage),
+	))
+	defer server.Close()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/messages?room=lobby", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	scanner := bufio.NewScanner(response.Body)
+
+	// heartbeat ticker and lifetime timer
+	if err = clock.BlockUntil(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Second * 10)
+	readStream(t, scanner, ": heartbeat")
+
+	clock.Advance(time.Minute)
+	readStream(t, scanner, "retry: ")
+	for scanner.Scan() {
+		// drain until the connection breaks
+	}
+	if scanner.Err() == nil {
+		t.Fatal("expired stream ended cleanly, so the client would not reconnect")
+	}
+	if metrics := streams.Metrics(); metrics.Expired != 1 {
+		t.Fatalf("unexpected stream metrics: %+v", metrics)
+	}
+}
@@ -5,35 +5,39 @@ import (
 	"encoding/json"
 	"errors"
 	"log/slog"
-	"slices"
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill/message"
 )
 
-func (c *Chat) distributeToClients(ctx context.Context, roomName string, m Message) error {
+// room returns a room by name, loading its history on first use.
+func (c *Chat) room(ctx context.Context, roomName string) (*Room, error) {
 	c.mu.Lock()
-	room, ok := c.rooms[roomName]
-	if !ok {
-		history, err := c.history.GetRoomMessages(ctx, roomName)
-		if err != nil {
-			c.mu.Unlock()
-			return err
-		}
-		if grow := c.historyDepth - len(history); grow > 0 {
-			history = slices.Grow(history, grow) // increase capacity
-		} else if grow < 0 {
-			history = history[-grow:]      // truncate earlier messages
-			history = slices.Clip(history) // truncate capacity
-		}
+	defer c.mu.Unlock()
 
-		room = &Room{
-			messages: history,
+	room, ok := c.rooms[roomName]
+	if ok {
+		return room, nil
+	}
+	history, err := c.history.GetRoomMessages(ctx, roomName)
+	if err != nil {
+		return nil, err
+	}
+	room = newRoom(history, c.historyDepth, c.clock)
+	if pinnedHistory, ok := c.history.(PinnedHistory); ok {
+		if room.pinned, err = pinnedHistory.GetPinnedMessages(ctx, roomName); err != nil {
+			return nil, err
 		}
-		c.rooms[roomName] = room
 	}
-	c.mu.Unlock()
+	c.rooms[roomName] = room
+	return room, nil
+}
 
+func (c *Chat) distributeToClients(ctx context.Context, roomName string, m Message) error {
+	room, err := c.room(ctx, roomName)
+	if err != nil {
+		return err
+	}
 	return room.Send(ctx, m)
 }
 
@@ -44,10 +48,11 @@ func (c *Chat) Listen(messages <-chan *message.Message) {
 	var cancel func()
 
 	for m := range messages {
-		message.RoomName = ""
-		message.ID = ""
-		message.Content = ""
-		message.Author = nil
+		if kind := EventKindOf(m); kind != EventKindBroadcast {
+			c.receiveEvent(kind, m)
+			continue
+		}
+		message = Broadcast{}
 
 		if err = json.Unmarshal(m.Payload, &message); err != nil {
 			slog.Error("dropping malformed broadcast message", slog.Any("error", err), slog.String("ID", m.UUID))
@@ -64,30 +69,130 @@ func (c *Chat) Listen(messages <-chan *message.Message) {
 				continue
 			}
 			slog.Error("dropping malformed message", slog.Any("error", err), slog.Any("ID", message.ID), slog.Any("roomName", message.RoomName))
+		} else {
+			c.notifyMentioned(message.RoomName, message.Message)
 		}
 		cancel()
 		m.Ack()
 	}
 }
 
-func (c *Chat) Subscribe(ctx context.Context, roomName string) <-chan []Message {
-	c.mu.Lock()
-	room, ok := c.rooms[roomName]
-	if !ok {
-
-		history, err := c.history.GetRoomMessages(
-			context.TODO(), roomName)
-		if err != nil {
-			c.logger.Error("unable to get history messages",
-				slog.String("roomName", roomName),
-			)
+func (c *Chat) withRoom(ctx context.Context, roomName string, f func(*Room) error) error {
+	room, err := c.room(ctx, roomName)
+	if err != nil {
+		return err
+	}
+	return f(room)
+}
+
+// receiveEvent applies events that change already published messages and rooms.
+func (c *Chat) receiveEvent(kind EventKind, m *message.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var err error
+	switch kind {
+	case EventKindPreview:
+		event := PreviewEvent{}
+		if err = json.Unmarshal(m.Payload, &event); err == nil {
+			err = c.withRoom(ctx, event.RoomName, func(room *Room) error {
+				return room.Update(ctx, event.MessageID, func(updated *Message) {
+					updated.Previews = event.Previews
+				})
+			})
+		}
+	case EventKindEdit:
+		event := EditEvent{}
+		if err = json.Unmarshal(m.Payload, &event); err == nil {
+			err = c.withRoom(ctx, event.RoomName, func(room *Room) error {
+				return room.Update(ctx, event.MessageID, func(updated *Message) {
+					updated.Content = event.Content
+					updated.Mentions = event.Mentions
+					updated.UpdatedAt = event.UpdatedAt
+				})
+			})
+		}
+	case EventKindReaction:
+		event := ReactionEvent{}
+		if err = json.Unmarshal(m.Payload, &event); err == nil {
+			err = c.withRoom(ctx, event.RoomName, func(room *Room) error {
+				return room.Update(ctx, event.MessageID, func(updated *Message) {
+					updated.Reactions = toggleReaction(updated.Reactions, event.Emoji, event.Author)
+				})
+			})
+		}
+	case EventKindPin:
+		event := PinEvent{}
+		if err = json.Unmarshal(m.Payload, &event); err == nil {
+			err = c.withRoom(ctx, event.RoomName, func(room *Room) error {
+				room.Pin(event.Message)
+				return nil
+			})
+		}
+	case EventKindUnpin:
+		event := UnpinEvent{}
+		if err = json.Unmarshal(m.Payload, &event); err == nil {
+			err = c.withRoom(ctx, event.RoomName, func(room *Room) error {
+				room.Unpin(event.MessageID)
+				return nil
+			})
 		}
-		room = &Room{
-			messages: history,
+	case EventKindNotice:
+		event := NoticeEvent{}
+		if err = json.Unmarshal(m.Payload, &event); err == nil {
+			err = c.receiveNotice(ctx, event)
 		}
-		c.rooms[roomName] = room
+	case EventKindTyping:
+		event := TypingEvent{}
+		if err = json.Unmarshal(m.Payload, &event); err == nil {
+			c.receiveTyping(event)
+		}
+	case EventKindRoomMetadata:
+		event := RoomMetadataEvent{}
+		if err = json.Unmarshal(m.Payload, &event); err == nil {
+			err = c.receiveRoomMetadata(ctx, event.RoomMetadata)
+		}
+	default:
+		c.logger.Debug("skipping unknown event", slog.String("kind", string(kind)), slog.String("ID", m.UUID))
+	}
+
+	if errors.Is(err, context.Canceled) {
+		m.Nack()
+		return
 	}
-	c.mu.Unlock()
+	if err != nil {
+		c.logger.Error("dropping malformed event", slog.String("kind", string(kind)), slog.Any("error", err), slog.String("ID", m.UUID))
+	}
+	m.Ack()
+}
+
+func (c *Chat) Subscribe(ctx context.Context, roomName string) <-chan []Message {
+	return c.subscribedRoom(roomName).Subscribe(c.untilClosed(ctx))
+}
 
-	return room.Subscribe(ctx)
+// SubscribeNew is [Chat.Subscribe] without the batch of retained
+// messages, for clients that react only to what happens next.
+func (c *Chat) SubscribeNew(ctx context.Context, roomName string) <-chan []Message {
+	return c.subscribedRoom(roomName).subscribe(c.untilClosed(ctx), func([]Message) []Message {
+		return nil
+	})
+}
+
+// subscribedRoom returns a room for subscription even when
+// its history cannot be loaded, so that new messages still arrive.
+func (c *Chat) subscribedRoom(roomName string) *Room {
+	room, err := c.room(context.TODO(), roomName)
+	if err != nil {
+		c.logger.Error("unable to get history messages",
+			slog.String("roomName", roomName),
+			slog.Any("error", err),
+		)
+		c.mu.Lock()
+		if room = c.rooms[roomName]; room == nil {
+			room = newRoom(nil, c.historyDepth, c.clock)
+			c.rooms[roomName] = room
+		}
+		c.mu.Unlock()
+	}
+	return room
 }
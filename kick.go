@@ -0,0 +1,88 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrKicked         = errors.New("kicked out of the room")
+	ErrMemberNotFound = errors.New("room member not found")
+)
+
+// Kick stops an identity from sending messages to a room. The
+// kicked identity is recorded in [RoomMetadata.Kicked], so that every
+// node enforces it. Callers are responsible for checking that the
+// identity in context is allowed to moderate the room.
+func (c *Chat) Kick(ctx context.Context, roomName, identityID string) error {
+	return c.updateKicked(ctx, roomName, identityID, true)
+}
+
+// Unkick allows a kicked identity to send messages to a room again.
+// Callers are responsible for checking that the identity in context
+// is allowed to moderate the room.
+func (c *Chat) Unkick(ctx context.Context, roomName, identityID string) error {
+	return c.updateKicked(ctx, roomName, identityID, false)
+}
+
+func (c *Chat) updateKicked(ctx context.Context, roomName, identityID string, kicked bool) error {
+	if identityID == "" {
+		return ErrIdentityRequired
+	}
+	m, err := c.RoomMetadata(ctx, roomName)
+	if err != nil {
+		return err
+	}
+	if m, err = c.describeRoom(ctx, m); err != nil {
+		return err
+	}
+	index := slices.Index(m.Kicked, identityID)
+	switch {
+	case kicked && index < 0:
+		m.Kicked = append(m.Kicked, identityID)
+	case !kicked && index >= 0:
+		m.Kicked = slices.Delete(m.Kicked, index, index+1)
+	default:
+		return nil
+	}
+	return c.publishEvent(ctx, EventKindRoomMetadata, RoomMetadataEvent{RoomMetadata: m})
+}
+
+// checkKicked returns [ErrKicked] for identities
+// that are not allowed to speak in the room.
+func (c *Chat) checkKicked(ctx context.Context, roomName, identityID string) error {
+	m, err := c.RoomMetadata(ctx, roomName)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(m.Kicked, identityID) {
+		return fmt.Errorf("%w: %s", ErrKicked, roomName)
+	}
+	return nil
+}
+
+// roomMember finds an author who has spoken in the room
+// by [Identity.ID] or by name, as it would be mentioned.
+func (c *Chat) roomMember(ctx context.Context, roomName, name string) (Identity, error) {
+	room, err := c.room(ctx, roomName)
+	if err != nil {
+		return Identity{}, err
+	}
+	name = strings.TrimPrefix(name, "@")
+	normalized := NormalizeMentionName(name)
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if member, ok := room.members[name]; ok {
+		return member, nil
+	}
+	for _, member := range room.members {
+		if NormalizeMentionName(member.Name) == normalized {
+			return member, nil
+		}
+	}
+	return Identity{}, fmt.Errorf("%w: %s", ErrMemberNotFound, name)
+}
@@ -0,0 +1,130 @@
+package watermillchat
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+var ErrRoomExists = errors.New("room already exists")
+
+// RoomActivity summarizes a room that is loaded in memory.
+type RoomActivity struct {
+	Name         string
+	Subscribers  int
+	LastActivity time.Time // zero, if the room has no messages
+}
+
+// RoomListing joins [RoomMetadata] with [RoomActivity].
+type RoomListing struct {
+	RoomMetadata
+	Subscribers  int
+	LastActivity time.Time
+}
+
+// Activity reports the number of subscribed clients and
+// the time of the latest message.
+func (r *Room) Activity() (subscribers int, last time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lastActivity > 0 {
+		last = time.Unix(r.lastActivity, 0)
+	}
+	return len(r.clients), last
+}
+
+// ActiveRooms lists rooms loaded in memory, the most
+// recently active first.
+func (c *Chat) ActiveRooms() (list []RoomActivity) {
+	c.mu.Lock()
+	list = make([]RoomActivity, 0, len(c.rooms))
+	for name, room := range c.rooms {
+		subscribers, last := room.Activity()
+		list = append(list, RoomActivity{
+			Name:         name,
+			Subscribers:  subscribers,
+			LastActivity: last,
+		})
+	}
+	c.mu.Unlock()
+	slices.SortFunc(list, func(a, b RoomActivity) int {
+		if order := b.LastActivity.Compare(a.LastActivity); order != 0 {
+			return order
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return list
+}
+
+// PublicRooms lists rooms described in the [RoomDirectory]
+// together with their activity, the most recently active first.
+// Rooms that were never described, like the randomly named ones,
+// are not listed.
+func (c *Chat) PublicRooms(ctx context.Context) ([]RoomListing, error) {
+	described, err := c.directory.ListRoomMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	activity := make(map[string]RoomActivity)
+	for _, active := range c.ActiveRooms() {
+		activity[active.Name] = active
+	}
+	list := make([]RoomListing, len(described))
+	for i, m := range described {
+		list[i] = RoomListing{
+			RoomMetadata: m,
+			Subscribers:  activity[m.Name].Subscribers,
+			LastActivity: activity[m.Name].LastActivity,
+		}
+	}
+	// stable sort preserves name order for idle rooms
+	slices.SortStableFunc(list, func(a, b RoomListing) int {
+		return b.LastActivity.Compare(a.LastActivity)
+	})
+	return list, nil
+}
+
+// RoomExists returns true for rooms that are loaded in
+// memory, described in the [RoomDirectory], or have history.
+func (c *Chat) RoomExists(ctx context.Context, roomName string) (bool, error) {
+	c.mu.Lock()
+	_, ok := c.rooms[roomName]
+	c.mu.Unlock()
+	if ok {
+		return true, nil
+	}
+	if _, err := c.directory.GetRoomMetadata(ctx, roomName); err == nil {
+		return true, nil
+	} else if !errors.Is(err, ErrRoomNotFound) {
+		return false, err
+	}
+	history, err := c.history.GetRoomMessages(ctx, roomName)
+	if err != nil {
+		return false, err
+	}
+	return len(history) > 0, nil
+}
+
+// CreateRoom describes a new room in the [RoomDirectory], which
+// makes it public. Returns [ErrRoomExists] if the name is taken.
+// The directory is written right away, so that the room is listed
+// before other instances receive the [RoomMetadataEvent].
+func (c *Chat) CreateRoom(ctx context.Context, m RoomMetadata) error {
+	exists, err := c.RoomExists(ctx, m.Name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrRoomExists
+	}
+	if m, err = c.describeRoom(ctx, m); err != nil {
+		return err
+	}
+	// the write is conditional, so that only one of concurrent creates succeeds
+	if err = c.directory.CreateRoomMetadata(ctx, m); err != nil {
+		return err
+	}
+	return c.publishEvent(ctx, EventKindRoomMetadata, RoomMetadataEvent{RoomMetadata: m})
+}
@@ -0,0 +1,78 @@
+package watermillchat_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+)
+
+func TestPublicRoomsActivity(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = chat.CreateRoom(ctx, watermillchat.RoomMetadata{Name: "quiet"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = chat.CreateRoom(ctx, watermillchat.RoomMetadata{Name: "busy"}); err != nil {
+		t.Fatal(err)
+	}
+	messages := chat.Subscribe(ctx, "busy")
+	if err = chat.Broadcast(ctx, watermillchat.Broadcast{
+		RoomName: "busy",
+		Message:  watermillchat.Message{Content: "hello", CreatedAt: time.Now().Unix()},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	<-messages
+
+	rooms, err := chat.PublicRooms(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 2 || rooms[0].Name != "busy" || rooms[0].Subscribers != 1 || rooms[0].LastActivity.IsZero() {
+		t.Fatal("unexpected room listing:", rooms)
+	}
+	if rooms[1].Name != "quiet" || !rooms[1].LastActivity.IsZero() {
+		t.Fatal("idle room listed with activity:", rooms[1])
+	}
+	if exists, err := chat.RoomExists(ctx, "quiet"); err != nil || !exists {
+		t.Fatal("described room does not exist:", err)
+	}
+}
+
+func TestConcurrentRoomCreation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const creators = 8
+	errs := make(chan error, creators)
+	for i := range creators {
+		identity := watermillchat.Identity{ID: fmt.Sprintf("creator%d", i)}
+		go func() {
+			errs <- chat.CreateRoom(watermillchat.ContextWithIdentity(ctx, identity),
+				watermillchat.RoomMetadata{Name: "contested"})
+		}()
+	}
+	created := 0
+	for range creators {
+		if err = <-errs; err == nil {
+			created++
+		} else if !errors.Is(err, watermillchat.ErrRoomExists) {
+			t.Fatal(err)
+		}
+	}
+	if created != 1 {
+		t.Fatal("room was created more than once:", created)
+	}
+}
@@ -0,0 +1,106 @@
+package watermillchat
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var mentionPattern = regexp.MustCompile(`@([\p{L}\p{N}_.\-]+)`)
+
+// Mention notifies an [Identity] that a message in a room refers to them.
+type Mention struct {
+	RoomName string
+	Message  Message
+}
+
+// NormalizeMentionName reduces an [Identity.Name] to
+// the form that follows the @ sign in message content.
+func NormalizeMentionName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), ""))
+}
+
+// MentionedNames returns normalized names following
+// the @ sign in message content.
+func MentionedNames(content string) (names []string) {
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := NormalizeMentionName(strings.TrimRight(match[1], ".-"))
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// resolveMentions matches mentioned names against authors
+// who have spoken in the room.
+func (c *Chat) resolveMentions(ctx context.Context, roomName, content string) (mentioned []Identity) {
+	names := MentionedNames(content)
+	if len(names) == 0 {
+		return nil
+	}
+	room, err := c.room(ctx, roomName)
+	if err != nil {
+		return nil
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	for _, member := range room.members {
+		if slices.Contains(names, NormalizeMentionName(member.Name)) {
+			mentioned = append(mentioned, member)
+		}
+	}
+	slices.SortFunc(mentioned, func(a, b Identity) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return mentioned
+}
+
+// SubscribeMentions delivers every message that mentions
+// the identity in any room until the context is done.
+func (c *Chat) SubscribeMentions(ctx context.Context, identityID string) <-chan Mention {
+	ctx = c.untilClosed(ctx)
+	mentions := make(chan Mention, 8)
+	c.mu.Lock()
+	c.mentionSubscribers[identityID] = append(c.mentionSubscribers[identityID], mentions)
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.mentionSubscribers[identityID] = slices.DeleteFunc(
+			c.mentionSubscribers[identityID],
+			func(existing chan Mention) bool {
+				return existing == mentions
+			},
+		)
+		if len(c.mentionSubscribers[identityID]) == 0 {
+			delete(c.mentionSubscribers, identityID)
+		}
+		close(mentions)
+	}()
+	return mentions
+}
+
+func (c *Chat) notifyMentioned(roomName string, m Message) {
+	if len(m.Mentions) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, identity := range m.Mentions {
+		if m.Author != nil && m.Author.ID == identity.ID {
+			continue // do not notify about mentioning self
+		}
+		for _, subscriber := range c.mentionSubscribers[identity.ID] {
+			select {
+			case subscriber <- Mention{RoomName: roomName, Message: m}:
+			default:
+				c.logger.Warn("dropped a mention notification for a slow subscriber")
+			}
+		}
+	}
+}
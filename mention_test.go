@@ -0,0 +1,54 @@
+package watermillchat_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+)
+
+func TestMentionedNames(t *testing.T) {
+	names := watermillchat.MentionedNames("hi @Alice, @bob. and @alice again; mail@")
+	if !slices.Equal(names, []string{"alice", "bob"}) {
+		t.Fatal("unexpected mentioned names:", names)
+	}
+}
+
+func TestMentionNotifications(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &watermillchat.Identity{ID: "alice-id", Name: "Alice Smith"}
+	bob := &watermillchat.Identity{ID: "bob-id", Name: "Bob"}
+	mentions := chat.SubscribeMentions(ctx, alice.ID)
+	messages := chat.Subscribe(ctx, "testRoom")
+
+	for _, m := range []watermillchat.Message{
+		{Author: alice, Content: "hello"},
+		{Author: bob, Content: "hey @AliceSmith and @nobody"},
+	} {
+		if err = chat.Broadcast(ctx, watermillchat.Broadcast{RoomName: "testRoom", Message: m}); err != nil {
+			t.Fatal(err)
+		}
+		<-messages // wait for delivery, so that the author becomes a member
+	}
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("mention was not delivered")
+	case mention := <-mentions:
+		if mention.RoomName != "testRoom" || mention.Message.Author.ID != bob.ID {
+			t.Fatal("unexpected mention:", mention)
+		}
+		if len(mention.Message.Mentions) != 1 || mention.Message.Mentions[0].ID != alice.ID {
+			t.Fatal("mention was not resolved to identity:", mention.Message.Mentions)
+		}
+	}
+}
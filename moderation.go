@@ -0,0 +1,119 @@
+package watermillchat
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+var ErrHeldMessageNotFound = errors.New("held message not found")
+
+type ModerationConfiguration struct {
+	// Filters run in order inside [Chat.Broadcast]
+	// after message validation and rate limiting.
+	Filters []MessageFilter
+
+	// Queue keeps messages held for review by [DecisionHold].
+	// Defaults to [MemoryModerationQueue].
+	Queue ModerationQueue
+}
+
+func (c ModerationConfiguration) Validate() (err error) {
+	for i, filter := range c.Filters {
+		if filter == nil {
+			err = errors.Join(err, fmt.Errorf("message filter #%d is <nil>", i+1))
+		}
+	}
+	if c.Queue == nil {
+		err = errors.Join(err, errors.New("missing moderation queue"))
+	}
+	return err
+}
+
+// ModerationQueue stores messages held for review.
+type ModerationQueue interface {
+	Hold(context.Context, Broadcast) error
+	// List returns held messages in order they were held.
+	// Empty room name lists messages of every room.
+	List(ctx context.Context, roomName string) ([]Broadcast, error)
+	// Release removes a held message from the queue and returns it.
+	// Returns [ErrHeldMessageNotFound] if the message is not held.
+	Release(ctx context.Context, messageID string) (Broadcast, error)
+}
+
+type MemoryModerationQueue struct {
+	held []Broadcast
+	mu   sync.Mutex
+}
+
+func NewMemoryModerationQueue() *MemoryModerationQueue {
+	return &MemoryModerationQueue{}
+}
+
+func (q *MemoryModerationQueue) Hold(ctx context.Context, b Broadcast) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.held = append(q.held, b)
+	return nil
+}
+
+func (q *MemoryModerationQueue) List(ctx context.Context, roomName string) (held []Broadcast, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, b := range q.held {
+		if roomName == "" || b.RoomName == roomName {
+			held = append(held, b)
+		}
+	}
+	return held, nil
+}
+
+func (q *MemoryModerationQueue) Release(ctx context.Context, messageID string) (Broadcast, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, b := range q.held {
+		if b.ID == messageID {
+			q.held = slices.Delete(q.held, i, i+1)
+			return b, nil
+		}
+	}
+	return Broadcast{}, ErrHeldMessageNotFound
+}
+
+// HeldMessages lists messages waiting for moderator review
+// sorted by creation time. Empty room name lists every room.
+func (c *Chat) HeldMessages(ctx context.Context, roomName string) ([]Broadcast, error) {
+	held, err := c.moderationQueue.List(ctx, roomName)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(held, func(a, b Broadcast) int {
+		return cmp.Compare(a.CreatedAt, b.CreatedAt)
+	})
+	return held, nil
+}
+
+// ApproveHeld publishes a held message bypassing message filters.
+// The message is held again if it cannot be published.
+func (c *Chat) ApproveHeld(ctx context.Context, messageID string) error {
+	b, err := c.moderationQueue.Release(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	if _, err = c.publishModerated(ctx, b); err != nil {
+		if holdErr := c.moderationQueue.Hold(ctx, b); holdErr != nil {
+			return errors.Join(err, fmt.Errorf("unable to hold message for review again: %w", holdErr))
+		}
+		return err
+	}
+	return nil
+}
+
+// RejectHeld discards a held message.
+func (c *Chat) RejectHeld(ctx context.Context, messageID string) error {
+	_, err := c.moderationQueue.Release(ctx, messageID)
+	return err
+}
@@ -0,0 +1,59 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// NoticeEvent delivers an [Message.Ephemeral] message to the
+// subscriptions of one identity on every node. It is an
+// [EventKindNotice] event, which history does not store.
+type NoticeEvent struct {
+	RoomName   string
+	IdentityID string
+	Message    Message
+}
+
+// Notify sends a message that only subscriptions of one identity
+// receive, like command replies or warnings. Notices are neither
+// retained nor stored, so they are missed by identities that
+// are not subscribed to the room at the time.
+func (c *Chat) Notify(ctx context.Context, roomName, identityID string, m Message) error {
+	if roomName == "" {
+		return errors.New("chat room name is required")
+	}
+	if identityID == "" {
+		return ErrIdentityRequired
+	}
+	if strings.TrimSpace(m.Content) == "" {
+		return ErrEmptyMessage
+	}
+	if c.closing.Err() != nil {
+		return ErrChatClosed
+	}
+	m.ID = watermill.NewUUID()
+	m.CreatedAt = c.clock.Now().Unix()
+	m.UpdatedAt = 0
+	m.Ephemeral = true
+	return c.publishEvent(ctx, EventKindNotice, NoticeEvent{
+		RoomName:   roomName,
+		IdentityID: identityID,
+		Message:    m,
+	})
+}
+
+// receiveNotice delivers a notice only to rooms
+// that are already open on this node.
+func (c *Chat) receiveNotice(ctx context.Context, event NoticeEvent) error {
+	c.mu.Lock()
+	room := c.rooms[event.RoomName]
+	c.mu.Unlock()
+	if room == nil || event.IdentityID == "" {
+		return nil
+	}
+	event.Message.Ephemeral = true
+	return room.deliverTo(ctx, event.IdentityID, event.Message)
+}
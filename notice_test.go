@@ -0,0 +1,84 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+)
+
+func TestNotify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// two nodes share the topic, every event reaches
+	// both of them before publishing returns
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		BlockPublishUntilSubscriberAck: true,
+	}, watermill.NopLogger{})
+	nodes := make([]*Chat, 2)
+	histories := make([]*replayableHistoryRepository, len(nodes))
+	for i := range nodes {
+		histories[i] = &replayableHistoryRepository{}
+		var err error
+		if nodes[i], err = New(ctx, Configuration{
+			Watermill: WatermillConfiguration{
+				Publisher:  pubSub,
+				Subscriber: pubSub,
+			},
+			History: HistoryConfiguration{Repository: histories[i]},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bob := nodes[1].Subscribe(ContextWithIdentity(ctx, Identity{ID: "bob"}), "testRoom")
+	carol := nodes[1].Subscribe(ContextWithIdentity(ctx, Identity{ID: "carol"}), "testRoom")
+	anonymous := nodes[0].Subscribe(ctx, "testRoom")
+
+	if err := nodes[0].Notify(ctx, "testRoom", "", Message{Content: "lost"}); !errors.Is(err, ErrIdentityRequired) {
+		t.Fatal("notice without identity was accepted:", err)
+	}
+	if err := nodes[0].Notify(ctx, "testRoom", "bob", Message{Content: "psst"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes[0].Broadcast(ctx, Broadcast{
+		RoomName: "testRoom",
+		Message:  Message{Content: "hello"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("notice was not delivered to another node")
+	case batch := <-bob:
+		if len(batch) == 0 || !batch[0].Ephemeral || batch[0].Content != "psst" || batch[0].ID == "" {
+			t.Fatalf("unexpected notice: %+v", batch)
+		}
+	}
+	for _, others := range []<-chan []Message{carol, anonymous} {
+		select {
+		case <-ctx.Done():
+			t.Fatal("broadcast was not delivered")
+		case batch := <-others:
+			if len(batch) != 1 || batch[0].Content != "hello" {
+				t.Fatalf("notice reached someone else: %+v", batch)
+			}
+		}
+	}
+	for i, node := range nodes {
+		if ids := histories[i].ids(); len(ids) != 1 {
+			t.Fatal("notice was stored:", ids)
+		}
+		node.rooms["testRoom"].mu.Lock()
+		retained := len(node.rooms["testRoom"].messages)
+		node.rooms["testRoom"].mu.Unlock()
+		if retained != 1 {
+			t.Fatal("notice was retained")
+		}
+	}
+}
@@ -2,73 +2,131 @@ package ollama
 
 import (
 	"context"
-	"fmt"
 	"log/slog"
-	"time"
+	"slices"
+	"unicode/utf8"
 
 	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/bot"
 )
 
-func (o *Ollama) JoinChat(ctx context.Context, c *watermillchat.Chat, botName, roomName string) {
-	messages := c.Subscribe(ctx, roomName)
-	next := make(chan watermillchat.Message)
-	thinking := time.NewTicker(time.Millisecond * 50)
-	me := &watermillchat.Identity{
-		ID:   "3sadfsdfsdfsdfs",
-		Name: botName,
-	}
+// IdentityIDPrefix starts identity IDs of Ollama bots,
+// which are followed by the bot name.
+const IdentityIDPrefix = "ollama:"
 
-	send := func(parent context.Context, message string) {
-		ctx, cancel := context.WithTimeout(parent, time.Second*3)
-		defer cancel()
+// Handle answers a message continuing the conversation
+// recalled from room history.
+func (o *Ollama) Handle(ctx context.Context, e bot.Event) ([]bot.Reply, error) {
+	answer, err := o.complete(ctx, o.conversation(ctx, e))
+	if err != nil {
+		return nil, err
+	}
+	return []bot.Reply{{Content: answer}}, nil
+}
 
-		err := c.Broadcast(ctx, watermillchat.Broadcast{
-			RoomName: roomName,
-			Message: watermillchat.Message{
-				Author:    me,
-				Content:   message,
-				CreatedAt: time.Now().Unix(),
-			},
-		})
+// conversation turns room messages that preceded the event into
+// model messages. Own messages are spoken by the assistant, others
+// by users prefixed with their names. The oldest messages are left
+// out to fit the prompt budget.
+func (o *Ollama) conversation(ctx context.Context, e bot.Event) []Message {
+	var history []watermillchat.Message
+	if e.Chat != nil && o.mostHistoryMessages > 0 {
+		var err error
+		history, _, err = e.Chat.RoomHistory(ctx, e.RoomName, e.Message.ID, o.mostHistoryMessages)
 		if err != nil {
-			o.logger.ErrorContext(ctx, "Ollama was unable to speak a message", slog.String("roomName", roomName), slog.Any("identity", me))
+			o.logger.WarnContext(ctx, "Ollama bot was unable to recall room history",
+				slog.String("roomName", e.RoomName),
+				slog.Any("error", err),
+			)
 		}
 	}
+	o.mu.Lock()
+	forgotten := o.forgotten[e.RoomName]
+	o.mu.Unlock()
+	if i := slices.IndexFunc(history, func(m watermillchat.Message) bool {
+		return m.ID == forgotten
+	}); i >= 0 {
+		history = history[i+1:]
+	}
 
-	go func(ctx context.Context) {
-		for {
-			select {
-			case <-ctx.Done():
-				close(next)
-				return
-			case <-thinking.C:
-				if len(next) > 0 {
-					send(ctx, "... I am thinking ...")
-				}
-			case batch := <-messages:
-				for _, message := range batch {
-					if message.Author != nil && message.Author.ID == me.ID {
-						continue // do not react to own messages
-					}
+	messages := make([]Message, 0, len(history)+1)
+	for _, m := range append(history, e.Message) {
+		switch {
+		case m.Author == nil || m.Ephemeral:
+			continue // system messages
+		case m.Action:
+			messages = append(messages, Message{Role: "user", Content: m.Author.Name + " " + m.Content})
+		case m.Author.ID == e.Self.ID:
+			messages = append(messages, Message{Role: "assistant", Content: m.Content})
+		default:
+			messages = append(messages, Message{Role: "user", Content: m.Author.Name + ": " + m.Content})
+		}
+	}
 
-					select {
-					case next <- message:
-					default:
-						o.logger.WarnContext(ctx, "Ollama got a message while busy answering the previous one", slog.String("roomName", roomName))
-					}
-					break // stop loop after first message
-				}
-			}
+	budget := o.mostPromptRunes - utf8.RuneCountInString(o.systemPrompt)
+	first := len(messages) - 1 // latest message is always sent
+	for first > 0 {
+		budget -= utf8.RuneCountInString(messages[first].Content)
+		if budget < utf8.RuneCountInString(messages[first-1].Content) {
+			break
 		}
-	}(ctx)
+		first--
+	}
+	return append([]Message{{Role: "system", Content: o.systemPrompt}}, messages[first:]...)
+}
 
-	for message := range next {
-		answer, err := o.SendMessage(ctx, message.Content)
-		if err != nil {
-			send(ctx, fmt.Errorf("Ollama API Error: %w", err).Error())
-			<-time.After(time.Second * 5)
-		} else {
-			send(ctx, answer)
+// forget leaves out room messages published before now from
+// future conversations.
+func (o *Ollama) forget(ctx context.Context, c *watermillchat.Chat, roomName string) error {
+	latest, _, err := c.RoomHistory(ctx, roomName, "", 1)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(latest) == 0 {
+		delete(o.forgotten, roomName)
+	} else {
+		o.forgotten[roomName] = latest[0].ID
+	}
+	return nil
+}
+
+// JoinChat answers new messages of a room in the background
+// until the context is done or the chat closes. It also
+// registers the reset command with the chat.
+func (o *Ollama) JoinChat(ctx context.Context, c *watermillchat.Chat, botName, roomName string) error {
+	runner, err := bot.New(bot.Configuration{
+		Chat: c,
+		Bot:  o,
+		Identity: watermillchat.Identity{
+			ID:   IdentityIDPrefix + botName,
+			Name: botName,
+		},
+		Logger: o.logger,
+	})
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	_, registered := o.registered[c]
+	if !registered {
+		if err = c.RegisterCommand(watermillchat.Command{
+			Name:        o.resetCommand,
+			Description: "makes the bot forget the conversation in this room",
+			Run: func(ctx context.Context, r watermillchat.CommandRequest) error {
+				if err := o.forget(ctx, r.Chat, r.RoomName); err != nil {
+					return err
+				}
+				return r.Announce(ctx, r.Author.Name+" cleared the memory of the bot.")
+			},
+		}); err != nil {
+			o.mu.Unlock()
+			return err
 		}
+		o.registered[c] = struct{}{}
 	}
+	o.mu.Unlock()
+	return runner.Join(ctx, roomName)
 }
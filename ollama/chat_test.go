@@ -1,6 +1,18 @@
 package ollama_test
 
-import "testing"
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/ollama"
+)
 
 func TestConversationWithSelf(t *testing.T) {
 	ctx, cancel := newContext()
@@ -8,3 +20,103 @@ func TestConversationWithSelf(t *testing.T) {
 
 	t.Log(ctx)
 }
+
+func TestConversationMemory(t *testing.T) {
+	ctx, cancel := newContext()
+	defer cancel()
+
+	requests := make(chan ollama.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := ollama.Request{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests <- request
+		_ = json.NewEncoder(w).Encode(ollama.Response{
+			Message: ollama.Message{Role: "assistant", Content: fmt.Sprintf("answer %d", len(request.Messages))},
+			Done:    true,
+		})
+	}))
+	defer server.Close()
+
+	// messages arrive in the order they are published
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		BlockPublishUntilSubscriberAck: true,
+	}, watermill.NopLogger{})
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		Watermill: watermillchat.WatermillConfiguration{
+			Publisher:  pubSub,
+			Subscriber: pubSub,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot, err := ollama.New(ollama.Configuration{
+		URL:          server.URL,
+		SystemPrompt: "Be brief.",
+		// fits the system prompt and two of the three
+		// messages of the second conversation
+		MostPromptRunes: 9 + 30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bot.JoinChat(ctx, chat, "Ollama", "lobby"); err != nil {
+		t.Fatal(err)
+	}
+	if err = bot.JoinChat(ctx, chat, "Ollama", "other"); err != nil {
+		t.Fatal("reset command was registered twice:", err)
+	}
+
+	alice := watermillchat.Identity{ID: "alice", Name: "Alice"}
+	batches := chat.Subscribe(ctx, "lobby")
+	ask := func(content string, expected ...ollama.Message) {
+		t.Helper()
+		if err := chat.Broadcast(ctx, watermillchat.Broadcast{
+			RoomName: "lobby",
+			Message:  watermillchat.Message{Author: &alice, Content: content},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("Ollama was not asked")
+		case request := <-requests:
+			expected = append([]ollama.Message{{Role: "system", Content: "Be brief."}}, expected...)
+			if !slices.Equal(request.Messages, expected) {
+				t.Fatalf("unexpected conversation:\n%+v\ninstead of\n%+v", request.Messages, expected)
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				t.Fatal("Ollama did not answer")
+			case batch := <-batches:
+				for _, m := range batch {
+					if m.Author != nil && m.Author.Name == "Ollama" {
+						return // answer is remembered by the room
+					}
+				}
+			}
+		}
+	}
+
+	ask("hello",
+		ollama.Message{Role: "user", Content: "Alice: hello"},
+	)
+	ask("again", // first message does not fit
+		ollama.Message{Role: "assistant", Content: "answer 2"},
+		ollama.Message{Role: "user", Content: "Alice: again"},
+	)
+	if err = chat.Broadcast(ctx, watermillchat.Broadcast{
+		RoomName: "lobby",
+		Message:  watermillchat.Message{Author: &alice, Content: "/forget"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ask("fresh",
+		ollama.Message{Role: "user", Content: "Alice: fresh"},
+	)
+}
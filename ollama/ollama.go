@@ -12,11 +12,18 @@ import (
 	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
+
+	"github.com/dkotik/watermillchat"
 )
 
 type Request struct {
@@ -43,51 +50,162 @@ type Response struct {
 	EvalDuration       int64     `json:"eval_duration"`
 }
 
+const (
+	DefaultModel               = "llama3.2"
+	DefaultURL                 = defaultOllamaURL
+	DefaultSystemPrompt        = "You are a friendly participant of a group chat. Answer in one or two sentences."
+	DefaultMostHistoryMessages = 20
+	DefaultMostPromptRunes     = 8000
+	DefaultResetCommand        = "forget"
+)
+
 const defaultOllamaURL = "http://localhost:11434/api/chat"
 
+type Configuration struct {
+	// Model defaults to [DefaultModel].
+	Model string
+
+	// URL of the chat endpoint. Defaults to [DefaultURL].
+	URL string
+
+	// SystemPrompt starts every conversation.
+	// Defaults to [DefaultSystemPrompt].
+	SystemPrompt string
+
+	// MostHistoryMessages limits room messages the bot
+	// remembers. Defaults to [DefaultMostHistoryMessages].
+	MostHistoryMessages int
+
+	// MostPromptRunes is the character budget of a conversation,
+	// which roughly takes a quarter as many tokens. The oldest
+	// messages are left out to fit. Defaults to [DefaultMostPromptRunes].
+	MostPromptRunes int
+
+	// ResetCommand makes the bot forget the conversation of a room.
+	// It is registered with the chat by [Ollama.JoinChat]. Bots
+	// sharing a chat need different commands.
+	// Defaults to [DefaultResetCommand].
+	ResetCommand string
+
+	HTTPClient *http.Client
+	Logger     *slog.Logger
+}
+
+func (c Configuration) Validate() (err error) {
+	if c.Model == "" {
+		err = errors.Join(err, errors.New("model is required"))
+	}
+	if c.URL == "" {
+		err = errors.Join(err, errors.New("URL is required"))
+	}
+	if strings.TrimSpace(c.SystemPrompt) == "" {
+		err = errors.Join(err, errors.New("system prompt is required"))
+	}
+	if c.MostHistoryMessages < 0 {
+		err = errors.Join(err, errors.New("history messages are fewer than zero"))
+	}
+	if c.MostPromptRunes <= utf8.RuneCountInString(c.SystemPrompt) {
+		err = errors.Join(err, errors.New("prompt budget does not fit the system prompt"))
+	}
+	if c.ResetCommand == "" {
+		err = errors.Join(err, errors.New("reset command is required"))
+	}
+	if c.HTTPClient == nil {
+		err = errors.Join(err, errors.New("missing HTTP client"))
+	}
+	if c.Logger == nil {
+		err = errors.Join(err, errors.New("missing logger"))
+	}
+	return err
+}
+
 type Ollama struct {
-	model      string // llama3.2
-	client     http.Client
-	requestURL string
-	logger     *slog.Logger
+	model               string
+	client              *http.Client
+	requestURL          string
+	systemPrompt        string
+	mostHistoryMessages int
+	mostPromptRunes     int
+	resetCommand        string
+	logger              *slog.Logger
+
+	// forgotten holds the latest message of each
+	// room at the time its memory was reset.
+	forgotten map[string]string
+	// registered chats have the reset command.
+	registered map[*watermillchat.Chat]struct{}
+	mu         sync.Mutex
 }
 
-func New(model, URL string) *Ollama {
-	return &Ollama{
-		model:      cmp.Or(model, "llama3.2"),
-		client:     http.Client{},
-		requestURL: cmp.Or(URL, defaultOllamaURL),
-		logger:     slog.Default(),
+func New(c Configuration) (*Ollama, error) {
+	c.Model = cmp.Or(c.Model, DefaultModel)
+	c.URL = cmp.Or(c.URL, DefaultURL)
+	c.SystemPrompt = cmp.Or(c.SystemPrompt, DefaultSystemPrompt)
+	c.ResetCommand = cmp.Or(c.ResetCommand, DefaultResetCommand)
+	if c.MostHistoryMessages == 0 {
+		c.MostHistoryMessages = DefaultMostHistoryMessages
+	}
+	if c.MostPromptRunes == 0 {
+		c.MostPromptRunes = DefaultMostPromptRunes
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{}
 	}
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("unable to initialize Ollama bot: %w", err)
+	}
+	return &Ollama{
+		model:               c.Model,
+		client:              c.HTTPClient,
+		requestURL:          c.URL,
+		systemPrompt:        c.SystemPrompt,
+		mostHistoryMessages: c.MostHistoryMessages,
+		mostPromptRunes:     c.MostPromptRunes,
+		resetCommand:        c.ResetCommand,
+		logger:              c.Logger,
+		forgotten:           make(map[string]string),
+		registered:          make(map[*watermillchat.Chat]struct{}),
+	}, nil
 }
 
+// SendMessage answers a single message without any history.
 func (o *Ollama) SendMessage(ctx context.Context, m string) (string, error) {
+	return o.complete(ctx, []Message{
+		{Role: "system", Content: o.systemPrompt},
+		{Role: "user", Content: m},
+	})
+}
+
+// complete returns the answer of the model to a conversation.
+func (o *Ollama) complete(ctx context.Context, messages []Message) (string, error) {
 	js, err := json.Marshal(Request{
-		Model:  o.model,
-		Stream: false,
-		Messages: []Message{
-			{
-				Role:    "user",
-				Content: m,
-			},
-			{
-				Role:    "user",
-				Content: "Please answer in one or two sentences.",
-			},
-		},
+		Model:    o.model,
+		Stream:   false,
+		Messages: messages,
 	})
 	if err != nil {
 		return "", err
 	}
-	httpReq, err := http.NewRequest(http.MethodPost, o.requestURL, bytes.NewReader(js))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.requestURL, bytes.NewReader(js))
 	if err != nil {
 		return "", err
 	}
-	httpResp, err := o.client.Do(httpReq.WithContext(ctx))
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpResp, err := o.client.Do(httpReq)
 	if err != nil {
 		return "", err
 	}
 	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		failure := struct {
+			Error string `json:"error"`
+		}{}
+		_ = json.NewDecoder(io.LimitReader(httpResp.Body, 1<<16)).Decode(&failure)
+		return "", fmt.Errorf("model server responded with status %d: %s", httpResp.StatusCode, failure.Error)
+	}
 	ollamaResp := Response{}
 	err = json.NewDecoder(httpResp.Body).Decode(&ollamaResp)
 	return ollamaResp.Message.Content, err
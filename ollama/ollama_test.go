@@ -15,9 +15,9 @@ func newContext() (context.Context, context.CancelFunc) {
 }
 
 func TestBasicOllamaCall(t *testing.T) {
-	bot := ollama.New("", "")
-	if bot == nil {
-		t.Fatal("<nil> Ollama bot")
+	bot, err := ollama.New(ollama.Configuration{})
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	ctx, cancel := newContext()
@@ -0,0 +1,132 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// ErrInvalidPageSize is returned by [Chat.RoomHistory]
+// when the page cannot hold any messages.
+var ErrInvalidPageSize = errors.New("page size must be positive")
+
+// PagedHistory is a [HistoryRepository] that can list
+// messages older than a room retains.
+type PagedHistory interface {
+	// GetRoomMessagesBefore returns up to limit messages of a room
+	// stored before the message with the given ID, oldest first.
+	// Returns [ErrMessageNotFound] if the message is not kept.
+	GetRoomMessagesBefore(ctx context.Context, roomName, messageID string, limit int) ([]Message, error)
+}
+
+// RoomHistory returns up to limit messages of a room, oldest
+// first, that precede the message with the given ID. The latest
+// messages are returned when the ID is empty. Messages older than
+// the room retains are loaded from [PagedHistory]. The returned
+// cursor is the ID to request the previous page with. It is empty
+// when there are no older messages.
+func (c *Chat) RoomHistory(ctx context.Context, roomName, before string, limit int) (page []Message, cursor string, err error) {
+	if limit < 1 {
+		return nil, "", ErrInvalidPageSize
+	}
+	room, err := c.room(ctx, roomName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	room.mu.Lock()
+	end := len(room.messages)
+	if before != "" {
+		end = slices.IndexFunc(room.messages, func(m Message) bool {
+			return m.ID == before
+		})
+	}
+	if end >= 0 {
+		page = slices.Clone(room.messages[max(0, end-limit):end])
+	}
+	room.mu.Unlock()
+
+	if len(page) < limit {
+		older := before
+		if len(page) > 0 {
+			older = page[0].ID
+		}
+		paged, ok := c.history.(PagedHistory)
+		switch {
+		case older == "":
+			return page, "", nil // room is empty
+		case !ok && end < 0:
+			return nil, "", ErrMessageNotFound
+		case !ok:
+			return page, "", nil
+		}
+		loaded, err := paged.GetRoomMessagesBefore(ctx, roomName, older, limit-len(page))
+		if errors.Is(err, ErrMessageNotFound) && len(page) > 0 {
+			// retained message is not stored yet
+			return page, "", nil
+		} else if err != nil {
+			return nil, "", err
+		}
+		page = append(loaded, page...)
+	}
+	if len(page) == limit {
+		cursor = page[0].ID
+	}
+	return page, cursor, nil
+}
+
+// MessageContext returns the message with the given ID surrounded by
+// up to limit messages of the room on each side, oldest first. Messages
+// the room no longer retains are loaded from [PagedHistory] and
+// [ReplayableHistory]. Returns [ErrMessageNotFound] if the message
+// cannot be located.
+func (c *Chat) MessageContext(ctx context.Context, roomName, messageID string, limit int) ([]Message, error) {
+	if messageID == "" {
+		return nil, ErrMessageNotFound
+	}
+	before, _, err := c.RoomHistory(ctx, roomName, messageID, limit)
+	if err != nil {
+		return nil, err
+	}
+	room, err := c.room(ctx, roomName)
+	if err != nil {
+		return nil, err
+	}
+	room.mu.Lock()
+	if i := slices.IndexFunc(room.messages, func(m Message) bool {
+		return m.ID == messageID
+	}); i >= 0 {
+		// retained messages are the latest ones
+		before = append(before, room.messages[i:min(len(room.messages), i+1+limit)]...)
+		room.mu.Unlock()
+		return before, nil
+	}
+	room.mu.Unlock()
+
+	replayable, ok := c.history.(ReplayableHistory)
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+	if len(before) > 0 {
+		// the message follows the last one before it
+		after, err := replayable.GetRoomMessagesAfter(ctx, roomName, before[len(before)-1].ID, limit+1)
+		if err != nil {
+			return nil, err
+		}
+		return append(before, after...), nil
+	}
+	after, err := replayable.GetRoomMessagesAfter(ctx, roomName, messageID, limit)
+	if err != nil {
+		return nil, err
+	}
+	paged, ok := c.history.(PagedHistory)
+	if !ok || len(after) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	// the message precedes the first one after it
+	first, err := paged.GetRoomMessagesBefore(ctx, roomName, after[0].ID, 1)
+	if err != nil {
+		return nil, err
+	}
+	return append(first, after...), nil
+}
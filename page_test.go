@@ -0,0 +1,160 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+)
+
+func (r *replayableHistoryRepository) GetRoomMessagesBefore(ctx context.Context, roomName, messageID string, limit int) ([]Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.messages, func(m Message) bool {
+		return m.ID == messageID
+	})
+	if i < 0 {
+		return nil, ErrMessageNotFound
+	}
+	return slices.Clone(r.messages[max(0, i-limit):i]), nil
+}
+
+func TestRoomHistory(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		BlockPublishUntilSubscriberAck: true,
+	}, watermill.NopLogger{})
+	history := &replayableHistoryRepository{}
+	chat, err := New(ctx, Configuration{
+		Watermill: WatermillConfiguration{
+			Publisher:  pubSub,
+			Subscriber: pubSub,
+		},
+		History: HistoryConfiguration{
+			Repository:          history,
+			MostMessagesPerRoom: 3,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		if err = chat.Broadcast(ctx, Broadcast{
+			RoomName: "testRoom",
+			Message:  Message{Content: "test message"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// retain exactly three messages
+	chat.mu.Lock()
+	chat.rooms["testRoom"].cleanOut(0, 3)
+	chat.mu.Unlock()
+	ids := history.ids()
+
+	page := func(before string, limit int) ([]string, string) {
+		t.Helper()
+		messages, cursor, err := chat.RoomHistory(ctx, "testRoom", before, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pageIDs := make([]string, len(messages))
+		for i, m := range messages {
+			pageIDs[i] = m.ID
+		}
+		return pageIDs, cursor
+	}
+
+	latest, cursor := page("", 2)
+	if !slices.Equal(latest, ids[3:]) || cursor != ids[3] {
+		t.Fatal("unexpected latest page:", latest, cursor)
+	}
+	// joins the oldest retained message with history
+	middle, cursor := page(cursor, 2)
+	if !slices.Equal(middle, ids[1:3]) || cursor != ids[1] {
+		t.Fatal("unexpected middle page:", middle, cursor)
+	}
+	oldest, cursor := page(cursor, 2)
+	if !slices.Equal(oldest, ids[:1]) || cursor != "" {
+		t.Fatal("unexpected oldest page:", oldest, cursor)
+	}
+
+	if _, _, err = chat.RoomHistory(ctx, "testRoom", "unknown", 2); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatal("unknown cursor was accepted:", err)
+	}
+	if _, _, err = chat.RoomHistory(ctx, "testRoom", "", 0); !errors.Is(err, ErrInvalidPageSize) {
+		t.Fatal("empty page was accepted:", err)
+	}
+}
+
+func TestMessageContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		BlockPublishUntilSubscriberAck: true,
+	}, watermill.NopLogger{})
+	history := &replayableHistoryRepository{}
+	chat, err := New(ctx, Configuration{
+		Watermill: WatermillConfiguration{
+			Publisher:  pubSub,
+			Subscriber: pubSub,
+		},
+		History: HistoryConfiguration{
+			Repository:          history,
+			MostMessagesPerRoom: 3,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		if err = chat.Broadcast(ctx, Broadcast{
+			RoomName: "testRoom",
+			Message:  Message{Content: "test message"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// retain exactly three messages
+	chat.mu.Lock()
+	chat.rooms["testRoom"].cleanOut(0, 3)
+	chat.mu.Unlock()
+	ids := history.ids()
+
+	for _, tc := range []struct {
+		Name      string
+		MessageID string
+		Limit     int
+		Expected  []string
+	}{
+		{Name: "retained", MessageID: ids[2], Limit: 1, Expected: ids[1:4]},
+		{Name: "stored", MessageID: ids[1], Limit: 1, Expected: ids[0:3]},
+		{Name: "oldest", MessageID: ids[0], Limit: 2, Expected: ids[0:3]},
+		{Name: "latest", MessageID: ids[4], Limit: 2, Expected: ids[2:5]},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			messages, err := chat.MessageContext(ctx, "testRoom", tc.MessageID, tc.Limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			contextIDs := make([]string, len(messages))
+			for i, m := range messages {
+				contextIDs[i] = m.ID
+			}
+			if !slices.Equal(contextIDs, tc.Expected) {
+				t.Fatal("unexpected context:", contextIDs, "instead of", tc.Expected)
+			}
+		})
+	}
+
+	if _, err = chat.MessageContext(ctx, "testRoom", "unknown", 2); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatal("unknown message was found:", err)
+	}
+}
@@ -0,0 +1,162 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// MostPinnedMessagesPerRoom limits the pinned set of each room.
+const MostPinnedMessagesPerRoom = 10
+
+var (
+	ErrMessageNotFound       = errors.New("message not found")
+	ErrTooManyPinnedMessages = errors.New("room has too many pinned messages")
+)
+
+// PinnedHistory is a [HistoryRepository] that keeps pinned
+// messages of each room beyond the retention period.
+type PinnedHistory interface {
+	// GetPinnedMessages returns pinned messages sorted by pin time.
+	GetPinnedMessages(ctx context.Context, roomName string) ([]Message, error)
+}
+
+// PinEvent adds a message to the pinned set of a room.
+// It is an [EventKindPin] event.
+type PinEvent struct {
+	RoomName string
+	Message  Message
+	PinnedBy *Identity `json:",omitempty"`
+	PinnedAt int64
+}
+
+// UnpinEvent removes a message from the pinned set of a room.
+// It is an [EventKindUnpin] event.
+type UnpinEvent struct {
+	RoomName  string
+	MessageID string
+}
+
+// Pin highlights a retained message for everyone in the room.
+// The [Identity] in context, if any, is recorded as the one who
+// pinned it. Callers are responsible for checking that the
+// identity is allowed to moderate the room.
+func (c *Chat) Pin(ctx context.Context, roomName, messageID string) error {
+	room, err := c.room(ctx, roomName)
+	if err != nil {
+		return err
+	}
+	room.mu.Lock()
+	index := slices.IndexFunc(room.messages, func(m Message) bool {
+		return m.ID == messageID
+	})
+	var m Message
+	if index >= 0 {
+		m = room.messages[index]
+	}
+	alreadyPinned := slices.ContainsFunc(room.pinned, func(m Message) bool {
+		return m.ID == messageID
+	})
+	full := len(room.pinned) >= MostPinnedMessagesPerRoom
+	room.mu.Unlock()
+
+	switch {
+	case alreadyPinned:
+		return nil
+	case index < 0:
+		return ErrMessageNotFound
+	case full:
+		return ErrTooManyPinnedMessages
+	}
+
+	event := PinEvent{
+		RoomName: roomName,
+		Message:  m,
+		PinnedAt: c.clock.Now().Unix(),
+	}
+	if identity, ok := IdentityFromContext(ctx); ok {
+		event.PinnedBy = &identity
+	}
+	return c.publishEvent(ctx, EventKindPin, event)
+}
+
+// Unpin removes a message from the pinned set of a room.
+// Callers are responsible for checking that the
+// identity is allowed to moderate the room.
+func (c *Chat) Unpin(ctx context.Context, roomName, messageID string) error {
+	return c.publishEvent(ctx, EventKindUnpin, UnpinEvent{
+		RoomName:  roomName,
+		MessageID: messageID,
+	})
+}
+
+// SubscribePinned delivers the complete pinned set of a room
+// right away and again after every change until the context is done.
+func (c *Chat) SubscribePinned(ctx context.Context, roomName string) <-chan []Message {
+	ctx = c.untilClosed(ctx)
+	room, err := c.room(ctx, roomName)
+	if err != nil {
+		pinned := make(chan []Message)
+		close(pinned)
+		return pinned
+	}
+	return room.SubscribePinned(ctx)
+}
+
+// SubscribePinned delivers the pinned set on every change. Slow
+// subscribers skip intermediate versions of the set.
+func (r *Room) SubscribePinned(ctx context.Context) <-chan []Message {
+	pinned := make(chan []Message, 1)
+	r.mu.Lock()
+	pinned <- slices.Clone(r.pinned)
+	r.pinSubscribers = append(r.pinSubscribers, pinned)
+	r.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.pinSubscribers = slices.DeleteFunc(r.pinSubscribers, func(existing chan []Message) bool {
+			return existing == pinned
+		})
+		close(pinned)
+	}()
+	return pinned
+}
+
+// Pin adds a message to the pinned set, unless it is already there.
+func (r *Room) Pin(m Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if slices.ContainsFunc(r.pinned, func(existing Message) bool {
+		return existing.ID == m.ID
+	}) {
+		return
+	}
+	r.pinned = append(r.pinned, m)
+	r.deliverPinned()
+}
+
+// Unpin removes a message from the pinned set.
+func (r *Room) Unpin(messageID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := len(r.pinned)
+	r.pinned = slices.DeleteFunc(r.pinned, func(m Message) bool {
+		return m.ID == messageID
+	})
+	if len(r.pinned) != total {
+		r.deliverPinned()
+	}
+}
+
+// deliverPinned must be called while holding the lock.
+func (r *Room) deliverPinned() {
+	for _, subscriber := range r.pinSubscribers {
+		select {
+		case <-subscriber: // replace the version not yet received
+		default:
+		}
+		subscriber <- slices.Clone(r.pinned)
+	}
+}
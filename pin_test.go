@@ -0,0 +1,59 @@
+package watermillchat_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+)
+
+func TestPinnedMessages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := chat.Subscribe(ctx, "testRoom")
+	pinned := chat.SubscribePinned(ctx, "testRoom")
+	if set := <-pinned; len(set) != 0 {
+		t.Fatal("new room has pinned messages:", set)
+	}
+
+	if err = chat.Pin(ctx, "testRoom", "missing"); !errors.Is(err, watermillchat.ErrMessageNotFound) {
+		t.Fatal("unknown message was pinned:", err)
+	}
+	if err = chat.Broadcast(ctx, watermillchat.Broadcast{
+		RoomName: "testRoom",
+		Message:  watermillchat.Message{Content: "important"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	batch := <-messages
+	if err = chat.Pin(ctx, "testRoom", batch[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("pinned set was not delivered")
+	case set := <-pinned:
+		if len(set) != 1 || set[0].Content != "important" {
+			t.Fatal("unexpected pinned set:", set)
+		}
+	}
+
+	if err = chat.Unpin(ctx, "testRoom", batch[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("pinned set was not delivered")
+	case set := <-pinned:
+		if len(set) != 0 {
+			t.Fatal("message was not unpinned:", set)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMostLinkPreviewsPerMessage = 3
+	DefaultLinkPreviewTimeout         = time.Second * 10
+)
+
+// LinkPreview summarizes a linked page for display under a [Message].
+type LinkPreview struct {
+	URL         string
+	SiteName    string `json:",omitempty"`
+	Title       string `json:",omitempty"`
+	Description string `json:",omitempty"`
+	Image       string `json:",omitempty"`
+}
+
+// LinkPreviewer fetches a [LinkPreview] for an absolute URL.
+type LinkPreviewer interface {
+	PreviewLink(ctx context.Context, url string) (LinkPreview, error)
+}
+
+// PreviewEvent attaches link previews to a message that
+// was already published. It is an [EventKindPreview] event.
+type PreviewEvent struct {
+	RoomName  string
+	MessageID string
+	Previews  []LinkPreview
+}
+
+type LinkPreviewConfiguration struct {
+	// Previewer fetches previews after a message is published.
+	// Link previews are disabled when <nil>.
+	Previewer LinkPreviewer
+
+	// MostPerMessage limits the number of links previewed for
+	// each message. Defaults to [DefaultMostLinkPreviewsPerMessage].
+	MostPerMessage int
+
+	// Timeout limits the time spent fetching all previews
+	// for a message. Defaults to [DefaultLinkPreviewTimeout].
+	Timeout time.Duration
+}
+
+func (c LinkPreviewConfiguration) Validate() (err error) {
+	if c.MostPerMessage < 1 {
+		err = errors.Join(err, errors.New("most link previews per message is lower than one"))
+	}
+	if c.Timeout < time.Millisecond {
+		err = errors.Join(err, errors.New("link preview timeout is lower than one millisecond"))
+	}
+	return err
+}
+
+// PreviewableLinks returns unique absolute links in message content.
+func PreviewableLinks(content string) (links []string) {
+	for _, link := range linkPattern.FindAllString(content, -1) {
+		link = strings.TrimRight(link, ".,;:!?)")
+		if strings.HasPrefix(strings.ToLower(link), "www.") {
+			link = "https://" + link
+		}
+		if !slices.Contains(links, link) {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// previewLinks runs the [LinkPreviewer] in the background and publishes
+// a [PreviewEvent], if any of the links produced a preview.
+func (c *Chat) previewLinks(b Broadcast) {
+	if c.linkPreviewer == nil {
+		return
+	}
+	links := PreviewableLinks(b.Content)
+	if len(links) == 0 {
+		return
+	}
+	if len(links) > c.mostLinkPreviews {
+		links = links[:c.mostLinkPreviews]
+	}
+
+	c.goTask(func() {
+		ctx, cancel := context.WithTimeout(c.running, c.linkPreviewTimeout)
+		defer cancel()
+
+		previews := make([]LinkPreview, 0, len(links))
+		for _, link := range links {
+			preview, err := c.linkPreviewer.PreviewLink(ctx, link)
+			if err != nil {
+				c.logger.Debug("unable to preview link", slog.String("link", link), slog.Any("error", err))
+				continue
+			}
+			previews = append(previews, preview)
+		}
+		if len(previews) == 0 {
+			return
+		}
+		if err := c.publishEvent(ctx, EventKindPreview, PreviewEvent{
+			RoomName:  b.RoomName,
+			MessageID: b.ID,
+			Previews:  previews,
+		}); err != nil {
+			c.logger.Warn("unable to publish link previews", slog.String("message_id", b.ID), slog.Any("error", err))
+		}
+	})
+}
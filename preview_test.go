@@ -0,0 +1,72 @@
+package watermillchat_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+	"github.com/dkotik/watermillchat/unfurl"
+)
+
+func TestPreviewableLinks(t *testing.T) {
+	links := watermillchat.PreviewableLinks("see https://a.test/x. and www.b.test, https://a.test/x again")
+	if !slices.Equal(links, []string{"https://a.test/x", "https://www.b.test"}) {
+		t.Fatal("unexpected links:", links)
+	}
+}
+
+func TestLinkPreviewEnrichment(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><head><meta property="og:title" content="Linked Page"></head></html>`))
+	}))
+	defer site.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	previewer, err := unfurl.New(unfurl.Configuration{AllowPrivateNetworks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		Previews: watermillchat.LinkPreviewConfiguration{Previewer: previewer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := chat.Subscribe(ctx, "testRoom")
+	if err = chat.Broadcast(ctx, watermillchat.Broadcast{
+		RoomName: "testRoom",
+		Message:  watermillchat.Message{Content: "look at " + site.URL},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var original string
+	for {
+		select {
+		case <-ctx.Done():
+			t.Fatal("link preview was not delivered")
+		case batch := <-messages:
+			for _, m := range batch {
+				if original == "" {
+					original = m.ID
+				} else if m.ID != original {
+					t.Fatal("enrichment was delivered as a new message:", m.ID)
+				}
+				if len(m.Previews) == 0 {
+					continue
+				}
+				if len(m.Previews) != 1 || m.Previews[0].Title != "Linked Page" {
+					t.Fatal("unexpected previews:", m.Previews)
+				}
+				return
+			}
+		}
+	}
+}
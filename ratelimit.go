@@ -0,0 +1,138 @@
+package watermillchat
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited matches any [RateLimitError] using [errors.Is].
+var ErrRateLimited = errors.New("too many messages")
+
+// RateLimit describes a token bucket. The bucket holds up to Burst
+// tokens and regains one token every Interval.
+type RateLimit struct {
+	Interval time.Duration
+	Burst    int
+}
+
+func (l RateLimit) Validate() (err error) {
+	if l.Interval <= 0 {
+		err = errors.Join(err, errors.New("rate limit interval must be positive"))
+	}
+	if l.Burst < 1 {
+		err = errors.Join(err, errors.New("rate limit burst is lower than one"))
+	}
+	return err
+}
+
+type RateLimitConfiguration struct {
+	// PerIdentity constrains how quickly a single [Identity] can
+	// broadcast messages across all rooms. Messages without
+	// an author are not limited. Defaults to [DefaultRateLimitPerIdentity].
+	PerIdentity RateLimit
+
+	// PerRoom constrains how quickly messages can be broadcast
+	// into a single room by all authors combined. Defaults to [DefaultRateLimitPerRoom].
+	PerRoom RateLimit
+}
+
+// RateLimitError is returned by [Chat.Broadcast] when
+// a message is rejected by a rate limiter.
+type RateLimitError struct {
+	// Scope is either "identity" or "room".
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("too many messages sent by %s, retry after %s", e.Scope, e.RetryAfter.Round(time.Second/10))
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+func (e *RateLimitError) HyperTextStatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type rateLimiter struct {
+	scope    string
+	interval time.Duration
+	burst    float64
+	buckets  map[string]*tokenBucket
+	mu       sync.Mutex
+}
+
+func newRateLimiter(scope string, l RateLimit) *rateLimiter {
+	return &rateLimiter{
+		scope:    scope,
+		interval: l.Interval,
+		burst:    float64(l.Burst),
+		buckets:  make(map[string]*tokenBucket),
+	}
+}
+
+func (l *rateLimiter) refill(b *tokenBucket, now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+float64(elapsed)/float64(l.interval))
+		b.updated = now
+	}
+}
+
+// Take removes one token from the bucket associated with the key
+// or returns a [RateLimitError] if the bucket is empty.
+func (l *rateLimiter) Take(key string, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+	if b.tokens < 1 {
+		return &RateLimitError{
+			Scope:      l.scope,
+			RetryAfter: time.Duration((1 - b.tokens) * float64(l.interval)),
+		}
+	}
+	b.tokens--
+	return nil
+}
+
+// Refund returns a token taken for a message that
+// was not sent, because another limit rejected it.
+func (l *rateLimiter) Refund(key string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[key]; ok {
+		l.refill(b, now)
+		b.tokens = math.Min(l.burst, b.tokens+1)
+	}
+}
+
+// Prune forgets buckets that refilled completely, because
+// they are indistinguishable from new ones.
+func (l *rateLimiter) Prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
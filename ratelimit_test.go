@@ -0,0 +1,110 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter("test", RateLimit{Interval: time.Second, Burst: 3})
+	now := time.Now()
+
+	for range 3 {
+		if err := limiter.Take("key", now); err != nil {
+			t.Fatal("token bucket was emptied too early:", err)
+		}
+	}
+	err := limiter.Take("key", now)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatal("token bucket did not overflow:", err)
+	}
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) || rateLimitErr.RetryAfter != time.Second {
+		t.Fatal("unexpected retry delay:", err)
+	}
+	if err = limiter.Take("other", now); err != nil {
+		t.Fatal("keys share a token bucket:", err)
+	}
+
+	now = now.Add(time.Second)
+	if err = limiter.Take("key", now); err != nil {
+		t.Fatal("token bucket did not refill:", err)
+	}
+
+	limiter.Prune(now.Add(time.Second * 3))
+	if len(limiter.buckets) != 0 {
+		t.Fatal("full token buckets were not pruned:", len(limiter.buckets))
+	}
+}
+
+func TestBroadcastRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chat, err := New(ctx, Configuration{
+		RateLimit: RateLimitConfiguration{
+			PerIdentity: RateLimit{Interval: time.Hour, Burst: 2},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broadcast := func(author string) error {
+		return chat.Broadcast(ctx, Broadcast{
+			RoomName: "testRoom",
+			Message: Message{
+				Author:  &Identity{ID: author, Name: author},
+				Content: "test message",
+			},
+		})
+	}
+	for range 2 {
+		if err = broadcast("spammer"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = broadcast("spammer"); !errors.Is(err, ErrRateLimited) {
+		t.Fatal("identity was not rate limited:", err)
+	}
+	if err = broadcast("bystander"); err != nil {
+		t.Fatal("rate limit leaked to another identity:", err)
+	}
+}
+
+func TestRoomRateLimitKeepsIdentityTokens(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chat, err := New(ctx, Configuration{
+		RateLimit: RateLimitConfiguration{
+			PerIdentity: RateLimit{Interval: time.Hour, Burst: 2},
+			PerRoom:     RateLimit{Interval: time.Hour, Burst: 1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broadcast := func(roomName string) error {
+		return chat.Broadcast(ctx, Broadcast{
+			RoomName: roomName,
+			Message: Message{
+				Author:  &Identity{ID: "alice", Name: "alice"},
+				Content: "test message",
+			},
+		})
+	}
+	if err = broadcast("busyRoom"); err != nil {
+		t.Fatal(err)
+	}
+	var rateLimitErr *RateLimitError
+	if err = broadcast("busyRoom"); !errors.As(err, &rateLimitErr) || rateLimitErr.Scope != "room" {
+		t.Fatal("room was not rate limited:", err)
+	}
+	if err = broadcast("quietRoom"); err != nil {
+		t.Fatal("identity was charged for a message the room rejected:", err)
+	}
+}
@@ -0,0 +1,92 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MostRunesPerReaction fits emoji sequences, like flags
+// and families, which are made of several runes.
+const MostRunesPerReaction = 16
+
+var (
+	ErrIdentityRequired = errors.New("identity is required")
+	ErrInvalidReaction  = &InvalidContentError{Reason: "reaction must be a short emoji or word"}
+)
+
+// Reaction is a short emoji added to a [Message] by its Authors.
+type Reaction struct {
+	Emoji   string
+	Authors []Identity
+}
+
+// ReactionEvent adds a reaction of its Author to a message
+// or removes it, if the author already reacted the same way.
+// It is an [EventKindReaction] event.
+type ReactionEvent struct {
+	RoomName  string
+	MessageID string
+	Emoji     string
+	Author    Identity
+	CreatedAt int64
+}
+
+// React toggles a reaction of the [Identity] in context to a
+// retained message. Reacting twice the same way removes the reaction.
+func (c *Chat) React(ctx context.Context, roomName, messageID, emoji string) (err error) {
+	if c.closing.Err() != nil {
+		return ErrChatClosed
+	}
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return ErrIdentityRequired
+	}
+	emoji = strings.TrimSpace(emoji)
+	if emoji == "" || utf8.RuneCountInString(emoji) > MostRunesPerReaction || strings.ContainsFunc(emoji, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}) {
+		return ErrInvalidReaction
+	}
+	if _, err = c.retainedMessage(ctx, roomName, messageID); err != nil {
+		return err
+	}
+	now := c.clock.Now()
+	if err = c.identityLimiter.Take(identity.ID, now); err != nil {
+		return err
+	}
+	return c.publishEvent(ctx, EventKindReaction, ReactionEvent{
+		RoomName:  roomName,
+		MessageID: messageID,
+		Emoji:     emoji,
+		Author:    identity,
+		CreatedAt: now.Unix(),
+	})
+}
+
+// toggleReaction applies a [ReactionEvent] to message reactions.
+func toggleReaction(reactions []Reaction, emoji string, author Identity) []Reaction {
+	i := slices.IndexFunc(reactions, func(r Reaction) bool {
+		return r.Emoji == emoji
+	})
+	if i < 0 {
+		return append(reactions, Reaction{Emoji: emoji, Authors: []Identity{author}})
+	}
+	reaction := reactions[i]
+	if j := slices.IndexFunc(reaction.Authors, func(existing Identity) bool {
+		return existing.ID == author.ID
+	}); j >= 0 {
+		reaction.Authors = slices.Delete(slices.Clone(reaction.Authors), j, j+1)
+	} else {
+		reaction.Authors = append(slices.Clone(reaction.Authors), author)
+	}
+	reactions = slices.Clone(reactions)
+	if len(reaction.Authors) == 0 {
+		return slices.Delete(reactions, i, i+1)
+	}
+	reactions[i] = reaction
+	return reactions
+}
@@ -0,0 +1,82 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+)
+
+// ReplayableHistory is a [HistoryRepository] that can recover
+// messages a client missed while it was disconnected.
+type ReplayableHistory interface {
+	// GetRoomMessagesAfter returns up to limit messages of a room
+	// stored after the message with the given ID, oldest first.
+	// Returns [ErrMessageNotFound] if the message is not kept.
+	GetRoomMessagesAfter(ctx context.Context, roomName, messageID string, limit int) ([]Message, error)
+}
+
+// SubscribeAfter is [Chat.Subscribe] for a client that reconnects
+// after receiving the message with the given ID. The first batch
+// holds retained messages up to that one followed by the messages
+// the client missed. When they are no longer retained, they are
+// recovered from [ReplayableHistory] and the first batch holds
+// only the missed messages. Returns false if the message cannot
+// be found, and the first batch is the same as of [Chat.Subscribe].
+func (c *Chat) SubscribeAfter(ctx context.Context, roomName, messageID string) (<-chan []Message, bool) {
+	room := c.subscribedRoom(roomName)
+	var (
+		missed    []Message
+		recovered bool
+	)
+	if !room.retains(messageID) {
+		missed, recovered = c.recoverMissed(ctx, roomName, messageID)
+	}
+
+	found := true
+	batches := room.subscribe(c.untilClosed(ctx), func(retained []Message) []Message {
+		if slices.ContainsFunc(retained, func(m Message) bool {
+			return m.ID == messageID
+		}) {
+			return slices.Clone(retained)
+		}
+		if !recovered {
+			found = false
+			return slices.Clone(retained)
+		}
+		// retained messages are newer than the one that
+		// expired, but some of them are recovered already
+		first := slices.Clone(missed)
+		for _, m := range retained {
+			if !slices.ContainsFunc(missed, func(each Message) bool {
+				return each.ID == m.ID
+			}) {
+				first = append(first, m)
+			}
+		}
+		return first
+	})
+	return batches, found
+}
+
+// recoverMissed loads messages after the given one from history.
+// Clients that missed more than a room retains are not recovered,
+// because they would receive more than a new client does.
+func (c *Chat) recoverMissed(ctx context.Context, roomName, messageID string) ([]Message, bool) {
+	replayable, ok := c.history.(ReplayableHistory)
+	if !ok {
+		return nil, false
+	}
+	missed, err := replayable.GetRoomMessagesAfter(ctx, roomName, messageID, c.historyDepth+1)
+	if err != nil {
+		if !errors.Is(err, ErrMessageNotFound) {
+			c.logger.Warn("unable to recover missed messages",
+				slog.String("roomName", roomName),
+				slog.String("messageID", messageID),
+				slog.Any("error", err),
+			)
+		}
+		return nil, false
+	}
+	return missed, len(missed) <= c.historyDepth
+}
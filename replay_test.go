@@ -0,0 +1,153 @@
+package watermillchat
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+)
+
+// replayableHistoryRepository keeps every message of a single room.
+type replayableHistoryRepository struct {
+	messages []Message
+	mu       sync.Mutex
+}
+
+func (r *replayableHistoryRepository) Listen(broadcasts <-chan *message.Message) {
+	for m := range broadcasts {
+		if EventKindOf(m) == EventKindBroadcast {
+			b := Broadcast{}
+			if err := json.Unmarshal(m.Payload, &b); err == nil {
+				r.mu.Lock()
+				r.messages = append(r.messages, b.Message)
+				r.mu.Unlock()
+			}
+		}
+		m.Ack()
+	}
+}
+
+func (r *replayableHistoryRepository) GetRoomMessages(ctx context.Context, roomName string) ([]Message, error) {
+	return nil, nil
+}
+
+func (r *replayableHistoryRepository) GetRoomMessagesAfter(ctx context.Context, roomName, messageID string, limit int) ([]Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.messages, func(m Message) bool {
+		return m.ID == messageID
+	})
+	if i < 0 {
+		return nil, ErrMessageNotFound
+	}
+	after := r.messages[i+1:]
+	return slices.Clone(after[:min(limit, len(after))]), nil
+}
+
+func (r *replayableHistoryRepository) ids() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, len(r.messages))
+	for i, m := range r.messages {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+func TestSubscribeAfter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// every broadcast reaches the room before publishing returns
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		BlockPublishUntilSubscriberAck: true,
+	}, watermill.NopLogger{})
+	history := &replayableHistoryRepository{}
+	chat, err := New(ctx, Configuration{
+		Watermill: WatermillConfiguration{
+			Publisher:  pubSub,
+			Subscriber: pubSub,
+		},
+		History: HistoryConfiguration{
+			Repository:          history,
+			MostMessagesPerRoom: 3,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	broadcast := func() {
+		t.Helper()
+		if err := chat.Broadcast(ctx, Broadcast{
+			RoomName: "testRoom",
+			Message:  Message{Content: "test message"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		// retain exactly three messages
+		chat.mu.Lock()
+		chat.rooms["testRoom"].cleanOut(0, 3)
+		chat.mu.Unlock()
+	}
+	firstBatch := func(lastID string) ([]string, bool) {
+		t.Helper()
+		subscriptionCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		batches, found := chat.SubscribeAfter(subscriptionCtx, "testRoom", lastID)
+		batch := <-batches
+		ids := make([]string, len(batch))
+		for i, m := range batch {
+			ids[i] = m.ID
+		}
+		return ids, found
+	}
+
+	for range 4 {
+		broadcast()
+	}
+	ids := history.ids()
+
+	t.Run("retained", func(t *testing.T) {
+		batch, found := firstBatch(ids[2])
+		if !found {
+			t.Fatal("retained message was not found")
+		}
+		if !slices.Equal(batch, ids[1:]) {
+			t.Fatal("first batch does not hold retained messages:", batch)
+		}
+	})
+
+	t.Run("recovered from history", func(t *testing.T) {
+		batch, found := firstBatch(ids[0])
+		if !found {
+			t.Fatal("expired message was not found in history")
+		}
+		if !slices.Equal(batch, ids[1:]) {
+			t.Fatal("first batch does not hold missed messages:", batch)
+		}
+	})
+
+	t.Run("missed too many", func(t *testing.T) {
+		broadcast()
+		ids := history.ids()
+		batch, found := firstBatch(ids[0])
+		if found {
+			t.Fatal("replayed more messages than a room retains")
+		}
+		if !slices.Equal(batch, ids[2:]) {
+			t.Fatal("first batch does not hold retained messages:", batch)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		if _, found := firstBatch("unknown"); found {
+			t.Fatal("unknown message was found")
+		}
+	})
+}
@@ -9,41 +9,176 @@ import (
 
 type Room struct {
 	messages []Message
-	clients  []chan Message
+	clients  []roomClient
+
+	// pinned messages are kept apart from retained messages,
+	// so that they do not expire.
+	pinned         []Message
+	pinSubscribers []chan []Message
+
+	typing            []typist
+	typingSubscribers []chan []Identity
+
+	// members are authors that spoke in the room, indexed by [Identity.ID].
+	members map[string]Identity
+
+	// lastActivity is the creation time of the latest message.
+	lastActivity int64
+
+	// clock paces subscription batches. Defaults to [SystemClock].
+	clock Clock
 
 	mu sync.Mutex
 }
 
+// newRoom creates a room that retains up to depth latest messages.
+func newRoom(history []Message, depth int, clock Clock) *Room {
+	if grow := depth - len(history); grow > 0 {
+		history = slices.Grow(history, grow) // increase capacity
+	} else if grow < 0 {
+		history = history[-grow:]      // truncate earlier messages
+		history = slices.Clip(history) // truncate capacity
+	}
+	r := &Room{
+		messages: history,
+		members:  make(map[string]Identity),
+		clock:    clock,
+	}
+	for _, m := range history {
+		if m.Author != nil {
+			r.members[m.Author.ID] = *m.Author
+		}
+		r.lastActivity = max(r.lastActivity, m.CreatedAt)
+	}
+	return r
+}
+
+// Send retains a message and delivers it to clients. Messages
+// delivered again while retained, like a scheduled broadcast
+// published once more after an interrupted attempt, are ignored.
 func (r *Room) Send(ctx context.Context, m Message) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if m.ID != "" && slices.ContainsFunc(r.messages, func(each Message) bool {
+		return each.ID == m.ID
+	}) {
+		return nil
+	}
+
 	if length := len(r.messages); length >= cap(r.messages) && length > 0 {
 		r.messages = r.messages[1:]
 	}
 	r.messages = append(r.messages, m)
+	if m.Author != nil {
+		if r.members == nil {
+			r.members = make(map[string]Identity)
+		}
+		r.members[m.Author.ID] = *m.Author
+		r.stopTyping(m.Author.ID)
+	}
+	r.lastActivity = max(r.lastActivity, m.CreatedAt)
 	// slog.Warn("added message to history",
 	// 	slog.String("messageID", m.ID),
 	// 	slog.String("content", m.Content),
 	// 	slog.Int("historySize", len(r.messages)),
 	// )
+	return r.deliver(ctx, m)
+}
+
+// Update applies changes to a retained message and delivers
+// its new version to clients, which recognize it by [Message.ID].
+// Messages that are no longer retained are ignored.
+func (r *Room) Update(ctx context.Context, messageID string, apply func(*Message)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, pinned := range r.pinned {
+		if pinned.ID == messageID {
+			apply(&r.pinned[i])
+			r.deliverPinned()
+		}
+	}
+	for i := len(r.messages) - 1; i >= 0; i-- {
+		if r.messages[i].ID == messageID {
+			apply(&r.messages[i])
+			return r.deliver(ctx, r.messages[i])
+		}
+	}
+	return nil
+}
+
+// roomClient is a subscription of the [Identity]
+// found in its context, if any.
+type roomClient struct {
+	identityID string
+	messages   chan Message
+}
+
+// deliver must be called while holding the lock.
+func (r *Room) deliver(ctx context.Context, m Message) error {
+	for _, client := range r.clients {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case client.messages <- m:
+		}
+	}
+	return nil
+}
+
+// deliverTo sends an [Message.Ephemeral] message to subscriptions
+// of one identity without retaining it.
+func (r *Room) deliverTo(ctx context.Context, identityID string, m Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	for _, client := range r.clients {
+		if client.identityID != identityID {
+			continue
+		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case client <- m:
+		case client.messages <- m:
 		}
 	}
 	return nil
 }
 
+// Subscribe delivers retained messages followed by new ones in
+// batches. Every batch is ordered oldest first, like the retained
+// messages, so that clients can append batches as they arrive.
 func (r *Room) Subscribe(ctx context.Context) <-chan []Message {
+	return r.subscribe(ctx, slices.Clone[[]Message])
+}
+
+// retains reports if the message is among retained messages.
+func (r *Room) retains(messageID string) bool {
 	r.mu.Lock()
-	history := make([]Message, len(r.messages))
-	copy(history, r.messages)
+	defer r.mu.Unlock()
+	return slices.ContainsFunc(r.messages, func(m Message) bool {
+		return m.ID == messageID
+	})
+}
+
+// subscribe delivers the first batch chosen from retained
+// messages, which must not be modified, followed by new ones.
+// Subscriptions with an [Identity] in context also receive
+// messages delivered to that identity.
+func (r *Room) subscribe(ctx context.Context, first func(retained []Message) []Message) <-chan []Message {
+	identity, _ := IdentityFromContext(ctx)
+	r.mu.Lock()
+	history := first(r.messages)
 	client := make(chan Message, cap(r.messages)/4+1)
-	r.clients = append(r.clients, client)
+	r.clients = append(r.clients, roomClient{
+		identityID: identity.ID,
+		messages:   client,
+	})
+	clock := r.clock
 	r.mu.Unlock()
+	if clock == nil {
+		clock = SystemClock{}
+	}
 
 	batches := make(chan []Message, cap(client)/2+1)
 	if len(history) > 0 {
@@ -55,7 +190,7 @@ func (r *Room) Subscribe(ctx context.Context) <-chan []Message {
 		defer func() {
 			r.mu.Lock()
 			for i, existing := range r.clients {
-				if existing == client {
+				if existing.messages == client {
 					r.clients = slices.Delete(r.clients, i, i+1)
 					close(client)
 				}
@@ -63,7 +198,8 @@ func (r *Room) Subscribe(ctx context.Context) <-chan []Message {
 			r.mu.Unlock()
 			close(batches)
 		}()
-		tick := time.NewTicker(time.Millisecond * 300)
+		tick := clock.NewTicker(time.Millisecond * 300)
+		defer tick.Stop()
 		limit := cap(client)
 		batch := make([]Message, 0, limit)
 
@@ -76,15 +212,17 @@ func (r *Room) Subscribe(ctx context.Context) <-chan []Message {
 				if len(batch) >= limit {
 					batchCopy := make([]Message, len(batch))
 					copy(batchCopy, batch)
-					slices.Reverse(batchCopy)
 					batches <- batchCopy
 					batch = batch[:0] // truncate
 				}
-			case <-tick.C:
+			case <-tick.C():
+				// include messages that arrived together with the tick
+				for len(batch) < limit && len(client) > 0 {
+					batch = append(batch, <-client)
+				}
 				if len(batch) > 0 {
 					batchCopy := make([]Message, len(batch))
 					copy(batchCopy, batch)
-					slices.Reverse(batchCopy)
 					batches <- batchCopy
 					batch = batch[:0] // truncate
 				}
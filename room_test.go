@@ -3,6 +3,7 @@ package watermillchat
 import (
 	"context"
 	"fmt"
+	"slices"
 	"testing"
 	"time"
 )
@@ -32,3 +33,87 @@ func TestRoom(t *testing.T) {
 	}
 	t.Log("-- channel closed --")
 }
+
+func TestRoomPinnedSurvivesCleanOut(t *testing.T) {
+	r := newRoom([]Message{{ID: "old", CreatedAt: 1}, {ID: "new", CreatedAt: 100}}, 10, SystemClock{})
+	r.Pin(r.messages[0])
+	r.cleanOut(50, 1)
+	if len(r.messages) != 1 || r.messages[0].ID != "new" {
+		t.Fatal("retention was not applied:", r.messages)
+	}
+	if len(r.pinned) != 1 || r.pinned[0].ID != "old" {
+		t.Fatal("pinned message did not survive retention:", r.pinned)
+	}
+}
+
+func TestRoomSubscriptionFlushesOnTick(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	clock := NewFakeClock(time.Unix(1_700_000_000, 0))
+	r := newRoom(nil, 10, clock)
+	messages := r.Subscribe(ctx)
+	if err := clock.BlockUntil(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Send(ctx, Message{ID: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Millisecond * 300)
+	if batch := <-messages; len(batch) != 1 || batch[0].ID != "first" {
+		t.Fatal("unexpected batch:", batch)
+	}
+}
+
+func TestRoomSubscriptionBatchesOldestFirst(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	clock := NewFakeClock(time.Unix(1_700_000_000, 0))
+	r := newRoom([]Message{{ID: "retained"}}, 10, clock)
+	messages := r.Subscribe(ctx)
+	if batch := <-messages; len(batch) != 1 || batch[0].ID != "retained" {
+		t.Fatal("unexpected retained batch:", batch)
+	}
+	if err := clock.BlockUntil(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(batch []Message) (ids []string) {
+		for _, m := range batch {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+	for _, id := range []string{"first", "second", "third"} {
+		if err := r.Send(ctx, Message{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// full batch is flushed without waiting for a tick
+	if batch := ids(<-messages); !slices.Equal(batch, []string{"first", "second", "third"}) {
+		t.Fatal("full batch is out of order:", batch)
+	}
+	for _, id := range []string{"fourth", "fifth"} {
+		if err := r.Send(ctx, Message{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.Advance(time.Millisecond * 300)
+	if batch := ids(<-messages); !slices.Equal(batch, []string{"fourth", "fifth"}) {
+		t.Fatal("partial batch is out of order:", batch)
+	}
+}
+
+func TestRoomIgnoresRepeatedMessages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	r := newRoom(nil, 10, SystemClock{})
+	for range 2 {
+		if err := r.Send(ctx, Message{ID: "repeated"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(r.messages) != 1 {
+		t.Fatal("repeated message was retained twice:", r.messages)
+	}
+}
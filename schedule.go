@@ -0,0 +1,234 @@
+package watermillchat
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+const (
+	DefaultSchedulePollInterval = time.Second
+	DefaultScheduleLease        = time.Minute
+)
+
+var ErrScheduledBroadcastNotFound = errors.New("scheduled broadcast not found")
+
+// ScheduledBroadcast is published by [Chat] when its time comes.
+// ID becomes the [Message.ID], so that a broadcast published again
+// after an interrupted attempt is recognized as a repeat.
+type ScheduledBroadcast struct {
+	ID string
+	Broadcast
+	At int64
+}
+
+// ScheduleStore keeps scheduled broadcasts until they are published.
+// Durable stores allow the schedule to survive restarts.
+type ScheduleStore interface {
+	AddScheduled(context.Context, ScheduledBroadcast) error
+	// ClaimScheduled returns broadcasts due at or before now
+	// and hides them from other claims until the lease runs out.
+	ClaimScheduled(ctx context.Context, now time.Time, lease time.Duration) ([]ScheduledBroadcast, error)
+	// RemoveScheduled returns [ErrScheduledBroadcastNotFound]
+	// for unknown identifiers.
+	RemoveScheduled(ctx context.Context, id string) error
+	// ListScheduled returns pending broadcasts of
+	// a room sorted by their time.
+	ListScheduled(ctx context.Context, roomName string) ([]ScheduledBroadcast, error)
+}
+
+type ScheduleConfiguration struct {
+	// Store defaults to [MemoryScheduleStore].
+	Store ScheduleStore
+
+	// PollInterval is the pause between checks for due
+	// broadcasts. Defaults to [DefaultSchedulePollInterval].
+	PollInterval time.Duration
+
+	// Lease is how long a claimed broadcast is hidden from
+	// other schedulers. It is claimed again after the lease runs
+	// out, if the claiming process did not publish it before
+	// stopping. Defaults to [DefaultScheduleLease].
+	Lease time.Duration
+}
+
+func (c ScheduleConfiguration) Validate() (err error) {
+	if c.Store == nil {
+		err = errors.Join(err, errors.New("missing schedule store"))
+	}
+	if c.PollInterval <= 0 {
+		err = errors.Join(err, errors.New("poll interval must be positive"))
+	}
+	if c.Lease < c.PollInterval {
+		err = errors.Join(err, errors.New("lease is shorter than poll interval"))
+	}
+	return err
+}
+
+// Schedule publishes a [Broadcast] at a given time.
+// The message is validated now and again at publication.
+func (c *Chat) Schedule(ctx context.Context, b Broadcast, at time.Time) (id string, err error) {
+	if b.RoomName == "" {
+		return "", errors.New("chat room name is required")
+	}
+	if c.closing.Err() != nil {
+		return "", ErrChatClosed
+	}
+	if b, err = c.validator.ValidateMessage(ctx, b); err != nil {
+		return "", err
+	}
+	id = watermill.NewUUID()
+	if err = c.schedule.AddScheduled(ctx, ScheduledBroadcast{
+		ID:        id,
+		Broadcast: b,
+		At:        at.Unix(),
+	}); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// CancelScheduled removes a broadcast from the schedule.
+func (c *Chat) CancelScheduled(ctx context.Context, id string) error {
+	return c.schedule.RemoveScheduled(ctx, id)
+}
+
+// ListScheduled returns broadcasts that are waiting to be published to a room.
+func (c *Chat) ListScheduled(ctx context.Context, roomName string) ([]ScheduledBroadcast, error) {
+	return c.schedule.ListScheduled(ctx, roomName)
+}
+
+// runSchedule publishes due broadcasts until the context is done.
+func (c *Chat) runSchedule(ctx context.Context, poll, lease time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.clock.After(poll):
+			c.publishScheduled(ctx, lease)
+		}
+	}
+}
+
+// publishScheduled publishes due broadcasts. A broadcast is removed
+// from the schedule once published or when it can never be published.
+// Otherwise, it is claimed again after the lease runs out.
+func (c *Chat) publishScheduled(ctx context.Context, lease time.Duration) {
+	due, err := c.schedule.ClaimScheduled(ctx, c.clock.Now(), lease)
+	if err != nil {
+		c.logger.Error("unable to claim scheduled broadcasts", slog.Any("error", err))
+		return
+	}
+	for _, s := range due {
+		s.Broadcast.ID = s.ID
+		s.CreatedAt = c.clock.Now().Unix() // appears posted when published
+		if _, err = c.sendBroadcast(ctx, s.Broadcast); err != nil {
+			if !isPermanentScheduleError(err) {
+				c.logger.Warn("scheduled broadcast will be published again after the lease runs out",
+					slog.String("id", s.ID),
+					slog.String("roomName", s.RoomName),
+					slog.Any("error", err))
+				continue
+			}
+			c.logger.Error("dropping scheduled broadcast that cannot be published",
+				slog.String("id", s.ID),
+				slog.String("roomName", s.RoomName),
+				slog.Any("error", err))
+		}
+		if err = c.schedule.RemoveScheduled(ctx, s.ID); err != nil && !errors.Is(err, ErrScheduledBroadcastNotFound) {
+			c.logger.Error("unable to remove published scheduled broadcast",
+				slog.String("id", s.ID),
+				slog.Any("error", err))
+		}
+	}
+}
+
+// isPermanentScheduleError is true for errors that would
+// repeat if a scheduled broadcast was published again.
+func isPermanentScheduleError(err error) bool {
+	var (
+		invalid    *InvalidContentError
+		tooLarge   *ContentTooLargeError
+		moderation *ModerationError
+	)
+	return errors.Is(err, ErrEmptyMessage) ||
+		errors.Is(err, ErrUnknownCommand) ||
+		errors.Is(err, ErrCommandNotPermitted) ||
+		errors.Is(err, ErrKicked) ||
+		errors.As(err, &invalid) ||
+		errors.As(err, &tooLarge) ||
+		errors.As(err, &moderation)
+}
+
+type MemoryScheduleStore struct {
+	scheduled map[string]ScheduledBroadcast
+	// claimedUntil holds lease expiration in Unix seconds.
+	claimedUntil map[string]int64
+	mu           sync.Mutex
+}
+
+func NewMemoryScheduleStore() *MemoryScheduleStore {
+	return &MemoryScheduleStore{
+		scheduled:    make(map[string]ScheduledBroadcast),
+		claimedUntil: make(map[string]int64),
+	}
+}
+
+func (s *MemoryScheduleStore) AddScheduled(ctx context.Context, b ScheduledBroadcast) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scheduled[b.ID] = b
+	return nil
+}
+
+func (s *MemoryScheduleStore) ClaimScheduled(ctx context.Context, now time.Time, lease time.Duration) (due []ScheduledBroadcast, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := now.Unix()
+	for id, b := range s.scheduled {
+		if b.At <= t && s.claimedUntil[id] <= t {
+			s.claimedUntil[id] = now.Add(lease).Unix()
+			due = append(due, b)
+		}
+	}
+	slices.SortFunc(due, CompareScheduled)
+	return due, nil
+}
+
+func (s *MemoryScheduleStore) RemoveScheduled(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.scheduled[id]; !ok {
+		return ErrScheduledBroadcastNotFound
+	}
+	delete(s.scheduled, id)
+	delete(s.claimedUntil, id)
+	return nil
+}
+
+func (s *MemoryScheduleStore) ListScheduled(ctx context.Context, roomName string) (list []ScheduledBroadcast, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.scheduled {
+		if b.RoomName == roomName {
+			list = append(list, b)
+		}
+	}
+	slices.SortFunc(list, CompareScheduled)
+	return list, nil
+}
+
+// CompareScheduled orders broadcasts by their time and then by
+// identifier for [ScheduleStore] implementations to sort with.
+func CompareScheduled(a, b ScheduledBroadcast) int {
+	if order := cmp.Compare(a.At, b.At); order != 0 {
+		return order
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
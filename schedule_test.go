@@ -0,0 +1,174 @@
+package watermillchat_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dkotik/watermillchat"
+)
+
+func TestSchedule(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	clock := watermillchat.NewFakeClock(time.Unix(1_700_000_000, 0))
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		Watermill: synchronousWatermill(),
+		Clock:     clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := chat.Subscribe(ctx, "testRoom")
+	// clean up ticker, room subscription ticker, and schedule poll
+	const waiters = 3
+
+	announcement, err := chat.Schedule(ctx, watermillchat.Broadcast{
+		RoomName: "testRoom",
+		Message:  watermillchat.Message{Content: "announcement"},
+	}, clock.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	canceled, err := chat.Schedule(ctx, watermillchat.Broadcast{
+		RoomName: "testRoom",
+		Message:  watermillchat.Message{Content: "canceled"},
+	}, clock.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = chat.CancelScheduled(ctx, canceled); err != nil {
+		t.Fatal(err)
+	}
+	if err = chat.CancelScheduled(ctx, canceled); !errors.Is(err, watermillchat.ErrScheduledBroadcastNotFound) {
+		t.Fatal("canceled broadcast was canceled again:", err)
+	}
+
+	clock.BlockUntil(ctx, waiters)
+	clock.Advance(time.Minute * 30)
+	clock.BlockUntil(ctx, waiters)
+	pending, err := chat.ListScheduled(ctx, "testRoom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].ID != announcement {
+		t.Fatal("unexpected schedule:", pending)
+	}
+
+	clock.Advance(time.Minute * 30)
+	clock.BlockUntil(ctx, waiters)
+	if pending, err = chat.ListScheduled(ctx, "testRoom"); err != nil || len(pending) != 0 {
+		t.Fatal("published broadcast remains scheduled:", pending, err)
+	}
+
+	clock.Advance(time.Millisecond * 300) // flush subscription batch
+	select {
+	case <-ctx.Done():
+		t.Fatal("scheduled broadcast was not published")
+	case batch := <-messages:
+		if len(batch) != 1 || batch[0].Content != "announcement" {
+			t.Fatal("unexpected messages:", batch)
+		}
+		if batch[0].CreatedAt != clock.Now().Unix() {
+			t.Fatal("scheduled message was not created at publication time:", batch[0].CreatedAt)
+		}
+	}
+}
+
+func TestMemoryScheduleStoreLease(t *testing.T) {
+	ctx := context.Background()
+	store := watermillchat.NewMemoryScheduleStore()
+	now := time.Unix(1_700_000_000, 0)
+	if err := store.AddScheduled(ctx, watermillchat.ScheduledBroadcast{
+		ID: "one",
+		At: now.Unix(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := store.ClaimScheduled(ctx, now, time.Minute); len(due) != 1 {
+		t.Fatal("due broadcast was not claimed:", due)
+	}
+	if due, _ := store.ClaimScheduled(ctx, now.Add(time.Second), time.Minute); len(due) != 0 {
+		t.Fatal("leased broadcast was claimed twice:", due)
+	}
+	if due, _ := store.ClaimScheduled(ctx, now.Add(time.Minute), time.Minute); len(due) != 1 {
+		t.Fatal("broadcast with expired lease was not claimed again:", due)
+	}
+}
+
+func TestScheduleRetry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	clock := watermillchat.NewFakeClock(time.Unix(1_700_000_000, 0))
+	failed := false
+	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		Watermill: synchronousWatermill(),
+		Clock:     clock,
+		Moderation: watermillchat.ModerationConfiguration{
+			Filters: []watermillchat.MessageFilter{
+				watermillchat.MessageFilterFunc(func(ctx context.Context, b watermillchat.Broadcast) (watermillchat.Broadcast, watermillchat.Decision, error) {
+					switch b.Content {
+					case "rejected":
+						return b, watermillchat.DecisionReject, nil
+					case "interrupted":
+						if !failed {
+							failed = true
+							return b, watermillchat.DecisionAllow, errors.New("moderation service is unavailable")
+						}
+					}
+					return b, watermillchat.DecisionAllow, nil
+				}),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := chat.Subscribe(ctx, "testRoom")
+	// clean up ticker, room subscription ticker, and schedule poll
+	const waiters = 3
+
+	schedule := func(content string) string {
+		t.Helper()
+		id, err := chat.Schedule(ctx, watermillchat.Broadcast{
+			RoomName: "testRoom",
+			Message:  watermillchat.Message{Content: content},
+		}, clock.Now().Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	schedule("rejected")
+	interrupted := schedule("interrupted")
+
+	clock.BlockUntil(ctx, waiters)
+	clock.Advance(time.Second)
+	clock.BlockUntil(ctx, waiters)
+	pending, err := chat.ListScheduled(ctx, "testRoom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].ID != interrupted {
+		t.Fatal("rejected broadcast remains scheduled or interrupted one was removed:", pending)
+	}
+
+	clock.Advance(watermillchat.DefaultScheduleLease)
+	clock.BlockUntil(ctx, waiters)
+	if pending, err = chat.ListScheduled(ctx, "testRoom"); err != nil || len(pending) != 0 {
+		t.Fatal("broadcast was not published after the lease ran out:", pending, err)
+	}
+
+	clock.Advance(time.Millisecond * 300) // flush subscription batch
+	select {
+	case <-ctx.Done():
+		t.Fatal("scheduled broadcast was not published")
+	case batch := <-messages:
+		if len(batch) != 1 || batch[0].ID != interrupted {
+			t.Fatal("scheduled broadcast was not published with its ID:", batch)
+		}
+	}
+}
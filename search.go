@@ -0,0 +1,40 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrSearchUnsupported is returned by [Chat.Search] when
+// the [HistoryRepository] does not implement [SearchableHistory].
+var ErrSearchUnsupported = errors.New("history repository does not support search")
+
+// ErrInvalidSearchCursor is returned by [SearchableHistory]
+// when the cursor was not issued by a previous search.
+var ErrInvalidSearchCursor = errors.New("invalid search cursor")
+
+// SearchableHistory is a [HistoryRepository] that can find
+// messages by their content.
+type SearchableHistory interface {
+	// Search returns messages matching the query, newest first.
+	// Empty room filter matches every room. Cursor is
+	// empty for the first page. Returned cursor is empty
+	// when there are no more results. Malformed cursors
+	// are rejected with [ErrInvalidSearchCursor].
+	Search(ctx context.Context, query, roomFilter, cursor string) (results []Broadcast, nextCursor string, err error)
+}
+
+// Search finds messages in [HistoryRepository]
+// if it implements [SearchableHistory].
+func (c *Chat) Search(ctx context.Context, query, roomFilter, cursor string) ([]Broadcast, string, error) {
+	searchable, ok := c.history.(SearchableHistory)
+	if !ok {
+		return nil, "", ErrSearchUnsupported
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, "", nil
+	}
+	return searchable.Search(ctx, query, strings.TrimSpace(roomFilter), cursor)
+}
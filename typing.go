@@ -0,0 +1,174 @@
+package watermillchat
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// TypingTimeout is how long a typing indicator lasts
+// unless it is refreshed by another [Chat.Typing] call.
+const TypingTimeout = time.Second * 8
+
+// TypingEvent starts or stops the typing indicator of an
+// identity in a room. It is an [EventKindTyping] event,
+// which history does not store.
+type TypingEvent struct {
+	RoomName string
+	Identity Identity
+	Typing   bool
+}
+
+type typist struct {
+	Identity
+	until time.Time
+}
+
+// Typing shows or hides the typing indicator of the [Identity]
+// in context. Indicators disappear after [TypingTimeout] or
+// when the identity sends a message.
+func (c *Chat) Typing(ctx context.Context, roomName string, typing bool) error {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return ErrIdentityRequired
+	}
+	if c.closing.Err() != nil {
+		return ErrChatClosed
+	}
+	return c.publishEvent(ctx, EventKindTyping, TypingEvent{
+		RoomName: roomName,
+		Identity: identity,
+		Typing:   typing,
+	})
+}
+
+// SubscribeTyping delivers identities typing in a room right
+// away and again after every change until the context is done.
+func (c *Chat) SubscribeTyping(ctx context.Context, roomName string) <-chan []Identity {
+	return c.subscribedRoom(roomName).SubscribeTyping(c.untilClosed(ctx))
+}
+
+// receiveTyping updates only rooms that are
+// already open on this node.
+func (c *Chat) receiveTyping(event TypingEvent) {
+	c.mu.Lock()
+	room := c.rooms[event.RoomName]
+	c.mu.Unlock()
+	if room == nil {
+		return
+	}
+	room.setTyping(event.Identity, event.Typing)
+}
+
+// SubscribeTyping delivers typing identities on every change.
+// Slow subscribers skip intermediate versions.
+func (r *Room) SubscribeTyping(ctx context.Context) <-chan []Identity {
+	typing := make(chan []Identity, 1)
+	r.mu.Lock()
+	typing <- r.typingIdentities()
+	r.typingSubscribers = append(r.typingSubscribers, typing)
+	clock := r.clock
+	r.mu.Unlock()
+	if clock == nil {
+		clock = SystemClock{}
+	}
+
+	go func() {
+		defer func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.typingSubscribers = slices.DeleteFunc(r.typingSubscribers, func(existing chan []Identity) bool {
+				return existing == typing
+			})
+			close(typing)
+		}()
+		tick := clock.NewTicker(time.Second)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-tick.C():
+				r.expireTyping(now)
+			}
+		}
+	}()
+	return typing
+}
+
+func (r *Room) setTyping(identity Identity, typing bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.typing, func(t typist) bool {
+		return t.ID == identity.ID
+	})
+	switch {
+	case typing && i >= 0:
+		r.typing[i].until = r.now().Add(TypingTimeout)
+		if r.typing[i].Identity == identity {
+			return // refreshed
+		}
+		r.typing[i].Identity = identity
+	case typing:
+		r.typing = append(r.typing, typist{
+			Identity: identity,
+			until:    r.now().Add(TypingTimeout),
+		})
+	case i >= 0:
+		r.typing = slices.Delete(r.typing, i, i+1)
+	default:
+		return
+	}
+	r.deliverTyping()
+}
+
+// stopTyping must be called while holding the lock.
+func (r *Room) stopTyping(identityID string) {
+	total := len(r.typing)
+	r.typing = slices.DeleteFunc(r.typing, func(t typist) bool {
+		return t.ID == identityID
+	})
+	if len(r.typing) != total {
+		r.deliverTyping()
+	}
+}
+
+func (r *Room) expireTyping(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := len(r.typing)
+	r.typing = slices.DeleteFunc(r.typing, func(t typist) bool {
+		return !now.Before(t.until)
+	})
+	if len(r.typing) != total {
+		r.deliverTyping()
+	}
+}
+
+// now must be called while holding the lock.
+func (r *Room) now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+	return r.clock.Now()
+}
+
+// typingIdentities must be called while holding the lock.
+func (r *Room) typingIdentities() []Identity {
+	identities := make([]Identity, len(r.typing))
+	for i, t := range r.typing {
+		identities[i] = t.Identity
+	}
+	return identities
+}
+
+// deliverTyping must be called while holding the lock.
+func (r *Room) deliverTyping() {
+	for _, subscriber := range r.typingSubscribers {
+		select {
+		case <-subscriber: // replace the version not yet received
+		default:
+		}
+		subscriber <- r.typingIdentities()
+	}
+}
@@ -0,0 +1,333 @@
+/*
+Package unfurl implements [watermillchat.LinkPreviewer] by
+reading OpenGraph and Twitter card meta tags of linked pages.
+*/
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dkotik/watermillchat"
+	"golang.org/x/net/html"
+)
+
+const (
+	DefaultTimeout   = time.Second * 5
+	DefaultMostBytes = 1 << 19
+	DefaultCacheSize = 1024
+	DefaultCacheTTL  = time.Hour
+	DefaultUserAgent = "watermillchat-unfurl/1.0"
+
+	mostRedirects          = 3
+	mostTitleRunes         = 200
+	mostDescriptionRunes   = 300
+	failureCacheTTLCeiling = time.Minute
+)
+
+var (
+	ErrNoPreview         = errors.New("page does not contain preview meta tags")
+	ErrPrivateNetwork    = errors.New("link points to a private network address")
+	ErrUnsupportedScheme = errors.New("only http and https links can be previewed")
+)
+
+type Configuration struct {
+	// Timeout limits each page request including redirects.
+	// Defaults to [DefaultTimeout].
+	Timeout time.Duration
+
+	// MostBytes limits how much of the page is read
+	// looking for meta tags. Defaults to [DefaultMostBytes].
+	MostBytes int64
+
+	// CacheSize is the number of links to remember.
+	// Defaults to [DefaultCacheSize].
+	CacheSize int
+
+	// CacheTTL is how long a preview is remembered.
+	// Failures are remembered for at most a minute.
+	// Defaults to [DefaultCacheTTL].
+	CacheTTL time.Duration
+
+	// UserAgent identifies requests. Defaults to [DefaultUserAgent].
+	UserAgent string
+
+	// AllowPrivateNetworks permits requests to loopback and private
+	// addresses. It should only be enabled for tests, because
+	// otherwise people can use previews to probe internal services.
+	AllowPrivateNetworks bool
+}
+
+func (c Configuration) Validate() (err error) {
+	if c.Timeout < time.Millisecond {
+		err = errors.Join(err, errors.New("timeout is lower than one millisecond"))
+	}
+	if c.MostBytes < 1 {
+		err = errors.Join(err, errors.New("most bytes is lower than one"))
+	}
+	if c.CacheSize < 1 {
+		err = errors.Join(err, errors.New("cache size is lower than one"))
+	}
+	if c.CacheTTL < time.Second {
+		err = errors.Join(err, errors.New("cache time to live is lower than one second"))
+	}
+	if strings.TrimSpace(c.UserAgent) == "" {
+		err = errors.Join(err, errors.New("missing user agent"))
+	}
+	return err
+}
+
+// Unfurler fetches and caches link previews.
+type Unfurler struct {
+	client    *http.Client
+	mostBytes int64
+	cacheSize int
+	cacheTTL  time.Duration
+	userAgent string
+
+	cache map[string]cached
+	mu    sync.Mutex
+}
+
+type cached struct {
+	preview watermillchat.LinkPreview
+	err     error
+	expires time.Time
+}
+
+func New(c Configuration) (*Unfurler, error) {
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.MostBytes == 0 {
+		c.MostBytes = DefaultMostBytes
+	}
+	if c.CacheSize == 0 {
+		c.CacheSize = DefaultCacheSize
+	}
+	if c.CacheTTL == 0 {
+		c.CacheTTL = DefaultCacheTTL
+	}
+	if c.UserAgent == "" {
+		c.UserAgent = DefaultUserAgent
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("unable to initialize link unfurler: %w", err)
+	}
+
+	dialer := &net.Dialer{Timeout: c.Timeout}
+	if !c.AllowPrivateNetworks {
+		dialer.Control = rejectPrivateNetworks
+	}
+	return &Unfurler{
+		client: &http.Client{
+			Timeout: c.Timeout,
+			Transport: &http.Transport{
+				DialContext:           dialer.DialContext,
+				TLSHandshakeTimeout:   c.Timeout,
+				ResponseHeaderTimeout: c.Timeout,
+				MaxIdleConns:          16,
+				IdleConnTimeout:       time.Minute,
+			},
+			CheckRedirect: func(r *http.Request, via []*http.Request) error {
+				if len(via) >= mostRedirects {
+					return errors.New("too many redirects")
+				}
+				if r.URL.Scheme != "http" && r.URL.Scheme != "https" {
+					return ErrUnsupportedScheme
+				}
+				return nil
+			},
+		},
+		mostBytes: c.MostBytes,
+		cacheSize: c.CacheSize,
+		cacheTTL:  c.CacheTTL,
+		userAgent: c.UserAgent,
+		cache:     make(map[string]cached),
+	}, nil
+}
+
+// rejectPrivateNetworks runs after name resolution, so it
+// also catches public names that resolve to private addresses.
+func rejectPrivateNetworks(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return ErrPrivateNetwork
+	}
+	return nil
+}
+
+// PreviewLink returns a cached preview or fetches the page.
+func (u *Unfurler) PreviewLink(ctx context.Context, link string) (watermillchat.LinkPreview, error) {
+	now := time.Now()
+	u.mu.Lock()
+	entry, ok := u.cache[link]
+	u.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.preview, entry.err
+	}
+
+	preview, err := u.fetch(ctx, link)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return preview, err // caller gave up, try again next time
+	}
+	entry = cached{preview: preview, err: err, expires: now.Add(u.cacheTTL)}
+	if err != nil {
+		entry.expires = now.Add(min(u.cacheTTL, failureCacheTTLCeiling))
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.cache) >= u.cacheSize {
+		u.evict(now)
+	}
+	u.cache[link] = entry
+	return preview, err
+}
+
+// evict removes expired entries or, if there are none,
+// the entry closest to expiration.
+func (u *Unfurler) evict(now time.Time) {
+	var oldest string
+	for link, entry := range u.cache {
+		if now.After(entry.expires) {
+			delete(u.cache, link)
+			continue
+		}
+		if oldest == "" || entry.expires.Before(u.cache[oldest].expires) {
+			oldest = link
+		}
+	}
+	if len(u.cache) >= u.cacheSize {
+		delete(u.cache, oldest)
+	}
+}
+
+func (u *Unfurler) fetch(ctx context.Context, link string) (preview watermillchat.LinkPreview, err error) {
+	target, err := url.Parse(link)
+	if err != nil {
+		return preview, err
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return preview, ErrUnsupportedScheme
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return preview, err
+	}
+	request.Header.Set("User-Agent", u.userAgent)
+	request.Header.Set("Accept", "text/html")
+
+	response, err := u.client.Do(request)
+	if err != nil {
+		return preview, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return preview, fmt.Errorf("page responded with status code %d", response.StatusCode)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type")); mediaType != "text/html" {
+		return preview, fmt.Errorf("page content type is not supported: %q", mediaType)
+	}
+
+	preview, err = Parse(io.LimitReader(response.Body, u.mostBytes), response.Request.URL)
+	if err != nil {
+		return preview, err
+	}
+	preview.URL = link
+	return preview, nil
+}
+
+// Parse reads OpenGraph and Twitter card meta tags from the
+// head of an HTML document. The document title and description
+// are used as fallbacks. Image link is resolved against the base.
+func Parse(r io.Reader, base *url.URL) (preview watermillchat.LinkPreview, err error) {
+	meta := make(map[string]string)
+	title := ""
+	tokenizer := html.NewTokenizer(r)
+
+parsing:
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err = tokenizer.Err(); !errors.Is(err, io.EOF) {
+				return preview, err
+			}
+			break parsing
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "body":
+				break parsing
+			case "title":
+				if tokenizer.Next() == html.TextToken {
+					title = string(tokenizer.Text())
+				}
+			case "meta":
+				key, content := "", ""
+				for _, attribute := range token.Attr {
+					switch attribute.Key {
+					case "property", "name":
+						key = strings.ToLower(strings.TrimSpace(attribute.Val))
+					case "content":
+						content = attribute.Val
+					}
+				}
+				if _, exists := meta[key]; key != "" && !exists {
+					meta[key] = content
+				}
+			}
+		case html.EndTagToken:
+			if tokenizer.Token().Data == "head" {
+				break parsing
+			}
+		}
+	}
+
+	preview.SiteName = clean(meta["og:site_name"], mostTitleRunes)
+	preview.Title = clean(first(meta["og:title"], meta["twitter:title"], title), mostTitleRunes)
+	preview.Description = clean(first(meta["og:description"], meta["twitter:description"], meta["description"]), mostDescriptionRunes)
+	if image := first(meta["og:image:secure_url"], meta["og:image"], meta["twitter:image"], meta["twitter:image:src"]); image != "" {
+		if resolved, err := base.Parse(strings.TrimSpace(image)); err == nil && (resolved.Scheme == "http" || resolved.Scheme == "https") {
+			preview.Image = resolved.String()
+		}
+	}
+	if preview.Title == "" && preview.Description == "" {
+		return preview, ErrNoPreview
+	}
+	return preview, nil
+}
+
+func first(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// clean collapses white space and shortens text to a number of runes.
+func clean(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) > limit {
+		text = strings.TrimSpace(string([]rune(text)[:limit])) + "…"
+	}
+	return text
+}
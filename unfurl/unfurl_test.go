@@ -0,0 +1,111 @@
+package unfurl_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dkotik/watermillchat/unfurl"
+)
+
+func newTestSite(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	requests := &atomic.Int32{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<!DOCTYPE html><html><head>
+<title>Fallback Title</title>
+<meta property="og:site_name" content="Test Site">
+<meta property="og:title" content="  Article
+  Title ">
+<meta name="twitter:description" content="Short description.">
+<meta property="og:image" content="/images/cover.png">
+</head><body><meta property="og:title" content="Ignored"></body></html>`))
+	})
+	mux.HandleFunc("/bare", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><head><meta property="og:image" content="javascript:alert(1)"></head></html>`))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><head>" + strings.Repeat("<!-- padding -->", 1024) + `<title>Too Far</title></head></html>`))
+	})
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write([]byte(`<title>Not a page</title>`))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/article", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestUnfurler(t *testing.T) {
+	site, requests := newTestSite(t)
+	u, err := unfurl.New(unfurl.Configuration{
+		MostBytes:            4096,
+		AllowPrivateNetworks: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	preview, err := u.PreviewLink(ctx, site.URL+"/redirect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.URL != site.URL+"/redirect" ||
+		preview.SiteName != "Test Site" ||
+		preview.Title != "Article Title" ||
+		preview.Description != "Short description." ||
+		preview.Image != site.URL+"/images/cover.png" {
+		t.Fatalf("unexpected preview: %+v", preview)
+	}
+
+	if _, err = u.PreviewLink(ctx, site.URL+"/redirect"); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 1 {
+		t.Fatal("preview was not cached:", requests.Load())
+	}
+
+	if _, err = u.PreviewLink(ctx, site.URL+"/bare"); !errors.Is(err, unfurl.ErrNoPreview) {
+		t.Fatal("page without meta tags produced a preview:", err)
+	}
+	if _, err = u.PreviewLink(ctx, site.URL+"/bare"); !errors.Is(err, unfurl.ErrNoPreview) || requests.Load() != 2 {
+		t.Fatal("failure was not cached:", err, requests.Load())
+	}
+	if _, err = u.PreviewLink(ctx, site.URL+"/large"); !errors.Is(err, unfurl.ErrNoPreview) {
+		t.Fatal("page was read beyond the size limit:", err)
+	}
+	if _, err = u.PreviewLink(ctx, site.URL+"/file"); err == nil {
+		t.Fatal("non-HTML content produced a preview")
+	}
+	if _, err = u.PreviewLink(ctx, "ftp://example.com/file"); !errors.Is(err, unfurl.ErrUnsupportedScheme) {
+		t.Fatal("unsupported scheme was fetched:", err)
+	}
+}
+
+func TestUnfurlerRejectsPrivateNetworks(t *testing.T) {
+	site, requests := newTestSite(t)
+	u, err := unfurl.New(unfurl.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = u.PreviewLink(context.Background(), site.URL+"/article"); !errors.Is(err, unfurl.ErrPrivateNetwork) {
+		t.Fatal("loopback address was not rejected:", err)
+	}
+	if requests.Load() != 0 {
+		t.Fatal("request reached private network")
+	}
+}
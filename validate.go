@@ -0,0 +1,226 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	DefaultMostRunesPerMessage = 4000
+	DefaultMostLinesPerMessage = 64
+)
+
+// ErrEmptyMessage is returned by [Chat.Broadcast] when
+// nothing is left of message content after validation.
+var ErrEmptyMessage = &InvalidContentError{Reason: "unable to send an empty message"}
+
+type ValidationConfiguration struct {
+	// MostRunesPerMessage constraints message content length.
+	// Defaults to [DefaultMostRunesPerMessage].
+	MostRunesPerMessage int
+
+	// MostLinesPerMessage constraints the number of lines
+	// in message content. Defaults to [DefaultMostLinesPerMessage].
+	MostLinesPerMessage int
+
+	// MostAttachmentsPerMessage constraints the number of files
+	// attached to a message. Defaults to [DefaultMostAttachmentsPerMessage].
+	MostAttachmentsPerMessage int
+
+	// Normalization is the Unicode normal form applied to message content.
+	// Zero value is [norm.NFC].
+	Normalization norm.Form
+
+	// KeepControlCharacters disables stripping of control and
+	// bidirectional override characters from message content.
+	KeepControlCharacters bool
+
+	// Validators run in order after the built-in validators.
+	Validators []MessageValidator
+}
+
+func (c ValidationConfiguration) Validate() (err error) {
+	if c.MostRunesPerMessage < 1 {
+		err = errors.Join(err, errors.New("most runes per message is lower than one"))
+	}
+	if c.MostLinesPerMessage < 1 {
+		err = errors.Join(err, errors.New("most lines per message is lower than one"))
+	}
+	if c.MostAttachmentsPerMessage < 1 {
+		err = errors.Join(err, errors.New("most attachments per message is lower than one"))
+	}
+	for i, validator := range c.Validators {
+		if validator == nil {
+			err = errors.Join(err, fmt.Errorf("message validator #%d is <nil>", i+1))
+		}
+	}
+	return err
+}
+
+// MessageValidator checks and optionally corrects a [Broadcast]
+// before it is published. Returned errors should be either
+// [ContentTooLargeError] or [InvalidContentError].
+type MessageValidator interface {
+	ValidateMessage(context.Context, Broadcast) (Broadcast, error)
+}
+
+type MessageValidatorFunc func(context.Context, Broadcast) (Broadcast, error)
+
+func (f MessageValidatorFunc) ValidateMessage(ctx context.Context, b Broadcast) (Broadcast, error) {
+	return f(ctx, b)
+}
+
+// ContentTooLargeError reports message content exceeding a size limit.
+type ContentTooLargeError struct {
+	// Unit is "runes", "lines", or "attachments".
+	Unit   string
+	Limit  int
+	Actual int
+}
+
+func (e *ContentTooLargeError) Error() string {
+	return fmt.Sprintf("message content is too large: %d %s exceed limit of %d", e.Actual, e.Unit, e.Limit)
+}
+
+func (e *ContentTooLargeError) HyperTextStatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+// InvalidContentError reports message content that cannot be sent.
+type InvalidContentError struct {
+	Reason string
+}
+
+func (e *InvalidContentError) Error() string {
+	return e.Reason
+}
+
+func (e *InvalidContentError) HyperTextStatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// NewMessageValidatorChain runs validators in order passing
+// corrected [Broadcast] from one to the next. Stops at the first error.
+func NewMessageValidatorChain(validators ...MessageValidator) MessageValidator {
+	for _, validator := range validators {
+		if validator == nil {
+			panic("cannot use a <nil> message validator")
+		}
+	}
+	return MessageValidatorFunc(
+		func(ctx context.Context, b Broadcast) (_ Broadcast, err error) {
+			for _, validator := range validators {
+				if b, err = validator.ValidateMessage(ctx, b); err != nil {
+					return b, err
+				}
+			}
+			return b, nil
+		},
+	)
+}
+
+// ControlCharacterStripper removes control characters except for
+// new lines and tabs. It also removes bidirectional text overrides
+// that can be used to disguise content.
+var ControlCharacterStripper = MessageValidatorFunc(
+	func(ctx context.Context, b Broadcast) (Broadcast, error) {
+		b.Content = stripControlCharacters(b.Content)
+		return b, nil
+	},
+)
+
+func stripControlCharacters(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case unicode.IsControl(r):
+			return -1
+		case unicode.Is(unicode.Bidi_Control, r):
+			return -1
+		}
+		return r
+	}, strings.ReplaceAll(text, "\r\n", "\n"))
+}
+
+// EmptyContentTrimmer removes leading and trailing
+// white space and rejects empty content without attachments.
+var EmptyContentTrimmer = MessageValidatorFunc(
+	func(ctx context.Context, b Broadcast) (Broadcast, error) {
+		b.Content = strings.TrimSpace(b.Content)
+		if b.Content == "" && len(b.Attachments) == 0 {
+			return b, ErrEmptyMessage
+		}
+		return b, nil
+	},
+)
+
+// NewUnicodeNormalizer transforms content into the
+// given normal form, so that visually identical
+// messages are also identical byte by byte.
+func NewUnicodeNormalizer(form norm.Form) MessageValidator {
+	return MessageValidatorFunc(
+		func(ctx context.Context, b Broadcast) (Broadcast, error) {
+			b.Content = form.String(b.Content)
+			return b, nil
+		},
+	)
+}
+
+func NewMostRunesValidator(limit int) MessageValidator {
+	if limit < 1 {
+		panic("rune limit cannot be lower than one")
+	}
+	return MessageValidatorFunc(
+		func(ctx context.Context, b Broadcast) (Broadcast, error) {
+			if count := utf8.RuneCountInString(b.Content); count > limit {
+				return b, &ContentTooLargeError{
+					Unit:   "runes",
+					Limit:  limit,
+					Actual: count,
+				}
+			}
+			return b, nil
+		},
+	)
+}
+
+func NewMostLinesValidator(limit int) MessageValidator {
+	if limit < 1 {
+		panic("line limit cannot be lower than one")
+	}
+	return MessageValidatorFunc(
+		func(ctx context.Context, b Broadcast) (Broadcast, error) {
+			if count := strings.Count(b.Content, "\n") + 1; count > limit {
+				return b, &ContentTooLargeError{
+					Unit:   "lines",
+					Limit:  limit,
+					Actual: count,
+				}
+			}
+			return b, nil
+		},
+	)
+}
+
+func newMessageValidator(c ValidationConfiguration) MessageValidator {
+	validators := make([]MessageValidator, 0, len(c.Validators)+6)
+	if !c.KeepControlCharacters {
+		validators = append(validators, ControlCharacterStripper)
+	}
+	validators = append(validators,
+		NewUnicodeNormalizer(c.Normalization),
+		EmptyContentTrimmer,
+		NewMostRunesValidator(c.MostRunesPerMessage),
+		NewMostLinesValidator(c.MostLinesPerMessage),
+		NewMostAttachmentsValidator(c.MostAttachmentsPerMessage),
+	)
+	return NewMessageValidatorChain(append(validators, c.Validators...)...)
+}
@@ -0,0 +1,56 @@
+package watermillchat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMessageValidation(t *testing.T) {
+	validator := newMessageValidator(ValidationConfiguration{
+		MostRunesPerMessage:       10,
+		MostLinesPerMessage:       2,
+		MostAttachmentsPerMessage: 1,
+	})
+	ctx := context.Background()
+
+	cases := []struct {
+		Content     string
+		Attachments []Attachment
+		Expected    string
+		Error       error
+	}{
+		{Content: "  ok  ", Expected: "ok"},
+		{Content: "a\x00b\u202ec\r\nd", Expected: "abc\nd"},
+		{Content: "cafe\u0301", Expected: "caf\u00e9"},
+		{Content: " \x07 ", Error: ErrEmptyMessage},
+		{Content: strings.Repeat("ы", 11), Error: &ContentTooLargeError{}},
+		{Content: "1\n2\n3", Error: &ContentTooLargeError{}},
+		{Content: " ", Attachments: []Attachment{{ID: "a"}}, Expected: ""},
+		{Content: "two", Attachments: []Attachment{{ID: "a"}, {ID: "b"}}, Error: &ContentTooLargeError{}},
+	}
+
+	for _, c := range cases {
+		b, err := validator.ValidateMessage(ctx, Broadcast{
+			Message: Message{Content: c.Content, Attachments: c.Attachments},
+		})
+		switch expected := c.Error.(type) {
+		case nil:
+			if err != nil {
+				t.Fatalf("content %q failed validation: %v", c.Content, err)
+			}
+			if b.Content != c.Expected {
+				t.Fatalf("content %q was corrected to %q instead of %q", c.Content, b.Content, c.Expected)
+			}
+		case *ContentTooLargeError:
+			if !errors.As(err, &expected) {
+				t.Fatalf("content %q did not exceed limits: %v", c.Content, err)
+			}
+		default:
+			if !errors.Is(err, expected) {
+				t.Fatalf("content %q produced unexpected error: %v", c.Content, err)
+			}
+		}
+	}
+}
@@ -28,6 +28,11 @@ const (
 	DefaultCleanupFrequency           = DefaultHistoryCleanupFrequency // TODO: deprecate
 )
 
+var (
+	DefaultRateLimitPerIdentity = RateLimit{Interval: time.Millisecond * 500, Burst: 10}
+	DefaultRateLimitPerRoom     = RateLimit{Interval: time.Millisecond * 50, Burst: 100}
+)
+
 type WatermillConfiguration struct {
 	// Topic where the messages are published to and read from.
 	// Defaults to [DefaultWatermillTopic].
@@ -56,9 +61,22 @@ type HistoryConfiguration struct {
 }
 
 type Configuration struct {
-	Watermill WatermillConfiguration
-	History   HistoryConfiguration
-	Logger    *slog.Logger
+	Watermill  WatermillConfiguration
+	History    HistoryConfiguration
+	RateLimit  RateLimitConfiguration
+	Validation ValidationConfiguration
+	Moderation ModerationConfiguration
+	Previews   LinkPreviewConfiguration
+	Schedule   ScheduleConfiguration
+	Commands   CommandConfiguration
+
+	// Directory keeps room titles, topics, and descriptions.
+	// Defaults to [MemoryRoomDirectory].
+	Directory RoomDirectory
+
+	// Clock defaults to [SystemClock].
+	Clock  Clock
+	Logger *slog.Logger
 }
 
 func (c Configuration) Validate() (err error) {
@@ -83,6 +101,33 @@ func (c Configuration) Validate() (err error) {
 	if c.History.MostMessagesPerRoom < 1 {
 		err = errors.Join(err, errors.New("retained messages per room is lower than one"))
 	}
+	if rateLimitErr := c.RateLimit.PerIdentity.Validate(); rateLimitErr != nil {
+		err = errors.Join(err, fmt.Errorf("invalid per identity rate limit: %w", rateLimitErr))
+	}
+	if rateLimitErr := c.RateLimit.PerRoom.Validate(); rateLimitErr != nil {
+		err = errors.Join(err, fmt.Errorf("invalid per room rate limit: %w", rateLimitErr))
+	}
+	if validationErr := c.Validation.Validate(); validationErr != nil {
+		err = errors.Join(err, fmt.Errorf("invalid message validation: %w", validationErr))
+	}
+	if moderationErr := c.Moderation.Validate(); moderationErr != nil {
+		err = errors.Join(err, fmt.Errorf("invalid moderation: %w", moderationErr))
+	}
+	if previewErr := c.Previews.Validate(); previewErr != nil {
+		err = errors.Join(err, fmt.Errorf("invalid link previews: %w", previewErr))
+	}
+	if scheduleErr := c.Schedule.Validate(); scheduleErr != nil {
+		err = errors.Join(err, fmt.Errorf("invalid schedule: %w", scheduleErr))
+	}
+	if commandErr := c.Commands.Validate(); commandErr != nil {
+		err = errors.Join(err, fmt.Errorf("invalid commands: %w", commandErr))
+	}
+	if c.Directory == nil {
+		err = errors.Join(err, errors.New("missing room directory"))
+	}
+	if c.Clock == nil {
+		err = errors.Join(err, errors.New("missing clock"))
+	}
 	if c.Logger == nil {
 		err = errors.Join(err, errors.New("missing logger"))
 	}
@@ -95,16 +140,53 @@ type Chat struct {
 	history          HistoryRepository
 	historyDepth     int
 	historyRetention time.Duration
+	validator        MessageValidator
+	identityLimiter  *rateLimiter
+	roomLimiter      *rateLimiter
+	filters          []MessageFilter
+	moderationQueue  ModerationQueue
 	logger           *slog.Logger
 
-	rooms map[string]*Room
-	mu    *sync.Mutex
+	linkPreviewer      LinkPreviewer
+	mostLinkPreviews   int
+	linkPreviewTimeout time.Duration
+	directory          RoomDirectory
+	schedule           ScheduleStore
+	clock              Clock
+
+	// commands are indexed by lower case name.
+	commands          map[string]Command
+	commandPermission CommandPermission
+	commandsMu        sync.RWMutex
+
+	rooms              map[string]*Room
+	mentionSubscribers map[string][]chan Mention
+	// metadataSubscribers are indexed by room name.
+	metadataSubscribers map[string][]chan RoomMetadata
+	mu                  *sync.Mutex
+
+	// running ends when the chat stops, closing
+	// ends as soon as [Chat.Close] is called.
+	running     context.Context
+	stop        context.CancelFunc
+	closing     context.Context
+	markClosing context.CancelFunc
+	closed      bool
+	closeMu     sync.RWMutex
+	tasks       sync.WaitGroup
+
+	// unflushed holds identifiers of published messages
+	// that history did not acknowledge yet.
+	unflushed      map[string]struct{}
+	historyPending sync.WaitGroup
+	historyMu      sync.Mutex
 }
 
 func New(ctx context.Context, c Configuration) (chat *Chat, err error) {
 	if ctx == nil {
 		return nil, errors.New("chat running context is missing")
 	}
+	var ownPubSub *gochannel.GoChannel // closed with the chat
 	if c.Logger == nil {
 		c.Logger = slog.Default()
 	}
@@ -125,12 +207,7 @@ func New(ctx context.Context, c Configuration) (chat *Chat, err error) {
 		)
 		c.Watermill.Publisher = pubSub
 		c.Watermill.Subscriber = pubSub
-		go func(ctx context.Context, logger *slog.Logger) {
-			<-ctx.Done()
-			if err := pubSub.Close(); err != nil {
-				logger.Error("unable to close down default watermill publisher", slog.Any("error", err))
-			}
-		}(ctx, c.Logger)
+		ownPubSub = pubSub
 	}
 
 	if c.History.Repository == nil {
@@ -145,19 +222,62 @@ func New(ctx context.Context, c Configuration) (chat *Chat, err error) {
 	if c.History.CleanUpFrequency == 0 {
 		c.History.CleanUpFrequency = DefaultHistoryCleanupFrequency
 	}
+	if c.Validation.MostRunesPerMessage == 0 {
+		c.Validation.MostRunesPerMessage = DefaultMostRunesPerMessage
+	}
+	if c.Validation.MostLinesPerMessage == 0 {
+		c.Validation.MostLinesPerMessage = DefaultMostLinesPerMessage
+	}
+	if c.Validation.MostAttachmentsPerMessage == 0 {
+		c.Validation.MostAttachmentsPerMessage = DefaultMostAttachmentsPerMessage
+	}
+	if c.Moderation.Queue == nil {
+		c.Moderation.Queue = NewMemoryModerationQueue()
+	}
+	if c.Directory == nil {
+		c.Directory = NewMemoryRoomDirectory()
+	}
+	if c.Schedule.Store == nil {
+		c.Schedule.Store = NewMemoryScheduleStore()
+	}
+	if c.Schedule.PollInterval == 0 {
+		c.Schedule.PollInterval = DefaultSchedulePollInterval
+	}
+	if c.Schedule.Lease == 0 {
+		c.Schedule.Lease = DefaultScheduleLease
+	}
+	if c.Clock == nil {
+		c.Clock = SystemClock{}
+	}
+	if c.Previews.MostPerMessage == 0 {
+		c.Previews.MostPerMessage = DefaultMostLinkPreviewsPerMessage
+	}
+	if c.Previews.Timeout == 0 {
+		c.Previews.Timeout = DefaultLinkPreviewTimeout
+	}
+	if c.RateLimit.PerIdentity == (RateLimit{}) {
+		c.RateLimit.PerIdentity = DefaultRateLimitPerIdentity
+	}
+	if c.RateLimit.PerRoom == (RateLimit{}) {
+		c.RateLimit.PerRoom = DefaultRateLimitPerRoom
+	}
 
 	if err = c.Validate(); err != nil {
 		return nil, fmt.Errorf("unable to initialize Watermill chat: %w", err)
 	}
 
-	incomingBroadcasts, err := c.Watermill.Subscriber.Subscribe(ctx, c.Watermill.Topic)
+	running, stop := context.WithCancel(ctx)
+	incomingBroadcasts, err := c.Watermill.Subscriber.Subscribe(running, c.Watermill.Topic)
 	if err != nil {
+		stop()
 		return nil, fmt.Errorf("unable to connect to a Watermill subscriber: %w", err)
 	}
-	incomingHistoryBroadcasts, err := c.Watermill.Subscriber.Subscribe(ctx, c.Watermill.Topic)
+	incomingHistoryBroadcasts, err := c.Watermill.Subscriber.Subscribe(running, c.Watermill.Topic)
 	if err != nil {
+		stop()
 		return nil, fmt.Errorf("unable to connect to a Watermill subscriber: %w", err)
 	}
+	closing, markClosing := context.WithCancel(running)
 
 	chat = &Chat{
 		publisherTopic:   c.Watermill.Topic,
@@ -165,13 +285,49 @@ func New(ctx context.Context, c Configuration) (chat *Chat, err error) {
 		history:          c.History.Repository,
 		historyDepth:     c.History.MostMessagesPerRoom,
 		historyRetention: c.History.Retention,
+		validator:        newMessageValidator(c.Validation),
+		identityLimiter:  newRateLimiter("identity", c.RateLimit.PerIdentity),
+		roomLimiter:      newRateLimiter("room", c.RateLimit.PerRoom),
+		filters:          c.Moderation.Filters,
+		moderationQueue:  c.Moderation.Queue,
 		logger:           c.Logger,
 
-		rooms: make(map[string]*Room),
-		mu:    &sync.Mutex{},
+		linkPreviewer:      c.Previews.Previewer,
+		mostLinkPreviews:   c.Previews.MostPerMessage,
+		linkPreviewTimeout: c.Previews.Timeout,
+		directory:          c.Directory,
+		schedule:           c.Schedule.Store,
+		clock:              c.Clock,
+
+		commands:          make(map[string]Command),
+		commandPermission: c.Commands.Permit,
+
+		rooms:               make(map[string]*Room),
+		mentionSubscribers:  make(map[string][]chan Mention),
+		metadataSubscribers: make(map[string][]chan RoomMetadata),
+		mu:                  &sync.Mutex{},
+
+		running:     running,
+		stop:        stop,
+		closing:     closing,
+		markClosing: markClosing,
+		unflushed:   make(map[string]struct{}),
+	}
+	for _, command := range append(builtInCommands(), c.Commands.Commands...) {
+		chat.commands[strings.ToLower(command.Name)] = command
+	}
+	history := chat.trackHistory(running, incomingHistoryBroadcasts)
+	chat.goTask(func() { c.History.Repository.Listen(history) })
+	chat.goTask(func() { chat.Listen(incomingBroadcasts) })
+	chat.goTask(func() { chat.cleanup(running, c.History.CleanUpFrequency) })
+	chat.goTask(func() { chat.runSchedule(running, c.Schedule.PollInterval, c.Schedule.Lease) })
+	if ownPubSub != nil {
+		chat.goTask(func() {
+			<-running.Done()
+			if err := ownPubSub.Close(); err != nil {
+				c.Logger.Error("unable to close down default watermill publisher", slog.Any("error", err))
+			}
+		})
 	}
-	go c.History.Repository.Listen(incomingHistoryBroadcasts)
-	go chat.Listen(incomingBroadcasts)
-	go chat.cleanup(ctx, c.History.CleanUpFrequency)
 	return chat, nil
 }
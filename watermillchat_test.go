@@ -3,12 +3,25 @@ package watermillchat_test
 import (
 	"context"
 	"testing"
-	"time"
 
+	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
 	"github.com/dkotik/watermillchat"
 )
 
+// synchronousWatermill makes every publication wait until all
+// subscribers acknowledge it, so that tests need not wait for delivery.
+func synchronousWatermill() watermillchat.WatermillConfiguration {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{
+		BlockPublishUntilSubscriberAck: true,
+	}, watermill.NopLogger{})
+	return watermillchat.WatermillConfiguration{
+		Publisher:  pubSub,
+		Subscriber: pubSub,
+	}
+}
+
 type mockHistoryRepository struct {
 	totalMessagesRecieved int
 }
@@ -30,6 +43,7 @@ func TestHistoryDeliver(t *testing.T) {
 
 	history := &mockHistoryRepository{}
 	chat, err := watermillchat.New(ctx, watermillchat.Configuration{
+		Watermill: synchronousWatermill(),
 		History: watermillchat.HistoryConfiguration{
 			Repository: history,
 		},
@@ -49,7 +63,6 @@ func TestHistoryDeliver(t *testing.T) {
 		}
 	}
 
-	<-time.After(time.Second)
 	if history.totalMessagesRecieved != 50 {
 		t.Fatal("unexpected messages in history:", history.totalMessagesRecieved)
 	}